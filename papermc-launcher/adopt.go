@@ -0,0 +1,265 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const WHITELIST_FILE = "whitelist.json"
+
+// paper-1.21.1-123.jar, spigot-1.20.4.jar, minecraft_server.1.20.1.jar
+var serverJarRegexp = regexp.MustCompile(`^(paper|spigot|craftbukkit|purpur|minecraft_server|server)[-.]?(\d+\.\d+(?:\.\d+)?)?(?:-(\d+))?\.jar$`)
+
+// git-Paper-123 (MC: 1.21.1)
+var paperVersionRegexp = regexp.MustCompile(`Paper-(\d+) \(MC: ([\d.]+)\)`)
+
+// What adopt found in an existing server directory
+type ServerInspection struct {
+	Jar      string
+	Flavor   string
+	Version  VersionInfo
+	Plugins  map[string]VersionInfo
+	Players  []Player
+	Eula     bool
+	HasWorld bool
+}
+
+func (i ServerInspection) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Server jar: %v (%v %v", i.Jar, i.Flavor, i.Version.Version)
+	if i.Version.Build > 0 {
+		fmt.Fprintf(&b, " build %v", i.Version.Build)
+	}
+	fmt.Fprintf(&b, ")\nPlugins: %v\nPlayers: %v\nWorld: %v, EULA accepted: %v", len(i.Plugins), len(i.Players), i.HasWorld, i.Eula)
+	return b.String()
+}
+
+// InspectServer detects the server jar, version, plugins and players of dir
+func InspectServer(dir string) (ServerInspection, error) {
+	inspection := ServerInspection{Plugins: make(map[string]VersionInfo)}
+	jars, err := filepath.Glob(filepath.Join(dir, "*.jar"))
+	if err != nil {
+		return inspection, err
+	}
+	for _, jar := range jars {
+		match := serverJarRegexp.FindStringSubmatch(strings.ToLower(filepath.Base(jar)))
+		if match == nil {
+			continue
+		}
+		// Prefer a jar with the version in its name over a generic server.jar
+		if inspection.Jar != "" && match[2] == "" {
+			continue
+		}
+		inspection.Jar = filepath.Base(jar)
+		inspection.Flavor = match[1]
+		inspection.Version.Version = match[2]
+		inspection.Version.Build, _ = strconv.Atoi(match[3])
+	}
+	if inspection.Jar == "" {
+		return inspection, fmt.Errorf("no server jar found in %v", dir)
+	}
+	// Paper records the running version, which is more reliable than the file name
+	if content, err := os.ReadFile(filepath.Join(dir, "version_history.json")); err == nil {
+		var history struct {
+			CurrentVersion string `json:"currentVersion"`
+		}
+		if json.Unmarshal(content, &history) == nil {
+			if match := paperVersionRegexp.FindStringSubmatch(history.CurrentVersion); match != nil {
+				inspection.Flavor = "paper"
+				inspection.Version.Build, _ = strconv.Atoi(match[1])
+				inspection.Version.Version = match[2]
+			}
+		}
+	}
+
+	plugins, _ := filepath.Glob(filepath.Join(dir, "plugins", "*.jar"))
+	for _, plugin := range plugins {
+		description, err := readPluginDescription(plugin)
+		if err != nil {
+			warnf("Can not read plugin %v: %v", filepath.Base(plugin), err)
+			continue
+		}
+		name := strings.ToLower(description.Name)
+		// The key LoadGeyser uses for its updates
+		if name == "geyser-spigot" {
+			name = "geyser"
+		}
+		inspection.Plugins[name] = VersionInfo{Version: description.Version}
+	}
+
+	players, err := whitelistedPlayers(dir)
+	if err != nil {
+		return inspection, err
+	}
+	inspection.Players = players
+
+	eula, _ := os.ReadFile(filepath.Join(dir, "eula.txt"))
+	inspection.Eula = strings.Contains(string(eula), "eula=true")
+	_, err = os.Stat(filepath.Join(LevelDir(dir), "level.dat"))
+	inspection.HasWorld = err == nil
+	return inspection, nil
+}
+
+// The fields of plugin.yml the launcher looks at
+type pluginDescription struct {
+	Name           string `yaml:"name"`
+	Version        string `yaml:"version"`
+	FoliaSupported bool   `yaml:"folia-supported"`
+}
+
+func readPluginDescription(jar string) (pluginDescription, error) {
+	var description pluginDescription
+	archive, err := zip.OpenReader(jar)
+	if err != nil {
+		return description, err
+	}
+	defer archive.Close()
+	for _, name := range []string{"paper-plugin.yml", "plugin.yml"} {
+		file, err := archive.Open(name)
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return description, err
+		}
+		if err := yaml.Unmarshal(content, &description); err != nil {
+			return description, err
+		}
+		if description.Name != "" {
+			return description, nil
+		}
+	}
+	return description, errors.New("no plugin.yml")
+}
+
+// Players from whitelist.json, operators from ops.json get the op flag
+func whitelistedPlayers(dir string) ([]Player, error) {
+	var whitelist []UserCacheEntry
+	content, err := os.ReadFile(filepath.Join(dir, WHITELIST_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &whitelist); err != nil {
+		return nil, fmt.Errorf("error decoding whitelist: %w", err)
+	}
+	ops, err := LoadOps(dir)
+	if err != nil {
+		return nil, err
+	}
+	isOp := make(map[string]bool)
+	for _, op := range ops {
+		isOp[strings.ToLower(op.Name)] = true
+	}
+	var players []Player
+	for _, entry := range whitelist {
+		player := Player{Type: Java, Nickname: entry.Name, Op: isOp[strings.ToLower(entry.Name)]}
+		// Floodgate prefixes bedrock players with a dot
+		if strings.HasPrefix(entry.Name, ".") {
+			player.Type = Bedrock
+			player.Nickname = strings.TrimPrefix(entry.Name, ".")
+		}
+		players = append(players, player)
+	}
+	return players, nil
+}
+
+// RunAdopt brings an existing server directory under launcher management:
+// records the installed versions in version.json and writes a starter config to filename.
+func RunAdopt(dir, filename string) error {
+	p := prompter{reader: bufio.NewReader(os.Stdin)}
+	if _, err := os.Stat(filename); err == nil {
+		if !p.Confirm(fmt.Sprintf("Config %v already exists. Overwrite?", filename)) {
+			return errors.New("aborted")
+		}
+	}
+	inspection, err := InspectServer(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Println(inspection)
+	JarCacheDir = DefaultJarCacheDir()
+
+	unlock, err := LockVersionsInfo(dir)
+	if err != nil {
+		return err
+	}
+	info := VersionsInfo{Plugins: inspection.Plugins}
+	if inspection.Flavor == "paper" {
+		info.PaperVer = inspection.Version
+	}
+	err = DumpVersionsInfo(dir, info)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	if inspection.Flavor == "paper" {
+		if _, err := os.Lstat(filepath.Join(dir, "paper.jar")); errors.Is(err, os.ErrNotExist) {
+			if err := LinkFile(filepath.Join(dir, inspection.Jar), filepath.Join(dir, "paper.jar")); err != nil {
+				return err
+			}
+		}
+	} else if p.Confirm(fmt.Sprintf("Convert the %v server to Paper? The world is kept, back it up first", inspection.Flavor)) {
+		if err := LoadPaper(dir, FlavorPaper, nil, false); err != nil {
+			return err
+		}
+	} else {
+		return errors.New("the launcher runs paper.jar, convert the server to adopt it")
+	}
+	if !inspection.Eula {
+		fmt.Println("Minecraft EULA: https://aka.ms/MinecraftEULA")
+		if !p.Confirm("Do you accept the Minecraft EULA?") {
+			return errors.New("EULA has to be accepted to run the server")
+		}
+		if err := AcceptEula(dir); err != nil {
+			return fmt.Errorf("error writing eula: %w", err)
+		}
+	}
+
+	workDir, err := filepath.Rel(filepath.Dir(filename), dir)
+	if err != nil {
+		workDir, _ = filepath.Abs(dir)
+	}
+	config := Config{
+		WorkDir:    workDir,
+		WarnBefore: []Duration{Duration(10 * time.Minute), Duration(5 * time.Minute), Duration(time.Minute)},
+		AccessSchedule: Schedule{
+			DaysSchedule: make(map[Weekday]TimeInterval),
+		},
+		Memory:  p.Ask("Memory for the server (java -Xmx)", "4G"),
+		Players: inspection.Players,
+	}
+	for {
+		loc, err := time.LoadLocation(p.Ask("Timezone", "Local"))
+		if err == nil {
+			config.AccessSchedule.Timezone = Location(*loc)
+			break
+		}
+		fmt.Printf("Invalid timezone: %v\n", err)
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if err := writeConfigFile(filename, config); err != nil {
+		return err
+	}
+	infof("Config written to %v, add the open hours to days_schedule", filename)
+	return nil
+}
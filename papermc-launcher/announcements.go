@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Recurring in-game message, sent either every Interval or on a Cron schedule
+type Announcement struct {
+	// Go template, see AnnouncementData for the available fields
+	Message  string   `json:"message"`
+	Interval Duration `json:"interval,omitempty"`
+	// Standard five field cron expression in the schedule timezone
+	Cron CronSpec `json:"cron,omitempty"`
+	// Send as a tellraw JSON component instead of say
+	Tellraw bool `json:"tellraw,omitempty"`
+}
+
+type AnnouncementData struct {
+	Time     string
+	ClosesAt string
+	Online   int
+	Players  []string
+}
+
+func (a Announcement) Validate() error {
+	if a.Message == "" {
+		return errors.New("empty message")
+	}
+	if (a.Interval > 0) == (a.Cron.spec != "") {
+		return errors.New("exactly one of interval and cron should be set")
+	}
+	if a.Interval < 0 {
+		return errors.New("interval should be positive")
+	}
+	_, err := template.New("announcement").Parse(a.Message)
+	return err
+}
+
+// Next time the announcement is due after t
+func (a Announcement) Next(t time.Time) time.Time {
+	if a.Interval > 0 {
+		return t.Add(time.Duration(a.Interval))
+	}
+	return a.Cron.Next(t)
+}
+
+// Command renders the message into a say or tellraw command
+func (a Announcement) Command(data AnnouncementData) (string, error) {
+	tmpl, err := template.New("announcement").Parse(a.Message)
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	if err := tmpl.Execute(&text, data); err != nil {
+		return "", err
+	}
+	if !a.Tellraw {
+		return "say " + text.String(), nil
+	}
+	if json.Valid([]byte(text.String())) {
+		return "tellraw @a " + text.String(), nil
+	}
+	component, _ := json.Marshal(map[string]string{"text": text.String(), "color": "gold"})
+	return fmt.Sprintf("tellraw @a %s", component), nil
+}
+
+// Parsed cron expression: minute, hour, day of month, month, day of week
+type CronSpec struct {
+	spec   string
+	fields [5]uint64
+}
+
+// Day of week accepts 7 as Sunday
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func ParseCron(spec string) (CronSpec, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return CronSpec{}, fmt.Errorf("cron %q should have 5 fields", spec)
+	}
+	result := CronSpec{spec: spec}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronRanges[i][0], cronRanges[i][1])
+		if err != nil {
+			return CronSpec{}, fmt.Errorf("cron %q: %w", spec, err)
+		}
+		result.fields[i] = bits
+	}
+	if result.fields[4]&(1<<7) != 0 {
+		result.fields[4] = result.fields[4]&^(1<<7) | 1
+	}
+	return result, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("invalid value %q", lowPart)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("invalid value %q", highPart)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of range %v-%v", item, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c CronSpec) matches(t time.Time) bool {
+	has := func(field int, v int) bool { return c.fields[field]&(1<<v) != 0 }
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+	domAll := c.fields[2] == cronAll(2)
+	dowAll := c.fields[4]&0x7f == 0x7f
+	dom, dow := has(2, t.Day()), has(4, int(t.Weekday()))
+	// Like cron, restricted day of month and day of week are alternatives
+	if !domAll && !dowAll {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func cronAll(field int) uint64 {
+	var bits uint64
+	for v := cronRanges[field][0]; v <= cronRanges[field][1]; v++ {
+		bits |= 1 << v
+	}
+	return bits
+}
+
+// Next returns the first matching minute after t, or zero time if there is none within a year
+func (c CronSpec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(1, 0, 0); t.Before(limit); t = t.Add(time.Minute) {
+		if c.matches(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c CronSpec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.spec)
+}
+
+func (c *CronSpec) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return fmt.Errorf("cron should be a string")
+	}
+	if value == "" {
+		*c = CronSpec{}
+		return nil
+	}
+	tmp, err := ParseCron(value)
+	if err != nil {
+		return err
+	}
+	*c = tmp
+	return nil
+}
+
+// ClosingTime returns the end of the access interval t falls into
+func (sch Schedule) ClosingTime(t time.Time) (time.Time, bool) {
+	loc := time.Location(sch.Timezone)
+	now := t.In(&loc)
+	interval, ok := sch.DaysSchedule[Weekday(now.Weekday())]
+	if !ok {
+		return time.Time{}, false
+	}
+	start, end := interval.Start.On(now), interval.End.On(now)
+	if now.Before(start) || !now.Before(end) {
+		return time.Time{}, false
+	}
+	return end, true
+}
+
+// Broadcasts the configured announcements while somebody is online
+func (s *Server) runAnnouncements(ctx context.Context) {
+	loc := time.Location(s.Config().AccessSchedule.Timezone)
+	now := time.Now().In(&loc)
+	due := make([]time.Time, len(s.Config().Announcements))
+	for i, a := range s.Config().Announcements {
+		due[i] = a.Next(now)
+	}
+	for {
+		var next time.Time
+		for _, t := range due {
+			if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+		if next.IsZero() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		now := time.Now().In(&loc)
+		data := AnnouncementData{Time: now.Format("15:04"), Players: s.sessions.Online()}
+		data.Online = len(data.Players)
+		if closes, ok := s.Config().AccessSchedule.ClosingTime(now); ok {
+			data.ClosesAt = closes.Format("15:04")
+		}
+		for i, a := range s.Config().Announcements {
+			if due[i].IsZero() || now.Before(due[i]) {
+				continue
+			}
+			due[i] = a.Next(now)
+			if data.Online == 0 || s.quietAt(now) {
+				continue
+			}
+			command, err := a.Command(data)
+			if err != nil {
+				warnf("Failed to render announcement: %v", err)
+				continue
+			}
+			s.queue.Push(ConsoleCommand(command, OriginSchedule, PriorityChat))
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A player who keeps trying is asked about again after this long
+const JOIN_REQUEST_REPROMPT = time.Hour
+
+// Steve (/1.2.3.4:50123) lost connection: You are not white-listed on this server!
+// Disconnecting Steve (/1.2.3.4:50123): You are not white-listed on this server!
+var notWhitelistedRegexp = regexp.MustCompile(`INFO\]: (?:Disconnecting )?([.\w]+) \(/[^)]*\)(?: lost connection)?: You are not white-listed on this server!`)
+
+// Unknown players trying to join are offered for approval in the bridged chats
+type JoinApprovalConfig struct {
+	// Chat bridge admins allowed to answer, as telegram:<user id> or discord:<user id>
+	Approvers []string `json:"approvers"`
+}
+
+func (c *JoinApprovalConfig) Validate(bridge ChatBridgeConfig) error {
+	if bridge.Telegram == nil && bridge.Discord == nil {
+		return errors.New("join requests are asked in the chat bridge, which is not configured")
+	}
+	if len(c.Approvers) == 0 {
+		return errors.New("approvers are not set")
+	}
+	for _, approver := range c.Approvers {
+		if !slices.Contains(bridge.Admins, approver) {
+			return fmt.Errorf("approver %v is not a chat_bridge admin", approver)
+		}
+	}
+	return nil
+}
+
+type joinRequest struct {
+	at     time.Time
+	denied bool
+}
+
+// Join requests waiting for an answer, keyed by the lowercase server name
+type JoinRequests struct {
+	mu       sync.Mutex
+	requests map[string]joinRequest
+}
+
+// Add records the attempt and reports whether the admins should be asked
+func (j *JoinRequests) Add(name string, at time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.requests == nil {
+		j.requests = make(map[string]joinRequest)
+	}
+	key := strings.ToLower(name)
+	if request, ok := j.requests[key]; ok && (request.denied || at.Sub(request.at) < JOIN_REQUEST_REPROMPT) {
+		return false
+	}
+	j.requests[key] = joinRequest{at: at}
+	return true
+}
+
+// Answer resolves a pending request, denied players are not asked about again
+func (j *JoinRequests) Answer(name string, approve bool) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := strings.ToLower(name)
+	request, ok := j.requests[key]
+	if !ok || request.denied {
+		return false
+	}
+	if approve {
+		delete(j.requests, key)
+	} else {
+		j.requests[key] = joinRequest{at: request.at, denied: true}
+	}
+	return true
+}
+
+// ParseNotWhitelisted returns the name of a player the server refused
+func ParseNotWhitelisted(line string) (string, bool) {
+	match := notWhitelistedRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// Asks the admins about unknown players refused by the whitelist
+func (s *Server) trackJoinRequests(line string) {
+	if s.Config().JoinApproval == nil {
+		return
+	}
+	name, ok := ParseNotWhitelisted(line)
+	if !ok {
+		return
+	}
+	for _, player := range s.Config().Players {
+		if strings.EqualFold(player.ServerName(), name) {
+			// Known player outside the open hours
+			return
+		}
+	}
+	if s.joinRequests.Add(name, time.Now()) {
+		s.chatBridge.Broadcast(s.msg(MsgJoinRequest, name, name, name))
+	}
+}
+
+// Turns /approve and /deny in the bridged chats into console commands, reports whether it was one
+func (s *Server) handleApprovalReply(origin string, author ChatAuthor, text string) bool {
+	if s.Config().JoinApproval == nil {
+		return false
+	}
+	command, name, _ := strings.Cut(strings.TrimSpace(text), " ")
+	if command != "/approve" && command != "/deny" {
+		return false
+	}
+	input := strings.TrimPrefix(command, "/") + " " + strings.TrimSpace(name)
+	role, ok := s.Config().ChatBridge.Role(origin, author)
+	if !ok || role < RequiredRole(input) || !slices.Contains(s.Config().JoinApproval.Approvers, origin+":"+author.ID) {
+		warnf("%v is not allowed to answer join requests", author)
+		return true
+	}
+	s.queue.Push(ConsoleCommand(input, origin+":"+author.String(), PriorityAdmin))
+	return true
+}
+
+// AnswerJoinRequest adds an approved player to the config and whitelists them while the server is open
+func (s *Server) AnswerJoinRequest(ctx context.Context, name string, approve bool) error {
+	if name == "" {
+		return errors.New("no player name")
+	}
+	if !s.joinRequests.Answer(name, approve) {
+		return fmt.Errorf("no join request from %v", name)
+	}
+	if !approve {
+		s.chatBridge.Broadcast(s.msg(MsgJoinDenied, name))
+		return nil
+	}
+	player := Player{Type: Java, Nickname: name}
+	if strings.HasPrefix(name, ".") {
+		player = Player{Type: Bedrock, Nickname: strings.TrimPrefix(name, ".")}
+	}
+	if s.ConfigPath != "" {
+		if err := AddPlayerToConfig(s.ConfigPath, player); err != nil {
+			return fmt.Errorf("error saving the config: %w", err)
+		}
+	}
+	s.updateConfig(func(config *Config) {
+		config.Players = append(slices.Clip(config.Players), player)
+	})
+	if _, open := s.Config().AccessSchedule.ClosingTime(time.Now()); open {
+		if err := s.SetWhitelisted(ctx, []Player{player}, true); err != nil {
+			return err
+		}
+	}
+	s.chatBridge.Broadcast(s.msg(MsgJoinApproved, name))
+	return nil
+}
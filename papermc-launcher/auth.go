@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Role int
+
+const (
+	Viewer Role = iota
+	Operator
+	Admin
+)
+
+func (r Role) String() string {
+	switch r {
+	case Viewer:
+		return "viewer"
+	case Operator:
+		return "operator"
+	case Admin:
+		return "admin"
+	default:
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+}
+
+func (r Role) MarshalJSON() ([]byte, error) {
+	if r < Viewer || r > Admin {
+		return nil, fmt.Errorf("Invalid role: %v", int(r))
+	}
+	return json.Marshal(r.String())
+}
+
+func (r *Role) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case string:
+		switch strings.ToLower(value) {
+		case "viewer":
+			*r = Viewer
+		case "operator":
+			*r = Operator
+		case "admin":
+			*r = Admin
+		default:
+			return fmt.Errorf("invalid role %q", value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Role should be a string")
+	}
+}
+
+type User struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  Role   `json:"role"`
+}
+
+// Authenticate finds the user owning the token. The legacy remote console token acts as an admin.
+func (c *Config) Authenticate(token string) (User, bool) {
+	if token == "" {
+		return User{}, false
+	}
+	found := false
+	var user User
+	candidates := c.Users
+	if c.RemoteConsole != nil && c.RemoteConsole.Token != "" {
+		candidates = append([]User{{Name: "admin", Token: c.RemoteConsole.Token, Role: Admin}}, candidates...)
+	}
+	// Compare against every user to not leak which token matched through timing
+	for _, candidate := range candidates {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate.Token)) == 1 && !found {
+			found = true
+			user = candidate
+		}
+	}
+	return user, found
+}
+
+// RequiredRole returns the least role allowed to run the console input. Anything not
+// listed, op, ban, whitelist and the schedule among others, needs an admin.
+func RequiredRole(input string) Role {
+	command, _, _ := strings.Cut(strings.TrimSpace(input), " ")
+	switch command {
+	case "!grep", "!tail", "!status", "!history", "backups", "stats", "compat":
+		return Viewer
+	case "wake", "backup", "reboot", "verify-backup", "profile",
+		"list", "say", "tell", "msg", "kick", "time", "weather", "tp", "teleport", "gamemode", "save-all", "tps":
+		return Operator
+	default:
+		return Admin
+	}
+}
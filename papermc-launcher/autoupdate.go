@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How long the updated server gets to come up before the update is rolled back
+const AUTO_UPDATE_START_TIMEOUT = 5 * time.Minute
+
+// Paper's channel of the stable builds
+const PAPER_DEFAULT_CHANNEL = "default"
+
+// Files the auto-update replaces, kept in AutoUpdatePreviousDir until the new builds start
+var autoUpdateFiles = []string{"paper.jar", VERSIONS_FILE, filepath.Join("plugins", "Geyser-Spigot.jar")}
+
+// Weekly window in which new builds of the installed paper version and geyser patch releases
+// are installed without asking. A new minecraft version is still left to update.
+type AutoUpdateConfig struct {
+	Day   Weekday `json:"day"`
+	Start DayTime `json:"start"`
+	// No update is started after this, players still online at the start may delay it past it
+	End DayTime `json:"end"`
+}
+
+func (c *AutoUpdateConfig) Validate() error {
+	if err := c.Start.Validate(); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if err := c.End.Validate(); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if c.End.Duration() <= c.Start.Duration() {
+		return errors.New("end has to be after start")
+	}
+	return nil
+}
+
+// Whether t is within the window, t is in the schedule timezone
+func (c *AutoUpdateConfig) Contains(t time.Time) bool {
+	if Weekday(t.Weekday()) != c.Day {
+		return false
+	}
+	return !t.Before(c.Start.On(t)) && t.Before(c.End.On(t))
+}
+
+// The work dir files replaced by the last auto-update
+func AutoUpdatePreviousDir(workDir string) string {
+	return filepath.Clean(workDir) + "-autoupdate"
+}
+
+// What the auto-update is going to install
+type pendingUpdate struct {
+	// Installed paper version, the build stays within it
+	version string
+	// Newer stable builds of the version, oldest first
+	builds []PaperBuild
+	// Geyser version to install, empty when it is up to date
+	geyser string
+	// The geyser build found by the check, the one installed
+	geyserBuild BuildInfo
+}
+
+func (u pendingUpdate) empty() bool {
+	return len(u.builds) == 0 && u.geyser == ""
+}
+
+// Short description for the notification: paper 1.21.4 #232, geyser 2.6.1
+func (u pendingUpdate) String() string {
+	var parts []string
+	if len(u.builds) > 0 {
+		parts = append(parts, fmt.Sprintf("paper %v #%v", u.version, u.builds[len(u.builds)-1].Build))
+	}
+	if u.geyser != "" {
+		parts = append(parts, fmt.Sprintf("geyser %v #%v", u.geyser, u.geyserBuild.Build))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Change summaries of the paper builds, one line per change
+func (u pendingUpdate) changelog() string {
+	var lines []string
+	for _, build := range u.builds {
+		for _, change := range build.Changes {
+			summary, _, _ := strings.Cut(change.Summary, "\n")
+			lines = append(lines, fmt.Sprintf("#%v: %v", build.Build, summary))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Stable builds newer than the installed one, experimental builds are never picked up
+func newerPaperBuilds(builds []PaperBuild, installed int) []PaperBuild {
+	var newer []PaperBuild
+	for _, build := range builds {
+		if build.Build <= installed {
+			continue
+		}
+		// Older API responses have no channel, all their builds are stable
+		if build.Channel != "" && build.Channel != PAPER_DEFAULT_CHANNEL {
+			continue
+		}
+		newer = append(newer, build)
+	}
+	return newer
+}
+
+// Whether latest is the installed version or a patch release of it, 2.6.0 -> 2.6.1 but not 2.6.1 -> 2.7.0
+func patchRelease(installed, latest string) bool {
+	return MajorVersion(latest) == MajorVersion(installed) && compareVersions(latest, installed) >= 0
+}
+
+// Looks up newer builds of the installed paper version and a geyser patch release
+func checkUpdates(dir string, flavor ServerFlavor) (pendingUpdate, error) {
+	var update pendingUpdate
+	info, err := LoadVersionsInfo(dir)
+	if err != nil {
+		return update, err
+	}
+	if info.PaperVer.Version == "" || info.Flavor.Project() != flavor.Project() {
+		return update, fmt.Errorf("no %v build recorded in %v", flavor.Project(), VERSIONS_FILE)
+	}
+	update.version = info.PaperVer.Version
+	var builds PaperBuilds
+	if err := getJSON(fmt.Sprintf(PAPER_API_BUILDS_URL_TEMPLATE, flavor.Project(), update.version), &builds); err != nil {
+		return update, err
+	}
+	update.builds = newerPaperBuilds(builds.Builds, info.PaperVer.Build)
+	geyser, ok := info.Plugins["geyser"]
+	if !ok {
+		return update, nil
+	}
+	latestVer, err := GetLatestVersion("geyser")
+	if err != nil {
+		return update, err
+	}
+	if !patchRelease(geyser.Version, latestVer) {
+		infof("Geyser %v is a new release, update to it by hand", latestVer)
+		return update, nil
+	}
+	latestBuild, err := GetLatestBuild("geyser", latestVer)
+	if err != nil {
+		return update, err
+	}
+	if latestVer != geyser.Version || latestBuild.Build != geyser.Build {
+		update.geyser, update.geyserBuild = latestVer, latestBuild
+	}
+	return update, nil
+}
+
+func (u pendingUpdate) install(dir string, flavor ServerFlavor) error {
+	if len(u.builds) > 0 {
+		if err := LoadPaperBuild(dir, flavor, u.version, u.builds[len(u.builds)-1]); err != nil {
+			return err
+		}
+	}
+	if u.geyser != "" {
+		if err := LoadGeyserBuild(dir, u.geyser, u.geyserBuild); err != nil {
+			return fmt.Errorf("%w: %w", ErrDownload, err)
+		}
+	}
+	return nil
+}
+
+// Copies the files the update replaces out of the work dir
+func saveAutoUpdateFiles(workDir string) error {
+	previous := AutoUpdatePreviousDir(workDir)
+	if err := os.RemoveAll(previous); err != nil {
+		return err
+	}
+	for _, name := range autoUpdateFiles {
+		// Stat follows the paper.jar link, the jar itself is saved
+		stat, err := os.Stat(filepath.Join(workDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		target := filepath.Join(previous, name)
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		if err := copyRegularFile(filepath.Join(workDir, name), target, stat.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Puts the saved files back and drops the geyser build waiting in plugins/update
+func restoreAutoUpdateFiles(workDir string) error {
+	previous := AutoUpdatePreviousDir(workDir)
+	for _, name := range autoUpdateFiles {
+		saved := filepath.Join(previous, name)
+		stat, err := os.Stat(saved)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		target := filepath.Join(workDir, name)
+		if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := copyRegularFile(saved, target, stat.Mode()); err != nil {
+			return err
+		}
+	}
+	err := os.Remove(filepath.Join(workDir, "plugins", "update", "Geyser-Spigot.jar"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Starts the server and waits until it is running
+func (s *Server) verifyStart(ctx context.Context) error {
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+	deadline := time.After(AUTO_UPDATE_START_TIMEOUT)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for s.Status() != Running {
+		select {
+		case <-s.runningCtx.Done():
+			return errors.New("the process exited")
+		case <-deadline:
+			return fmt.Errorf("not started in %v", AUTO_UPDATE_START_TIMEOUT)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// AutoUpdate looks up the pending builds and installs them, after a countdown in the
+// background when players are online. cancel-update stops it like a manual update.
+func (s *Server) AutoUpdate(ctx context.Context) error {
+	cfg := s.Config().AutoUpdate
+	if cfg == nil {
+		return nil
+	}
+	loc := time.Location(s.Config().AccessSchedule.Timezone)
+	workDir := s.Config().WorkDir
+	update, err := checkUpdates(workDir, s.Config().ServerFlavor)
+	if err != nil {
+		return fmt.Errorf("checking for updates: %w", err)
+	}
+	if update.empty() {
+		infof("No updates within the installed versions")
+		return nil
+	}
+	infof("Auto-update to %v", update)
+	if s.cmdCtx != nil && len(s.sessions.Online()) > 0 {
+		// Players get the countdown, they may hold the update until the window is over
+		s.startCountdown(ctx, s.updateAnnouncement, time.Until(cfg.End.On(time.Now().In(&loc))), func(runCtx context.Context) error {
+			return s.installAutoUpdate(runCtx, update)
+		})
+		return nil
+	}
+	return s.installAutoUpdate(ctx, update)
+}
+
+// Installs the update while the window is open: the server is backed up, updated and started,
+// and goes back to the previous builds if it does not come up. A sleeping server is only
+// started to check the update and stopped again.
+func (s *Server) installAutoUpdate(ctx context.Context, update pendingUpdate) error {
+	loc := time.Location(s.Config().AccessSchedule.Timezone)
+	workDir := s.Config().WorkDir
+	if !s.Config().AutoUpdate.Contains(time.Now().In(&loc)) {
+		infof("Auto-update window is over, the update waits for the next one")
+		return nil
+	}
+	running := s.cmdCtx != nil
+	if running {
+		if err := s.Stop(); err != nil {
+			return err
+		}
+	}
+	// Whatever happens the server ends up as it was found
+	restore := func() error {
+		if running {
+			return s.Start(ctx)
+		}
+		return nil
+	}
+	if err := s.offlineBackup(TriggerUpdate); err != nil {
+		return errors.Join(fmt.Errorf("update cancelled, backup failed: %w", err), restore())
+	}
+	if err := saveAutoUpdateFiles(workDir); err != nil {
+		return errors.Join(fmt.Errorf("update cancelled, can not keep the current builds: %w", err), restore())
+	}
+	err := update.install(workDir, s.Config().ServerFlavor)
+	if err == nil {
+		err = s.verifyStart(ctx)
+	}
+	if err == nil {
+		s.Notify(EventAutoUpdate, s.msg(MsgAutoUpdated, update), update.changelog())
+		if !running {
+			return s.Stop()
+		}
+		return nil
+	}
+	errorf("Auto-update to %v failed, rolling back: %v", update, err)
+	if s.cmdCtx != nil {
+		s.Stop()
+	}
+	if restoreErr := restoreAutoUpdateFiles(workDir); restoreErr != nil {
+		err = errors.Join(err, fmt.Errorf("rollback: %w", restoreErr))
+	}
+	s.Notify(EventAutoUpdate, s.msg(MsgAutoUpdateFailed, update, err), "")
+	return errors.Join(err, restore())
+}
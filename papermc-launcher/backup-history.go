@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// How many runs the backup history keeps
+const BACKUP_HISTORY_LENGTH = 200
+
+// Successful runs the archive size is compared with
+const BACKUP_GROWTH_WINDOW = 10
+
+const DEFAULT_BACKUP_GROWTH = 1.5
+
+// One backup attempt, successful or not
+type BackupRun struct {
+	Time      time.Time  `json:"time"`
+	Trigger   string     `json:"trigger"`
+	Mode      BackupMode `json:"mode,omitempty"`
+	Archive   string     `json:"archive,omitempty"`
+	Size      int64      `json:"size,omitempty"`
+	WorldSize int64      `json:"world_size,omitempty"`
+	Duration  Duration   `json:"duration"`
+	Error     string     `json:"error,omitempty"`
+}
+
+func (r BackupRun) String() string {
+	result := "ok"
+	if r.Error != "" {
+		result = "FAILED: " + r.Error
+	}
+	return fmt.Sprintf("%v %v %v archive %v MiB, world %v MiB, took %v, %v",
+		r.Time.Format("2006-01-02 15:04"), r.Trigger, r.Mode, r.Size>>20, r.WorldSize>>20,
+		time.Duration(r.Duration).Round(time.Second), result)
+}
+
+func backupHistoryPath(workDir string) string {
+	return filepath.Clean(workDir) + "-backup-history.json"
+}
+
+func LoadBackupHistory(workDir string) ([]BackupRun, error) {
+	content, err := os.ReadFile(backupHistoryPath(workDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []BackupRun
+	if err := json.Unmarshal(content, &history); err != nil {
+		return nil, fmt.Errorf("error decoding backup history: %w", err)
+	}
+	return history, nil
+}
+
+// RecordBackupRun appends the run to the history, dropping the oldest runs
+func RecordBackupRun(workDir string, run BackupRun) ([]BackupRun, error) {
+	history, err := LoadBackupHistory(workDir)
+	if err != nil {
+		return nil, err
+	}
+	history = append(history, run)
+	if len(history) > BACKUP_HISTORY_LENGTH {
+		history = history[len(history)-BACKUP_HISTORY_LENGTH:]
+	}
+	return history, writeJSON(backupHistoryPath(workDir), history)
+}
+
+// backupGrowth compares the last run with the median of the successful runs before it
+func backupGrowth(history []BackupRun) (float64, bool) {
+	if len(history) == 0 || history[len(history)-1].Error != "" {
+		return 0, false
+	}
+	last := history[len(history)-1]
+	var sizes []int64
+	for i := len(history) - 2; i >= 0 && len(sizes) < BACKUP_GROWTH_WINDOW; i-- {
+		if history[i].Error == "" && history[i].Size > 0 {
+			sizes = append(sizes, history[i].Size)
+		}
+	}
+	if len(sizes) < 3 {
+		return 0, false
+	}
+	slices.Sort(sizes)
+	return float64(last.Size) / float64(sizes[len(sizes)/2]), true
+}
+
+// Records the run and warns when the archive grew well above the usual size
+func (s *Server) recordBackupRun(trigger string, started time.Time, archive string, backupErr error) {
+	run := BackupRun{Time: started, Trigger: trigger, Duration: Duration(time.Since(started))}
+	if backupErr != nil {
+		run.Error = backupErr.Error()
+	} else if content, err := os.ReadFile(manifestPath(archive)); err == nil {
+		var manifest BackupManifest
+		if json.Unmarshal(content, &manifest) == nil {
+			run.Mode, run.Archive, run.Size, run.WorldSize = manifest.Mode, manifest.Archive, manifest.Size, manifest.WorldSize
+		}
+	}
+	history, err := RecordBackupRun(s.Config().WorkDir, run)
+	if err != nil {
+		warnf("Failed to record backup history: %v", err)
+		return
+	}
+	limit := s.Config().Backup.GrowthAlert
+	if limit <= 0 {
+		limit = DEFAULT_BACKUP_GROWTH
+	}
+	if growth, ok := backupGrowth(history); ok && growth > limit {
+		s.Notify(EventBackupGrowth, s.msg(MsgBackupGrowth, growth, run.Size>>20), s.msg(MsgBackupGrowthHint))
+	}
+}
+
+func (s *Server) printBackupHistory(n int) {
+	history, err := LoadBackupHistory(s.Config().WorkDir)
+	if err != nil {
+		s.reply(fmt.Sprintf("Error reading backup history: %v", err))
+		return
+	}
+	if len(history) == 0 {
+		s.reply("No backups recorded yet")
+		return
+	}
+	if len(history) > n {
+		history = history[len(history)-n:]
+	}
+	for _, run := range history {
+		s.reply(run.String())
+	}
+}
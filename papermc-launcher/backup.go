@@ -0,0 +1,375 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// How many files from an archive are compared against the files on disk
+const VERIFY_SAMPLE_SIZE = 32
+
+type BackupMode string
+
+const (
+	// Archive the running server with autosave turned off
+	HotBackup BackupMode = "hot"
+	// Stop the server, archive and start it again
+	ColdBackup BackupMode = "cold"
+)
+
+type BackupScheduleEntry struct {
+	Day  Weekday    `json:"day"`
+	Time DayTime    `json:"time"`
+	Mode BackupMode `json:"mode,omitempty"`
+}
+
+var defaultBackupSchedule = []BackupScheduleEntry{
+	{Day: Weekday(time.Monday), Time: DayTime{hours: 5}, Mode: HotBackup},
+}
+
+type BackupConfig struct {
+	// When to back up, weekly on Monday 05:00 if not set
+	Schedule []BackupScheduleEntry `json:"schedule,omitempty"`
+	// Commands sent before a hot backup, e.g. to pause a plugin-side autosave scheduler
+	PauseCommands []string `json:"pause_commands,omitempty"`
+	// Commands sent after a hot backup is done
+	ResumeCommands []string `json:"resume_commands,omitempty"`
+	// Off-site copies made after every verified backup
+	Targets []BackupTarget `json:"targets,omitempty"`
+	// Warn when an archive is this many times larger than the usual one, 1.5 by default
+	GrowthAlert float64 `json:"growth_alert,omitempty"`
+	// A backup this recent spares the snapshot before a rollback, an hour by default
+	SnapshotMaxAge Duration `json:"snapshot_max_age,omitempty"`
+	// Limits the IO and CPU of every hot backup, cold ones run at full speed
+	Throttle *BackupThrottle `json:"throttle,omitempty"`
+}
+
+func (b BackupConfig) Entries() []BackupScheduleEntry {
+	if b.Schedule == nil {
+		return defaultBackupSchedule
+	}
+	return b.Schedule
+}
+
+func (b BackupConfig) Validate() error {
+	for _, entry := range b.Schedule {
+		if err := entry.Time.Validate(); err != nil {
+			return err
+		}
+		if entry.Mode != "" && entry.Mode != HotBackup && entry.Mode != ColdBackup {
+			return fmt.Errorf("invalid backup mode %q", entry.Mode)
+		}
+	}
+	names := make(map[string]bool)
+	for _, target := range b.Targets {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+		if names[target.Name] {
+			return fmt.Errorf("duplicate backup target %q", target.Name)
+		}
+		names[target.Name] = true
+	}
+	if b.Throttle != nil {
+		if err := b.Throttle.Validate(); err != nil {
+			return fmt.Errorf("throttle: %w", err)
+		}
+	}
+	return nil
+}
+
+type VerifyReport struct {
+	Entries    int
+	Files      int
+	Checked    int
+	Skipped    int
+	Mismatches []string
+	HasLevel   bool
+}
+
+func (r VerifyReport) String() string {
+	return fmt.Sprintf("%v entries, %v files, %v checked against disk, %v changed since backup, %v mismatches",
+		r.Entries, r.Files, r.Checked, r.Skipped, len(r.Mismatches))
+}
+
+type archivedFile struct {
+	sum     string
+	size    int64
+	modTime int64
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// VerifyBackup reads the whole archive (which fails on any corruption) and
+// compares checksums of a random sample of files with their on-disk copies.
+// Files modified after the backup was taken are skipped. Entries are relative to the
+// directory of the archive, the parent of the work dir.
+func VerifyBackup(archive string) (VerifyReport, error) {
+	var report VerifyReport
+	f, err := os.Open(archive)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	files := make(map[string]archivedFile)
+	reader, err := openArchive(f, archive)
+	if err != nil {
+		return report, err
+	}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("archive is corrupted after %v entries: %w", report.Entries, err)
+		}
+		report.Entries++
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		report.Files++
+		if filepath.Base(header.Name) == "level.dat" {
+			report.HasLevel = true
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, reader); err != nil {
+			return report, fmt.Errorf("archive is corrupted at %v: %w", header.Name, err)
+		}
+		files[header.Name] = archivedFile{
+			sum:     fmt.Sprintf("%x", h.Sum(nil)),
+			size:    header.Size,
+			modTime: header.ModTime.Unix(),
+		}
+	}
+	if report.Files == 0 {
+		return report, errors.New("archive contains no files")
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+	for _, name := range names {
+		if report.Checked >= VERIFY_SAMPLE_SIZE {
+			break
+		}
+		archived := files[name]
+		path := filepath.FromSlash(name)
+		// Older archives stored the work dir path as it was given
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(archive), path)
+		}
+		stat, err := os.Stat(path)
+		if err != nil || stat.ModTime().Unix() != archived.modTime || stat.Size() != archived.size {
+			report.Skipped++
+			continue
+		}
+		sum, err := fileChecksum(path)
+		if err != nil {
+			report.Skipped++
+			continue
+		}
+		report.Checked++
+		if sum != archived.sum {
+			report.Mismatches = append(report.Mismatches, name)
+		}
+	}
+	if len(report.Mismatches) > 0 {
+		return report, fmt.Errorf("checksum mismatch for %v", strings.Join(report.Mismatches, ", "))
+	}
+	return report, nil
+}
+
+func VerifyAndReport(archive string) error {
+	infof("Verifying backup %v", archive)
+	if err := checkManifest(archive); err != nil {
+		errorf("Backup %v failed verification: %v", archive, err)
+		return err
+	}
+	report, err := VerifyBackup(archive)
+	if err != nil {
+		errorf("Backup %v failed verification: %v (%v)", archive, err, report)
+		return err
+	}
+	if !report.HasLevel {
+		warnf("Backup %v contains no level.dat", archive)
+	}
+	infof("Backup %v verified: %v", archive, report)
+	return nil
+}
+
+// BackupFolder archives dir into a timestamped tar.gz next to it and records it in the catalog.
+// The throttle is optional.
+func BackupFolder(dir, trigger string, mode BackupMode, throttle *BackupThrottle) (string, error) {
+	started := time.Now()
+	bakName := fmt.Sprintf("%v-backup-%v.tar.gz", dir, started.Format("2006-01-02_15-04_MST"))
+	infof("Backing up folder %v to %v", dir, bakName)
+	err := archiveFolder(dir, bakName, throttle)
+	if err != nil {
+		os.Remove(bakName)
+		return bakName, err
+	}
+	if _, err := RecordBackup(dir, bakName, trigger, mode, started); err != nil {
+		warnf("Failed to record backup manifest: %v", err)
+	}
+	return bakName, nil
+}
+
+func archiveFolder(dir, target string, throttle *BackupThrottle) error {
+	if throttle == nil || throttle.IOClass == "" {
+		return writeArchive(dir, target, throttle)
+	}
+	done := make(chan error, 1)
+	go func() {
+		// Never unlocked, the thread exits with the goroutine and its priority with it
+		runtime.LockOSThread()
+		if err := setThreadIOClass(throttle.IOClass); err != nil {
+			warnf("Can not lower the backup IO priority: %v", err)
+		}
+		done <- writeArchive(dir, target, throttle)
+	}()
+	return <-done
+}
+
+func writeArchive(dir, target string, throttle *BackupThrottle) error {
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewWriterLevel(f, throttle.compressionLevel())
+	if err != nil {
+		return err
+	}
+	var limiter *rateLimiter
+	if throttle != nil {
+		limiter = newRateLimiter(throttle.ReadMBps)
+	}
+	tw := tar.NewWriter(gz)
+	// Entries start with the work dir name, the archive restores next to it wherever it is extracted
+	base := filepath.Dir(filepath.Clean(dir))
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Locked by the running server on Windows and useless for a restore
+		if d.Name() == "session.lock" || d.Name() == INSTANCE_LOCK_FILE || d.Name() == STATUS_SOCKET_FILE {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted since the directory was read, like a rotated log
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var file *os.File
+		if info.Mode().IsRegular() {
+			if file, err = os.Open(path); errors.Is(err, fs.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			defer file.Close()
+			// The size of the open file, it may have changed since the directory was read
+			if info, err = file.Stat(); err != nil {
+				return err
+			}
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		// The tar format rounds sub-second times, keep them comparable with the disk
+		header.ModTime = header.ModTime.Truncate(time.Second)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if file == nil {
+			return nil
+		}
+		// Files like logs may grow while archiving, take only what the header promised
+		copied, err := io.CopyN(tw, throttled(file, limiter), header.Size)
+		if errors.Is(err, io.EOF) {
+			// Truncated meanwhile, the header can not be taken back, so the rest is zeros
+			warnf("%v shrank while archiving, the backup copy is padded with zeros", path)
+			_, err = io.CopyN(tw, zeroReader{}, header.Size-copied)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Endless zeros, padding for the files that shrink while they are archived
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// Opens a backup for reading, both the current tar.gz and the older tar.bz2 archives are supported
+func openArchive(f io.Reader, name string) (*tar.Reader, error) {
+	switch {
+	case strings.HasSuffix(name, ".tar.bz2"):
+		return tar.NewReader(bzip2.NewReader(f)), nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return tar.NewReader(gz), nil
+	default:
+		return nil, fmt.Errorf("unknown archive format of %v", name)
+	}
+}
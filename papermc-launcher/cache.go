@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory shared by all launcher instances where downloads are kept by their sha256.
+// Empty disables the cache.
+var JarCacheDir string
+
+// DefaultJarCacheDir is inside the user cache directory, like ~/.cache/papermc-launcher
+func DefaultJarCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "papermc-launcher")
+}
+
+// Downloads url into the cache unless a file with this checksum is there already
+func fetchCached(url, checksum string) (string, error) {
+	checksum = strings.ToLower(checksum)
+	path := filepath.Join(JarCacheDir, checksum)
+	if _, err := os.Stat(path); err == nil {
+		infof("Using cached %v", checksum)
+		return path, nil
+	}
+	if err := os.MkdirAll(JarCacheDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(JarCacheDir, checksum+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download of %v failed: %v", url, resp.Status)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		return "", err
+	}
+	if checksum != fmt.Sprintf("%x", h.Sum(nil)) {
+		return "", fmt.Errorf("Sha256 does not match")
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// Hard links the cached file into place, copies it when the cache is on another file system
+func linkCached(source, target string) error {
+	if os.Link(source, target) == nil {
+		return nil
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+	return out.Close()
+}
+
+// Same contract as LoadFileIfDoesNotExist, going through the shared cache
+func loadCachedFile(url, dir, filename, checksum string) error {
+	target := filepath.Join(dir, filename)
+	if _, err := os.Lstat(target); err == nil {
+		return &fs.PathError{Op: "open", Path: target, Err: fs.ErrExist}
+	}
+	cached, err := fetchCached(url, checksum)
+	if err != nil {
+		return err
+	}
+	return linkCached(cached, target)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The capture of a command ends after this long without output
+const DEFAULT_CAPTURE_IDLE = time.Second
+
+// and in any case after this long
+const CAPTURE_MAX_WINDOW = time.Minute
+
+// Chat bridge messages starting with this run a console command
+const CHAT_COMMAND_PREFIX = "/cmd "
+
+// Collects the console output that follows a command and hands it to whoever issued it.
+// The output is correlated by time only, lines of other events in the window are included.
+type Capture struct {
+	Idle    time.Duration
+	Deliver func(lines []string)
+}
+
+// Starts collecting before the command runs so the first lines are not missed
+func (s *Server) startCapture(cmd Command) {
+	lines := s.output.Subscribe()
+	idle := cmd.Capture.Idle
+	if idle <= 0 {
+		idle = DEFAULT_CAPTURE_IDLE
+	}
+	go func() {
+		defer s.output.Unsubscribe(lines)
+		var captured []string
+		timer := time.NewTimer(idle)
+		defer timer.Stop()
+		deadline := time.After(CAPTURE_MAX_WINDOW)
+	collect:
+		for {
+			select {
+			case line := <-lines:
+				captured = append(captured, line)
+				timer.Reset(idle)
+			case <-timer.C:
+				break collect
+			case <-deadline:
+				break collect
+			}
+		}
+		s.audit.RecordOutput(s.Config().WorkDir, cmd, captured)
+		cmd.Capture.Deliver(captured)
+	}()
+}
+
+// RecordOutput appends the captured output of the command to the audit log
+func (a *AuditTrail) RecordOutput(workDir string, cmd Command, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v [%v] output of %v:\n", time.Now().Format("Jan 02 15:04:05"), cmd.Origin, cmd)
+	for _, line := range lines {
+		fmt.Fprintf(&b, "\t%v\n", line)
+	}
+	a.write(workDir, b.String())
+}
+
+// Runs `/cmd <command>` from the bridged chats for the operators and answers with the output,
+// reports whether the message was one
+func (s *Server) handleChatBridgeCommand(origin string, author ChatAuthor, text string) bool {
+	bridge := s.Config().ChatBridge
+	input, ok := strings.CutPrefix(strings.TrimSpace(text), CHAT_COMMAND_PREFIX)
+	if !ok || len(bridge.Operators)+len(bridge.Admins) == 0 {
+		return false
+	}
+	input = strings.TrimSpace(input)
+	role, ok := bridge.Role(origin, author)
+	if !ok {
+		warnf("%v is not allowed to run commands from %v", author, origin)
+		return true
+	}
+	if required := RequiredRole(input); required > role {
+		s.chatBridge.Reply(origin, fmt.Sprintf("Permission denied: %q requires role %v", input, required))
+		return true
+	}
+	cmd := ConsoleCommand(input, origin+":"+author.String(), PriorityAdmin)
+	cmd.Capture = &Capture{Deliver: func(lines []string) {
+		if len(lines) == 0 {
+			lines = []string{"(no output)"}
+		}
+		s.chatBridge.Reply(origin, strings.Join(lines, "\n"))
+	}}
+	s.queue.Push(cmd)
+	return true
+}
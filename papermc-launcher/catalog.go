@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// What caused a backup
+const (
+	TriggerSchedule = "schedule"
+	TriggerConsole  = "console"
+	TriggerUpdate   = "update"
+	// Taken before a risky operation like a rollback
+	TriggerSnapshot = "snapshot"
+)
+
+type BackupManifest struct {
+	Archive   string                 `json:"archive"`
+	Time      time.Time              `json:"time"`
+	Trigger   string                 `json:"trigger"`
+	Mode      BackupMode             `json:"mode"`
+	WorldSize int64                  `json:"world_size"`
+	Size      int64                  `json:"size"`
+	Duration  Duration               `json:"duration"`
+	Paper     VersionInfo            `json:"paper"`
+	Plugins   map[string]VersionInfo `json:"plugins,omitempty"`
+	Sha256    string                 `json:"sha256"`
+}
+
+func (m BackupManifest) String() string {
+	return fmt.Sprintf("%v %v (%v, %v) world %v MiB, archive %v MiB, paper %v #%v",
+		m.Time.Format("2006-01-02 15:04"), m.Archive, m.Trigger, m.Mode,
+		m.WorldSize>>20, m.Size>>20, m.Paper.Version, m.Paper.Build)
+}
+
+func catalogPath(workDir string) string {
+	return filepath.Clean(workDir) + "-backup-catalog.json"
+}
+
+// Size of the world directories (world, world_nether, ...) of the server
+func worldSize(workDir string) int64 {
+	var size int64
+	dirs, _ := filepath.Glob(filepath.Join(workDir, "world*"))
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+			return nil
+		})
+	}
+	return size
+}
+
+func LoadCatalog(workDir string) ([]BackupManifest, error) {
+	content, err := os.ReadFile(catalogPath(workDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var catalog []BackupManifest
+	if err := json.Unmarshal(content, &catalog); err != nil {
+		return nil, fmt.Errorf("error decoding backup catalog: %w", err)
+	}
+	return catalog, nil
+}
+
+func writeJSON(path string, v any) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RecordBackup writes the manifest next to the archive and appends it to the catalog
+func RecordBackup(workDir, archive, trigger string, mode BackupMode, started time.Time) (BackupManifest, error) {
+	manifest := BackupManifest{
+		Archive:   archive,
+		Time:      started,
+		Trigger:   trigger,
+		Mode:      mode,
+		WorldSize: worldSize(workDir),
+		Duration:  Duration(time.Since(started)),
+	}
+	if stat, err := os.Stat(archive); err == nil {
+		manifest.Size = stat.Size()
+	}
+	if info, err := LoadVersionsInfo(workDir); err == nil {
+		manifest.Paper = info.PaperVer
+		manifest.Plugins = info.Plugins
+	}
+	sum, err := fileChecksum(archive)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Sha256 = sum
+	if err := writeJSON(manifestPath(archive), manifest); err != nil {
+		return manifest, err
+	}
+	catalog, err := LoadCatalog(workDir)
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, writeJSON(catalogPath(workDir), append(catalog, manifest))
+}
+
+// Manifest stored next to the archive
+func manifestPath(archive string) string {
+	return strings.TrimSuffix(archive, ".tar.gz") + ".json"
+}
+
+// Compares the archive with the checksum recorded in its manifest, if there is one
+func checkManifest(archive string) error {
+	content, err := os.ReadFile(manifestPath(archive))
+	if err != nil {
+		return nil
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("error decoding manifest: %w", err)
+	}
+	sum, err := fileChecksum(archive)
+	if err != nil {
+		return err
+	}
+	if sum != manifest.Sha256 {
+		return fmt.Errorf("archive checksum %v does not match the manifest %v", sum, manifest.Sha256)
+	}
+	return nil
+}
+
+// Resolves a backup given either as a catalog index or a file name
+func ResolveBackup(workDir, arg string) (string, error) {
+	var index int
+	if _, err := fmt.Sscanf(arg, "%d", &index); err != nil || fmt.Sprint(index) != arg {
+		return arg, nil
+	}
+	catalog, err := LoadCatalog(workDir)
+	if err != nil {
+		return "", err
+	}
+	if index < 1 || index > len(catalog) {
+		return "", fmt.Errorf("no backup #%v in the catalog", index)
+	}
+	return catalog[index-1].Archive, nil
+}
+
+func (s *Server) printCatalog() {
+	catalog, err := LoadCatalog(s.Config().WorkDir)
+	if err != nil {
+		s.reply(fmt.Sprintf("Error reading backup catalog: %v", err))
+		return
+	}
+	if len(catalog) == 0 {
+		s.reply("No backups in the catalog")
+		return
+	}
+	for i, manifest := range catalog {
+		s.reply(fmt.Sprintf("#%v %v", i+1, manifest))
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// [12:34:56 INFO]: <Steve> hello
+var chatLineRegexp = regexp.MustCompile(`^\[\d\d:\d\d:\d\d INFO\]: (?:\[Not Secure\] )?<([^>\s]+)> (.*)$`)
+
+type ChatBridgeConfig struct {
+	Telegram *TelegramConfig `json:"telegram,omitempty"`
+	Discord  *DiscordConfig  `json:"discord,omitempty"`
+	// Users who may run operator commands with /cmd, the output is sent back. Display names
+	// can be changed by anybody, so users are given by id: telegram:<user id> or discord:<user id>.
+	Operators []string `json:"operators,omitempty"`
+	// Users who may also run admin commands and answer join requests, in the same format
+	Admins []string `json:"admins,omitempty"`
+}
+
+func (c ChatBridgeConfig) Validate() error {
+	for _, user := range slices.Concat(c.Operators, c.Admins) {
+		origin, id, _ := strings.Cut(user, ":")
+		if (origin != "telegram" && origin != "discord") || id == "" {
+			return fmt.Errorf("invalid user %q, expected telegram:<user id> or discord:<user id>", user)
+		}
+	}
+	return nil
+}
+
+// Role of the bridged chat user, false for users without one
+func (c ChatBridgeConfig) Role(origin string, author ChatAuthor) (Role, bool) {
+	if author.ID == "" {
+		return Viewer, false
+	}
+	user := origin + ":" + author.ID
+	switch {
+	case slices.Contains(c.Admins, user):
+		return Admin, true
+	case slices.Contains(c.Operators, user):
+		return Operator, true
+	}
+	return Viewer, false
+}
+
+// Sender of a bridged chat message
+type ChatAuthor struct {
+	// Display name, only shown to the players
+	Name string
+	// Telegram user id or Discord user snowflake
+	ID string
+}
+
+func (a ChatAuthor) String() string {
+	return fmt.Sprintf("%v (%v)", a.Name, a.ID)
+}
+
+func ParseChatLine(line string) (player, message string, ok bool) {
+	match := chatLineRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// Formats a message coming from outside of the game as a tellraw command
+func TellrawCommand(source, author, text string) string {
+	component, _ := json.Marshal([]map[string]string{
+		{"text": fmt.Sprintf("[%v] ", source), "color": "aqua"},
+		{"text": author + ": ", "color": "gray"},
+		{"text": text},
+	})
+	return fmt.Sprintf("tellraw @a %s", component)
+}
+
+// Players type this in chat to learn when the server closes
+const TIME_TRIGGER = "!time"
+
+// Answers the in-game chat commands of players
+func (s *Server) handleChatCommand(player, message string) {
+	if strings.TrimSpace(message) != TIME_TRIGGER {
+		return
+	}
+	text := s.msg(MsgNotClosing)
+	if closes, ok := s.Config().AccessSchedule.ClosingTime(time.Now()); ok {
+		left := time.Until(closes).Round(time.Minute)
+		text = s.msg(MsgTimeLeft, countdownString(left), closes.Format("15:04"))
+	}
+	s.queue.Push(ConsoleCommand(fmt.Sprintf("tell %v %v", player, text), OriginLauncher, PriorityChat))
+}
+
+type ChatBridge struct {
+	telegram *TelegramClient
+	discord  *DiscordClient
+}
+
+func (s *Server) StartChatBridge(ctx context.Context) {
+	cfg := s.Config().ChatBridge
+	relay := func(source, origin string) func(author ChatAuthor, text string) {
+		return func(author ChatAuthor, text string) {
+			if s.handleApprovalReply(origin, author, text) || s.handleChatBridgeCommand(origin, author, text) {
+				return
+			}
+			s.queue.Push(ConsoleCommand(TellrawCommand(source, author.Name, text), origin, PriorityChat))
+		}
+	}
+	if cfg.Telegram != nil {
+		s.chatBridge.telegram = &TelegramClient{Config: *cfg.Telegram}
+		go s.chatBridge.telegram.Poll(ctx, relay("TG", "telegram"))
+	}
+	if cfg.Discord != nil {
+		s.chatBridge.discord = &DiscordClient{Config: *cfg.Discord}
+		go s.chatBridge.discord.Poll(ctx, relay("Discord", "discord"))
+	}
+}
+
+// Forwards in-game chat to the configured channels
+func (b *ChatBridge) OnChat(player, message string) {
+	b.Broadcast(fmt.Sprintf("<%v> %v", player, message))
+}
+
+// Sends the text to the bridged chat the origin names, telegram or discord
+func (b *ChatBridge) Reply(origin, text string) {
+	switch {
+	case origin == "telegram" && b.telegram != nil:
+		go func() {
+			if err := b.telegram.Send(text); err != nil {
+				warnf("Failed to reply to telegram: %v", err)
+			}
+		}()
+	case origin == "discord" && b.discord != nil:
+		go func() {
+			if err := b.discord.Send(text); err != nil {
+				warnf("Failed to reply to discord: %v", err)
+			}
+		}()
+	}
+}
+
+// Sends the text to every bridged chat
+func (b *ChatBridge) Broadcast(text string) {
+	if b.telegram != nil {
+		go func() {
+			if err := b.telegram.Send(text); err != nil {
+				warnf("Failed to forward chat to telegram: %v", err)
+			}
+		}()
+	}
+	if b.discord != nil {
+		go func() {
+			if err := b.discord.Send(text); err != nil {
+				warnf("Failed to forward chat to discord: %v", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+)
+
+// holdOpen keeps the server open past the end of the day's interval while players are online,
+// if the interval is open until empty. Reports whether the close should wait.
+func (s *Server) holdOpen(online int, now time.Time) bool {
+	if !s.holdUntil.IsZero() {
+		return online > 0 && now.Before(s.holdUntil)
+	}
+	if online == 0 {
+		return false
+	}
+	interval, ok := s.Config().AccessSchedule.Interval(now)
+	if !ok || interval.UntilEmpty <= 0 {
+		return false
+	}
+	limit := time.Duration(interval.UntilEmpty)
+	s.holdUntil = now.Add(limit)
+	s.holdingOpen.Store(true)
+	s.say(s.runningCtx, s.msg(MsgOpenUntilEmpty, countdownString(limit)))
+	s.Notify(EventCloseDelayed, s.msg(MsgHeldOpen, limit, online), "")
+	s.holdTimer = time.AfterFunc(limit, func() {
+		s.queue.Push(InnerCommand(CloseAccess, OriginSchedule))
+	})
+	return true
+}
+
+// Forgets the hold once the server closes
+func (s *Server) releaseHold() {
+	if s.holdTimer != nil {
+		s.holdTimer.Stop()
+		s.holdTimer = nil
+	}
+	s.holdUntil = time.Time{}
+	s.holdingOpen.Store(false)
+}
+
+// Closes the held open server once the last player leaves
+func (s *Server) closeIfEmpty() {
+	if s.holdingOpen.Load() && len(s.sessions.Online()) == 0 {
+		s.holdingOpen.Store(false)
+		s.queue.Push(InnerCommand(CloseAccess, OriginSchedule))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const MODRINTH_VERSIONS_URL_TEMPLATE = "https://api.modrinth.com/v2/project/%v/version?loaders=%v"
+const HANGAR_VERSIONS_URL_TEMPLATE = "https://hangar.papermc.io/api/v1/projects/%v/versions?limit=25&platform=PAPER"
+
+// Where the Minecraft versions supported by a plugin are looked up
+type PluginCompatibility struct {
+	Name string `json:"name"`
+	// Project slug on Modrinth
+	Modrinth string `json:"modrinth,omitempty"`
+	// Project on Hangar, owner/name
+	Hangar string `json:"hangar,omitempty"`
+	// A critical plugin without a compatible build blocks a major paper upgrade
+	Critical bool `json:"critical,omitempty"`
+}
+
+// Geyser is always installed, bedrock players can not join without it
+var defaultCompatibility = []PluginCompatibility{
+	{Name: "geyser", Modrinth: "geyser", Critical: true},
+}
+
+func CompatibilityEntries(plugins []PluginCompatibility) []PluginCompatibility {
+	if plugins == nil {
+		return defaultCompatibility
+	}
+	return plugins
+}
+
+func (p PluginCompatibility) Validate() error {
+	if p.Name == "" {
+		return errors.New("plugin without name")
+	}
+	if (p.Modrinth == "") == (p.Hangar == "") {
+		return fmt.Errorf("plugin %v needs either modrinth or hangar", p.Name)
+	}
+	return nil
+}
+
+// SupportedVersions lists the Minecraft versions the plugin has builds for.
+// Hangar reports ranges like 1.20-1.20.6, they are kept as is.
+func (p PluginCompatibility) SupportedVersions(flavor ServerFlavor) ([]string, error) {
+	var supported []string
+	if p.Modrinth != "" {
+		var versions []struct {
+			GameVersions []string `json:"game_versions"`
+		}
+		loaders := url.QueryEscape(flavor.loaders())
+		if err := getJSON(fmt.Sprintf(MODRINTH_VERSIONS_URL_TEMPLATE, url.PathEscape(p.Modrinth), loaders), &versions); err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			supported = append(supported, version.GameVersions...)
+		}
+	} else {
+		var versions struct {
+			Result []struct {
+				PlatformDependencies map[string][]string `json:"platformDependencies"`
+			} `json:"result"`
+		}
+		if err := getJSON(fmt.Sprintf(HANGAR_VERSIONS_URL_TEMPLATE, p.Hangar), &versions); err != nil {
+			return nil, err
+		}
+		for _, version := range versions.Result {
+			supported = append(supported, version.PlatformDependencies["PAPER"]...)
+		}
+	}
+	slices.Sort(supported)
+	return slices.Compact(supported), nil
+}
+
+// compareVersions compares dotted versions numerically: 1.9 < 1.21
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// MajorVersion of a Minecraft version, 1.21 for 1.21.4
+func MajorVersion(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// Supports checks the version against the supported versions and ranges
+func Supports(supported []string, version string) bool {
+	for _, entry := range supported {
+		low, high, isRange := strings.Cut(entry, "-")
+		if !isRange && entry == version {
+			return true
+		}
+		if isRange && compareVersions(low, version) <= 0 && compareVersions(version, high) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// UpgradeBlockers lists the critical plugins without a build for the version
+func UpgradeBlockers(plugins []PluginCompatibility, flavor ServerFlavor, version string) []string {
+	var blockers []string
+	for _, plugin := range CompatibilityEntries(plugins) {
+		if !plugin.Critical {
+			continue
+		}
+		supported, err := plugin.SupportedVersions(flavor)
+		if err != nil {
+			blockers = append(blockers, fmt.Sprintf("%v (lookup failed: %v)", plugin.Name, err))
+		} else if !Supports(supported, version) {
+			blockers = append(blockers, plugin.Name)
+		}
+	}
+	return blockers
+}
+
+// Prints which plugins have builds for the versions
+func (s *Server) printCompatibility(versions []string) {
+	s.reply(fmt.Sprintf("Minecraft versions: %v", strings.Join(versions, ", ")))
+	for _, plugin := range CompatibilityEntries(s.Config().Compatibility) {
+		supported, err := plugin.SupportedVersions(s.Config().ServerFlavor)
+		if err != nil {
+			s.reply(fmt.Sprintf("%v: lookup failed: %v", plugin.Name, err))
+			continue
+		}
+		marks := make([]string, len(versions))
+		for i, version := range versions {
+			marks[i] = "no"
+			if Supports(supported, version) {
+				marks[i] = "yes"
+			}
+		}
+		critical := ""
+		if plugin.Critical {
+			critical = " (critical)"
+		}
+		s.reply(fmt.Sprintf("%v%v: %v", plugin.Name, critical, strings.Join(marks, ", ")))
+	}
+}
+
+// The installed version and the one to compare with, the latest paper version by default
+func (s *Server) compatVersions(target string) []string {
+	var versions []string
+	if info, err := LoadVersionsInfo(s.Config().WorkDir); err == nil && info.PaperVer.Version != "" {
+		versions = append(versions, info.PaperVer.Version)
+	}
+	if target == "" {
+		var paper PaperVersions
+		if err := getJSON(fmt.Sprintf(PAPER_API_PROJECT_URL_TEMPLATE, s.Config().ServerFlavor.Project()), &paper); err == nil && len(paper.Versions) > 0 {
+			target = paper.Versions[len(paper.Versions)-1]
+		}
+	}
+	if target != "" && !slices.Contains(versions, target) {
+		versions = append(versions, target)
+	}
+	return versions
+}
+
+// Newest version of the major, current if there is none
+func latestInMajor(versions []string, current string) string {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if MajorVersion(versions[i]) == MajorVersion(current) {
+			return versions[i]
+		}
+	}
+	return current
+}
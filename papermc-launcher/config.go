@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -65,9 +68,79 @@ func (d DayTime) Duration() time.Duration {
 	return time.Hour*time.Duration(d.hours) + time.Minute*time.Duration(d.minutes)
 }
 
+// On returns the wall clock time on the day of t in its location. Unlike adding Duration
+// to midnight this stays right on DST change days, a time skipped by the change moves forward.
+func (d DayTime) On(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), d.hours, d.minutes, 0, 0, t.Location())
+}
+
+func (d DayTime) Validate() error {
+	if d.hours < 0 || d.minutes < 0 || d.minutes > 59 || d.Duration() > 24*time.Hour {
+		return fmt.Errorf("invalid time %02d:%02d", d.hours, d.minutes)
+	}
+	return nil
+}
+
 type TimeInterval struct {
 	Start DayTime `json:"start"`
 	End   DayTime `json:"end"`
+	// Instead of closing at End, stay open until the last player leaves, at most this long
+	UntilEmpty Duration `json:"until_empty,omitempty"`
+	// Replaces the global warn_before on this day
+	WarnBefore []Duration `json:"warn_before,omitempty"`
+}
+
+// Warnings returns the warn offsets of the day, the global ones unless overridden
+func (t TimeInterval) Warnings(global []Duration) []Duration {
+	if t.WarnBefore != nil {
+		return t.WarnBefore
+	}
+	return global
+}
+
+func (t TimeInterval) Validate() error {
+	if err := t.Start.Validate(); err != nil {
+		return err
+	}
+	if err := t.End.Validate(); err != nil {
+		return err
+	}
+	if t.UntilEmpty < 0 {
+		return errors.New("until_empty should not be negative")
+	}
+	for _, d := range t.WarnBefore {
+		if d <= 0 {
+			return fmt.Errorf("warn_before offsets should be positive, got %v", time.Duration(d))
+		}
+	}
+	if t.End.Duration() <= t.Start.Duration() {
+		return fmt.Errorf("interval end %02d:%02d is not after start %02d:%02d", t.End.hours, t.End.minutes, t.Start.hours, t.Start.minutes)
+	}
+	return nil
+}
+
+type Regexp struct {
+	*regexp.Regexp
+}
+
+func (r Regexp) MarshalJSON() ([]byte, error) {
+	if r.Regexp == nil {
+		return json.Marshal("")
+	}
+	return json.Marshal(r.String())
+}
+
+func (r *Regexp) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return fmt.Errorf("regexp should be a string")
+	}
+	tmp, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	r.Regexp = tmp
+	return nil
 }
 
 type Location time.Location
@@ -98,7 +171,7 @@ func (l *Location) UnmarshalJSON(b []byte) error {
 type Weekday time.Weekday
 
 func (d Weekday) MarshalText() ([]byte, error) {
-	return json.Marshal(time.Weekday(d).String())
+	return []byte(time.Weekday(d).String()), nil
 }
 
 func (d *Weekday) UnmarshalText(b []byte) error {
@@ -134,6 +207,13 @@ type Schedule struct {
 	DaysSchedule map[Weekday]TimeInterval `json:"days_schedule"`
 }
 
+// Interval returns the access interval of the day t falls on
+func (sch Schedule) Interval(t time.Time) (TimeInterval, bool) {
+	loc := time.Location(sch.Timezone)
+	interval, ok := sch.DaysSchedule[Weekday(t.In(&loc).Weekday())]
+	return interval, ok
+}
+
 type PlayerType int
 
 const (
@@ -179,28 +259,313 @@ func (pt *PlayerType) UnmarshalJSON(b []byte) error {
 type Player struct {
 	Type     PlayerType `json:"type"`
 	Nickname string     `json:"nickname"`
+	Op       bool       `json:"op,omitempty"`
+}
+
+// Name of the player as seen by the server (floodgate prefixes bedrock players with a dot)
+func (p Player) ServerName() string {
+	if p.Type == Bedrock {
+		return "." + p.Nickname
+	}
+	return p.Nickname
 }
 
 type Config struct {
-	WorkDir        string     `json:"work_dir"`
-	WarnBefore     []Duration `json:"warn_before"`
-	AccessSchedule Schedule   `json:"schedule"`
-	Memory         string     `json:"memory"`
-	Players        []Player   `json:"players"`
+	WorkDir        string               `json:"work_dir"`
+	WarnBefore     []Duration           `json:"warn_before"`
+	AccessSchedule Schedule             `json:"schedule"`
+	Memory         string               `json:"memory"`
+	Players        []Player             `json:"players"`
+	RemoteConsole  *RemoteConsoleConfig `json:"remote_console,omitempty"`
+	Users          []User               `json:"users,omitempty"`
+	Notifications  NotificationsConfig  `json:"notifications"`
+	LogFilters     []LogFilter          `json:"log_filters,omitempty"`
+	HistoryLines   int                  `json:"history_lines,omitempty"`
+	ChatBridge     ChatBridgeConfig     `json:"chat_bridge"`
+	Profiling      ProfilingConfig      `json:"profiling"`
+	TpsAlert       *TpsAlertConfig      `json:"tps_alert,omitempty"`
+	Backup         BackupConfig         `json:"backup"`
+	Limits         ResourceLimits       `json:"limits"`
+	GcMonitor      GcMonitorConfig      `json:"gc_monitor"`
+	Healthchecks   HealthchecksConfig   `json:"healthchecks"`
+	Geyser         GeyserConfig         `json:"geyser"`
+	PortMapping    PortMappingConfig    `json:"port_mapping"`
+	DynDns         *DynDnsConfig        `json:"dyndns,omitempty"`
+	Announcements  []Announcement       `json:"announcements,omitempty"`
+	Whitelist      WhitelistConfig      `json:"whitelist"`
+	// How long the update waits for players to log out after the countdown
+	UpdateWait Duration `json:"update_wait,omitempty"`
+	// Offline mode for LAN parties without internet
+	LanMode   bool       `json:"lan_mode,omitempty"`
+	Datapacks []Datapack `json:"datapacks,omitempty"`
+	// Resource and behavior packs for Bedrock players, .zip or .mcpack
+	BedrockPacks []Datapack `json:"bedrock_packs,omitempty"`
+	// Served by the remote console HTTP server
+	ResourcePack *ResourcePackConfig `json:"resource_pack,omitempty"`
+	Java         JavaConfig          `json:"java"`
+	// Downloads shared between instances, "none" disables the cache
+	CacheDir string `json:"cache_dir,omitempty"`
+	// Delay of the scheduled close while players are online
+	CloseGrace Duration `json:"close_grace,omitempty"`
+	// Stop the java process outside the open hours
+	Sleep *SleepConfig `json:"sleep,omitempty"`
+	// Language of the in-game messages and notifications, en or ru
+	Language string `json:"language,omitempty"`
+	// Export of the player statistics, also served at /stats by the remote console
+	Stats *StatsConfig `json:"stats,omitempty"`
+	// Blocks the Bedrock port while the server is closed
+	Firewall *FirewallConfig `json:"firewall,omitempty"`
+	// Approval of unknown players through the chat bridge
+	JoinApproval *JoinApprovalConfig `json:"join_approval,omitempty"`
+	// paper or folia, which project is downloaded and run as paper.jar
+	ServerFlavor ServerFlavor `json:"server_flavor,omitempty"`
+	// Plugins checked before a major paper upgrade, geyser by default
+	Compatibility []PluginCompatibility `json:"compatibility,omitempty"`
+	// No in-game broadcasts during these hours
+	QuietHours *QuietHours `json:"quiet_hours,omitempty"`
+	// Notifies when the disk with the server runs low
+	DiskAlert *DiskAlertConfig `json:"disk_alert,omitempty"`
+	// View and simulation distance by the number of players online
+	DistanceTuning *DistanceTuningConfig `json:"distance_tuning,omitempty"`
+	// Weekly window for installing new paper builds and geyser patch releases unattended
+	AutoUpdate *AutoUpdateConfig `json:"auto_update,omitempty"`
+	// Alerts and actions on log lines that look like griefing
+	AntiGrief *AntiGriefConfig `json:"anti_grief,omitempty"`
+}
+
+// How the server process is launched
+type JavaConfig struct {
+	// Java executable, "java" from PATH by default
+	Path string `json:"path,omitempty"`
+	// Extra JVM options, placed before -jar
+	JvmArgs []string `json:"jvm_args,omitempty"`
+	// Extra server options, placed after nogui
+	ServerArgs []string `json:"server_args,omitempty"`
+	// Added to the launcher's environment
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Paths in the config are relative to the config file, not to the working directory
+func resolvePath(base, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+var memoryRegexp = regexp.MustCompile(`^[0-9]+[KkMmGg]?$`)
+
+func (c Config) Validate() error {
+	if c.WorkDir == "" {
+		return errors.New("work_dir is not set")
+	}
+	if !memoryRegexp.MatchString(c.Memory) {
+		return fmt.Errorf("invalid memory value %q", c.Memory)
+	}
+	for _, d := range c.WarnBefore {
+		if d <= 0 {
+			return fmt.Errorf("warn_before offsets should be positive, got %v", time.Duration(d))
+		}
+	}
+	for day, interval := range c.AccessSchedule.DaysSchedule {
+		if err := interval.Validate(); err != nil {
+			return fmt.Errorf("schedule for %v: %w", time.Weekday(day), err)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, player := range c.Players {
+		if player.Nickname == "" {
+			return errors.New("player with empty nickname")
+		}
+		if seen[player.ServerName()] {
+			return fmt.Errorf("duplicate player %v", player.Nickname)
+		}
+		seen[player.ServerName()] = true
+	}
+	for _, filter := range c.LogFilters {
+		if filter.Pattern.Regexp == nil {
+			return errors.New("log filter without pattern")
+		}
+		if filter.Action != FilterHide && filter.Action != FilterSummarize {
+			return fmt.Errorf("invalid log filter action %q", filter.Action)
+		}
+	}
+	if err := c.Limits.Validate(); err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
+	if err := c.Backup.Validate(); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	packs := make(map[string]bool)
+	for _, pack := range c.Datapacks {
+		if err := pack.Validate(); err != nil {
+			return err
+		}
+		if packs[pack.Name] {
+			return fmt.Errorf("duplicate datapack %v", pack.Name)
+		}
+		packs[pack.Name] = true
+	}
+	bedrockPacks := make(map[string]bool)
+	for _, pack := range c.BedrockPacks {
+		if err := pack.Validate(); err != nil {
+			return fmt.Errorf("bedrock_packs: %w", err)
+		}
+		if bedrockPacks[pack.Name] {
+			return fmt.Errorf("duplicate bedrock pack %v", pack.Name)
+		}
+		bedrockPacks[pack.Name] = true
+	}
+	if c.ResourcePack != nil {
+		if err := c.ResourcePack.Validate(); err != nil {
+			return fmt.Errorf("resource_pack: %w", err)
+		}
+		if c.RemoteConsole == nil {
+			return errors.New("resource_pack is served by remote_console, which is not configured")
+		}
+	}
+	if c.RemoteConsole != nil {
+		if err := c.RemoteConsole.Validate(); err != nil {
+			return fmt.Errorf("remote_console: %w", err)
+		}
+	}
+	if err := validateLanguage(c.Language); err != nil {
+		return err
+	}
+	if c.LanMode && c.PortMapping.Enabled {
+		return errors.New("lan_mode can not be combined with port_mapping")
+	}
+	if err := c.validateRoutes(); err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+	for i, announcement := range c.Announcements {
+		if err := announcement.Validate(); err != nil {
+			return fmt.Errorf("announcement %v: %w", i+1, err)
+		}
+	}
+	if err := c.ChatBridge.Validate(); err != nil {
+		return fmt.Errorf("chat_bridge: %w", err)
+	}
+	if c.JoinApproval != nil {
+		if err := c.JoinApproval.Validate(c.ChatBridge); err != nil {
+			return fmt.Errorf("join_approval: %w", err)
+		}
+	}
+	if err := c.ServerFlavor.Validate(); err != nil {
+		return fmt.Errorf("server_flavor: %w", err)
+	}
+	for _, plugin := range c.Compatibility {
+		if err := plugin.Validate(); err != nil {
+			return fmt.Errorf("compatibility: %w", err)
+		}
+	}
+	if c.Firewall != nil {
+		if err := c.Firewall.Validate(); err != nil {
+			return fmt.Errorf("firewall: %w", err)
+		}
+	}
+	if c.DiskAlert != nil {
+		if err := c.DiskAlert.Validate(); err != nil {
+			return fmt.Errorf("disk_alert: %w", err)
+		}
+	}
+	if c.DistanceTuning != nil {
+		if err := c.DistanceTuning.Validate(); err != nil {
+			return fmt.Errorf("distance_tuning: %w", err)
+		}
+	}
+	if c.AutoUpdate != nil {
+		if err := c.AutoUpdate.Validate(); err != nil {
+			return fmt.Errorf("auto_update: %w", err)
+		}
+	}
+	if c.QuietHours != nil {
+		if err := c.QuietHours.Validate(); err != nil {
+			return fmt.Errorf("quiet_hours: %w", err)
+		}
+	}
+	if c.AntiGrief != nil {
+		if err := c.AntiGrief.Validate(); err != nil {
+			return fmt.Errorf("anti_grief: %w", err)
+		}
+	}
+	if c.Stats != nil {
+		if err := c.Stats.Validate(); err != nil {
+			return fmt.Errorf("stats: %w", err)
+		}
+	}
+	if c.DynDns != nil {
+		if err := c.DynDns.Validate(); err != nil {
+			return fmt.Errorf("dyndns: %w", err)
+		}
+	}
+	tokens := make(map[string]bool)
+	for _, user := range c.Users {
+		if user.Name == "" || user.Token == "" {
+			return errors.New("users should have a name and a token")
+		}
+		if tokens[user.Token] {
+			return fmt.Errorf("user %v reuses a token", user.Name)
+		}
+		tokens[user.Token] = true
+	}
+	return nil
+}
+
+// AddPlayerToConfig appends the player to the players list of the config file. The rest of
+// the file, comments and keys the launcher does not know included, is left as written.
+func AddPlayerToConfig(filename string, player Player) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	entry, err := json.Marshal(player)
+	if err != nil {
+		return err
+	}
+	if isYamlConfig(filename) {
+		content, err = appendYamlPlayer(content, entry)
+	} else {
+		content, err = appendJSONPlayer(content, entry)
+	}
+	if err != nil {
+		return fmt.Errorf("error adding player to config: %w", err)
+	}
+	return replaceFile(filename, content)
 }
 
 func LoadConfig(filename string) (Config, error) {
-	file, err := os.Open(filename)
+	content, err := readConfigFile(filename)
 	if err != nil {
 		return Config{}, fmt.Errorf("error opening config file: %w", err)
 	}
-	defer file.Close()
 
 	var config Config
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
+	if err := json.Unmarshal(content, &config); err != nil {
 		return Config{}, fmt.Errorf("error decoding config: %w", err)
 	}
+	base := filepath.Dir(filename)
+	config.WorkDir = resolvePath(base, config.WorkDir)
+	// A bare executable name is looked up in PATH
+	if strings.ContainsAny(config.Java.Path, `/\`) {
+		config.Java.Path = resolvePath(base, config.Java.Path)
+	}
+	if config.CacheDir != "none" {
+		config.CacheDir = resolvePath(base, config.CacheDir)
+	}
+	if config.ResourcePack != nil {
+		config.ResourcePack.File = resolvePath(base, config.ResourcePack.File)
+	}
+	if config.Stats != nil {
+		config.Stats.Output = resolvePath(base, config.Stats.Output)
+	}
+	if config.RemoteConsole != nil {
+		config.RemoteConsole.CertFile = resolvePath(base, config.RemoteConsole.CertFile)
+		config.RemoteConsole.KeyFile = resolvePath(base, config.RemoteConsole.KeyFile)
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
 
 	return config, nil
 }
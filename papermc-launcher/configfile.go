@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A config named *.yaml or *.yml is written in YAML with the same keys as the JSON one
+func isYamlConfig(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readConfigFile returns the config as JSON. YAML is converted, so the JSON decoding
+// of Duration, DayTime, Location and Weekday applies to both formats.
+func readConfigFile(filename string) ([]byte, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !isYamlConfig(filename) {
+		return content, nil
+	}
+	var document any
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// writeConfigFile writes the config as JSON or YAML depending on the file name
+func writeConfigFile(filename string, config Config) error {
+	if !isYamlConfig(filename) {
+		return writeJSON(filename, config)
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	// JSON is YAML in flow style, going through a node keeps the field order
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return err
+	}
+	blockStyle(&document)
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	return replaceFile(filename, out.Bytes())
+}
+
+// Writes the content next to the file and renames it over, readers never see half of it
+func replaceFile(filename string, content []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// Appends the JSON encoded player to the players sequence of the YAML document, comments are kept
+func appendYamlPlayer(content, player []byte) ([]byte, error) {
+	var document, entry yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(player, &entry); err != nil {
+		return nil, err
+	}
+	blockStyle(&entry)
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("config is not a mapping")
+	}
+	root := document.Content[0]
+	var players *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "players" {
+			players = root.Content[i+1]
+		}
+	}
+	if players == nil {
+		players = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "players"}, players)
+	}
+	if players.Kind != yaml.SequenceNode {
+		return nil, errors.New("players is not a list")
+	}
+	// players: [] would keep the new entry on the same line
+	if len(players.Content) == 0 {
+		players.Style &^= yaml.FlowStyle
+	}
+	players.Content = append(players.Content, entry.Content[0])
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Inserts the player at the end of the players array of the JSON document, the rest of the text is kept
+func appendJSONPlayer(content, player []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("config is not an object")
+	}
+	keys := false
+	for decoder.More() {
+		keys = true
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "players" {
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return nil, errors.New("players is not a list")
+		}
+		empty := !decoder.More()
+		for decoder.More() {
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return insertBeforeClosing(content, int(decoder.InputOffset())-1, player, empty), nil
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	entry := fmt.Appendf(nil, `"players": [%s]`, player)
+	return insertBeforeClosing(content, int(decoder.InputOffset())-1, entry, !keys), nil
+}
+
+// Inserts the entry before the bracket at pos, on its own line when the brackets are on separate lines
+func insertBeforeClosing(content []byte, pos int, entry []byte, first bool) []byte {
+	end := pos
+	for pos > 0 && strings.ContainsRune(" \t\r\n", rune(content[pos-1])) {
+		pos--
+	}
+	separator := " "
+	if newline := bytes.LastIndexByte(content[pos:end], '\n'); newline >= 0 {
+		separator = "\n" + string(content[pos+newline+1:end]) + "  "
+	}
+	if !first {
+		separator = "," + separator
+	} else if separator == " " {
+		separator = ""
+	}
+	return slices.Concat(content[:pos], []byte(separator), entry, content[pos:])
+}
+
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
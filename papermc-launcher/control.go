@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const COMMAND_PATH = "/command"
+
+const OriginSocket = "socket"
+
+// How long `cmd` waits for more output after the last line
+const DEFAULT_COMMAND_WAIT = 3 * time.Second
+
+// Queues the posted command and answers with its captured output, the idle query
+// parameter sets how long the capture waits for more lines.
+// The socket is only reachable by the launcher's user, who is an admin.
+func (s *Server) serveCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST the command", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input := strings.TrimSpace(string(body))
+	if input == "" {
+		http.Error(w, "empty command", http.StatusBadRequest)
+		return
+	}
+	var idle time.Duration
+	if value := r.URL.Query().Get("idle"); value != "" {
+		if idle, err = time.ParseDuration(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	infof("[Socket]: %v", input)
+	lines, err := s.runCaptured(r.Context(), input, OriginSocket, idle)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Queues the command as an admin and waits for its captured output
+func (s *Server) runCaptured(ctx context.Context, input, origin string, idle time.Duration) ([]string, error) {
+	output := make(chan []string, 1)
+	cmd := ConsoleCommand(input, origin, PriorityAdmin)
+	cmd.Capture = &Capture{Idle: idle, Deliver: func(lines []string) { output <- lines }}
+	s.queue.Push(cmd)
+	select {
+	case lines := <-output:
+		return lines, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RunCommand sends a command to the launcher running with the config and prints the output
+// that follows it until the output has been quiet for the wait time
+func RunCommand(configPath string, args []string) error {
+	flags := flag.NewFlagSet("cmd", flag.ContinueOnError)
+	wait := flags.Duration("wait", DEFAULT_COMMAND_WAIT, "stop collecting the output after this long without new lines")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	input := strings.Join(flags.Args(), " ")
+	if input == "" {
+		return errors.New("usage: cmd [-wait duration] <command>")
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	client := socketClient(config.WorkDir)
+	client.Timeout = CAPTURE_MAX_WINDOW + 10*time.Second
+	url := fmt.Sprintf("http://launcher%v?idle=%v", COMMAND_PATH, *wait)
+	response, err := client.Post(url, "text/plain", strings.NewReader(input))
+	if err != nil {
+		return fmt.Errorf("launcher is not running in %v: %w", config.WorkDir, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("command rejected: %v", strings.TrimSpace(string(message)))
+	}
+	_, err = io.Copy(os.Stdout, response.Body)
+	return err
+}
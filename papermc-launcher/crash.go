@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type CrashReport struct {
+	Path      string
+	Exception string
+	Plugin    string
+	// Problematic native frame of a JVM crash
+	Frame string
+}
+
+func (c CrashReport) Summary() string {
+	summary := c.Exception
+	if c.Plugin != "" {
+		summary += fmt.Sprintf(" (suspected plugin: %v)", c.Plugin)
+	}
+	if c.Frame != "" {
+		summary += fmt.Sprintf(" (problematic frame: %v)", c.Frame)
+	}
+	return summary
+}
+
+// FindCrashReport returns the newest crash report or JVM error log written after since
+func FindCrashReport(dir string, since time.Time) (string, error) {
+	candidates, err := filepath.Glob(filepath.Join(dir, "crash-reports", "*.txt"))
+	if err != nil {
+		return "", err
+	}
+	hsErrs, err := filepath.Glob(filepath.Join(dir, "hs_err_pid*.log"))
+	if err != nil {
+		return "", err
+	}
+	candidates = append(candidates, hsErrs...)
+	var newest string
+	var newestTime time.Time
+	for _, candidate := range candidates {
+		stat, err := os.Stat(candidate)
+		if err != nil {
+			continue
+		}
+		if stat.ModTime().After(since) && stat.ModTime().After(newestTime) {
+			newest = candidate
+			newestTime = stat.ModTime()
+		}
+	}
+	if newest == "" {
+		return "", os.ErrNotExist
+	}
+	return newest, nil
+}
+
+func ParseCrashReport(path string) (CrashReport, error) {
+	report := CrashReport{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var description string
+	expectFrame := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Description:"):
+			description = strings.TrimSpace(strings.TrimPrefix(line, "Description:"))
+		case report.Exception == "" && description != "" && strings.Contains(line, "Exception"):
+			report.Exception = line
+		case strings.HasPrefix(line, "Suspected Plugin"):
+			_, plugin, _ := strings.Cut(line, ":")
+			report.Plugin = strings.TrimSpace(plugin)
+		// hs_err_pid files
+		case strings.HasPrefix(line, "#  SIGSEGV") || strings.HasPrefix(line, "#  EXCEPTION_") || strings.HasPrefix(line, "#  Internal Error"):
+			report.Exception = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		case strings.HasPrefix(line, "# Problematic frame:"):
+			expectFrame = true
+		case expectFrame:
+			report.Frame = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			expectFrame = false
+		}
+	}
+	if report.Exception == "" {
+		report.Exception = description
+	}
+	return report, scanner.Err()
+}
+
+// ArchiveCrashReport copies the report next to the work dir prefixed with the crash timestamp
+func ArchiveCrashReport(workDir, path string, at time.Time) (string, error) {
+	archiveDir := workDir + "-crashes"
+	if err := os.MkdirAll(archiveDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	archived := filepath.Join(archiveDir, fmt.Sprintf("%v-%v", at.Format("2006-01-02_15-04-05"), filepath.Base(path)))
+	return archived, os.WriteFile(archived, content, 0644)
+}
+
+// Crashes within this window count towards a crash loop
+const CRASH_LOOP_WINDOW = time.Hour
+
+const CRASH_LOOP_COUNT = 3
+
+// Times of the crashes, one per line, kept with the archived reports
+const CRASH_TIMES_FILE = "crash-times.txt"
+
+// RecordCrash remembers the crash time and returns how many crashes happened within CRASH_LOOP_WINDOW
+func RecordCrash(workDir string, at time.Time) (int, error) {
+	archiveDir := workDir + "-crashes"
+	if err := os.MkdirAll(archiveDir, os.ModePerm); err != nil {
+		return 0, err
+	}
+	path := filepath.Join(archiveDir, CRASH_TIMES_FILE)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	_, err = fmt.Fprintln(f, at.Format(time.RFC3339))
+	f.Close()
+	if err != nil {
+		return 0, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	recent := 0
+	for _, line := range strings.Fields(string(content)) {
+		if t, err := time.Parse(time.RFC3339, line); err == nil && at.Sub(t) < CRASH_LOOP_WINDOW {
+			recent++
+		}
+	}
+	return recent, nil
+}
+
+// Error the launcher exits with after a crash, ErrCrashLoop when the server crashes repeatedly
+func (s *Server) crashError() error {
+	recent, err := RecordCrash(s.Config().WorkDir, time.Now())
+	if err != nil {
+		warnf("Failed to record the crash: %v", err)
+	}
+	if recent >= CRASH_LOOP_COUNT {
+		s.Notify(EventCrashLoop, s.msg(MsgCrashLoop, recent, CRASH_LOOP_WINDOW), "")
+		return fmt.Errorf("%w: %v crashes within %v", ErrCrashLoop, recent, CRASH_LOOP_WINDOW)
+	}
+	return ErrCrash
+}
+
+func (s *Server) HandleCrash() {
+	now := time.Now()
+	path, err := FindCrashReport(s.Config().WorkDir, s.startedAt)
+	if errors.Is(err, os.ErrNotExist) {
+		s.Notify(EventCrash, s.msg(MsgExitedNoReport), "")
+		return
+	}
+	if err != nil {
+		s.Notify(EventCrash, s.msg(MsgExited), fmt.Sprintf("Error looking for crash report: %v", err))
+		return
+	}
+	report, err := ParseCrashReport(path)
+	if err != nil {
+		warnf("Failed to parse crash report %v: %v", path, err)
+	}
+	archived, err := ArchiveCrashReport(s.Config().WorkDir, path, now)
+	if err != nil {
+		warnf("Failed to archive crash report %v: %v", path, err)
+		archived = path
+	}
+	s.Notify(EventCrash, s.msg(MsgCrashed, report.Summary()), "Crash report: "+archived)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const DEFAULT_LEVEL_NAME = "world"
+
+var datapackNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Datapack downloaded into the world's datapacks folder as <name>.zip
+type Datapack struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Sha256 string `json:"sha256"`
+	// Recorded in version.json, the checksum prefix is used when empty
+	Version string `json:"version,omitempty"`
+}
+
+func (d Datapack) Validate() error {
+	if !datapackNameRegexp.MatchString(d.Name) {
+		return fmt.Errorf("invalid datapack name %q", d.Name)
+	}
+	if d.URL == "" || d.Sha256 == "" {
+		return fmt.Errorf("datapack %v needs url and sha256", d.Name)
+	}
+	return nil
+}
+
+func (d Datapack) version() string {
+	if d.Version != "" {
+		return d.Version
+	}
+	return d.Sha256[:min(12, len(d.Sha256))]
+}
+
+func (d Datapack) fileName() string {
+	return d.Name + ".zip"
+}
+
+// LevelDir is the folder of the main world, named by level-name in server.properties
+func LevelDir(dir string) string {
+	level := DEFAULT_LEVEL_NAME
+	if props, err := ReadServerProperties(dir); err == nil && props["level-name"] != "" {
+		level = props["level-name"]
+	}
+	return filepath.Join(dir, level)
+}
+
+// LoadDatapacks downloads new and changed datapacks and removes the ones no longer configured
+func LoadDatapacks(dir string, packs []Datapack) error {
+	installed := func(info *VersionsInfo) *map[string]VersionInfo { return &info.Datapacks }
+	return loadPacks(dir, "datapack", filepath.Join(LevelDir(dir), "datapacks"), packs, installed)
+}
+
+// LoadBedrockPacks keeps Geyser's packs folder in sync with the configured resource and behavior packs
+func LoadBedrockPacks(dir string, packs []Datapack) error {
+	installed := func(info *VersionsInfo) *map[string]VersionInfo { return &info.BedrockPacks }
+	return loadPacks(dir, "bedrock pack", filepath.Join(dir, GEYSER_PACKS_DIR), packs, installed)
+}
+
+// Downloads the packs into packsDir, recording them in the map of version.json selected by installed
+func loadPacks(dir, kind, packsDir string, packs []Datapack, installed func(*VersionsInfo) *map[string]VersionInfo) error {
+	unlock, err := LockVersionsInfo(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	info, err := LoadVersionsInfo(dir)
+	if err != nil {
+		warnf("Failed to read versions info from %v", VERSIONS_FILE)
+	}
+	versions := installed(&info)
+	if len(packs) == 0 && len(*versions) == 0 {
+		return nil
+	}
+	if *versions == nil {
+		*versions = make(map[string]VersionInfo)
+	}
+	if err := os.MkdirAll(packsDir, os.ModePerm); err != nil {
+		return err
+	}
+	configured := make(map[string]bool)
+	var errs []error
+	for _, pack := range packs {
+		configured[pack.Name] = true
+		path := filepath.Join(packsDir, pack.fileName())
+		if installed, ok := (*versions)[pack.Name]; ok && installed.Version == pack.version() {
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+		}
+		infof("Downloading %v %v version %v", kind, pack.Name, pack.version())
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		if err := LoadFileIfDoesNotExist(pack.URL, packsDir, pack.fileName(), pack.Sha256); err != nil {
+			os.Remove(path)
+			errs = append(errs, fmt.Errorf("%v %v: %w", kind, pack.Name, err))
+			continue
+		}
+		(*versions)[pack.Name] = VersionInfo{Version: pack.version()}
+	}
+	for name := range *versions {
+		if configured[name] {
+			continue
+		}
+		infof("Removing %v %v", kind, name)
+		err := os.Remove(filepath.Join(packsDir, name+".zip"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		delete(*versions, name)
+	}
+	if err := DumpVersionsInfo(dir, info); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// EnableDatapacks makes sure the configured datapacks are enabled in the running world
+func (s *Server) EnableDatapacks(ctx context.Context) error {
+	if len(s.Config().Datapacks) == 0 {
+		return nil
+	}
+	commands := make([]string, len(s.Config().Datapacks))
+	for i, pack := range s.Config().Datapacks {
+		commands[i] = fmt.Sprintf("datapack enable \"file/%v\"", pack.fileName())
+	}
+	return s.SendBatch(ctx, commands)
+}
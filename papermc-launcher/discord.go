@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const DISCORD_API_MESSAGES_TEMPLATE = "https://discord.com/api/v10/channels/%v/messages"
+const DISCORD_POLL_INTERVAL = 3 * time.Second
+
+type DiscordConfig struct {
+	Token     string `json:"token"`
+	ChannelID string `json:"channel_id"`
+}
+
+type DiscordMessage struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	Author  struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Bot        bool   `json:"bot"`
+	} `json:"author"`
+}
+
+type DiscordClient struct {
+	Config DiscordConfig
+	client http.Client
+}
+
+func (d *DiscordClient) do(ctx context.Context, method, url string, body any, result any) error {
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+d.Config.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("discord responded with %v", resp.Status)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+func (d *DiscordClient) Send(text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	return d.do(ctx, http.MethodPost, fmt.Sprintf(DISCORD_API_MESSAGES_TEMPLATE, d.Config.ChannelID), map[string]any{"content": text}, nil)
+}
+
+// Poll periodically fetches new channel messages and calls handle for the ones written by humans
+func (d *DiscordClient) Poll(ctx context.Context, handle func(author ChatAuthor, text string)) {
+	baseURL := fmt.Sprintf(DISCORD_API_MESSAGES_TEMPLATE, d.Config.ChannelID)
+	var lastID string
+	for ctx.Err() == nil {
+		var messages []DiscordMessage
+		url := baseURL + "?limit=50"
+		if lastID == "" {
+			// Skip the history, only relay messages written from now on
+			url = baseURL + "?limit=1"
+		} else {
+			url += "&after=" + lastID
+		}
+		err := d.do(ctx, http.MethodGet, url, nil, &messages)
+		if err != nil && ctx.Err() == nil {
+			warnf("Discord polling failed: %v", err)
+		}
+		// Snowflakes grow with time, but the API returns the newest first
+		sort.Slice(messages, func(i, j int) bool {
+			a, _ := strconv.ParseUint(messages[i].ID, 10, 64)
+			b, _ := strconv.ParseUint(messages[j].ID, 10, 64)
+			return a < b
+		})
+		initial := lastID == ""
+		for _, msg := range messages {
+			lastID = msg.ID
+			if initial || msg.Author.Bot || msg.Content == "" {
+				continue
+			}
+			author := ChatAuthor{Name: msg.Author.GlobalName, ID: msg.Author.ID}
+			if author.Name == "" {
+				author.Name = msg.Author.Username
+			}
+			handle(author, msg.Content)
+		}
+		if initial && lastID == "" && err == nil {
+			// Empty channel
+			lastID = "0"
+		}
+		select {
+		case <-time.After(DISCORD_POLL_INTERVAL):
+		case <-ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Alerts when the disk with the work dir and the backups runs low
+type DiskAlertConfig struct {
+	// Free space below which the alert fires, e.g. 5G
+	MinFree string `json:"min_free"`
+}
+
+func (c *DiskAlertConfig) Validate() error {
+	if c.MinFree == "" {
+		return errors.New("min_free is not set")
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("not supported on windows")
+	}
+	_, err := ParseSize(c.MinFree)
+	return err
+}
+
+// Notifies once when the free space drops below the limit and again only after it recovered
+func (s *Server) checkDiskSpace() {
+	cfg := s.Config().DiskAlert
+	if cfg == nil {
+		return
+	}
+	limit, _ := ParseSize(cfg.MinFree)
+	// Backups are written next to the work dir, the parent is where they take space
+	free, err := freeSpace(filepath.Dir(filepath.Clean(s.Config().WorkDir)))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			warnf("Can not check the free disk space: %v", err)
+		}
+		return
+	}
+	low := free < uint64(limit)
+	if s.diskLow.Swap(low) || !low {
+		return
+	}
+	s.Notify(EventDiskSpace, s.msg(MsgDiskSpaceLow, free>>20, limit>>20), "")
+}
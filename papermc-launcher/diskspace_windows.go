@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "errors"
+
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("free space checks are not supported on windows")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lowers the view and simulation distance as players join to keep the TPS up, for example
+//
+//	{"view_command": "vdt view %v", "simulation_command": "vdt simulation %v", "steps": [
+//		{"players": 0, "view_distance": 10, "simulation_distance": 8},
+//		{"players": 10, "view_distance": 7, "simulation_distance": 5},
+//		{"players": 20, "view_distance": 5, "simulation_distance": 4}]}
+//
+// The server has no commands to change the distances while running, a plugin has to provide them.
+type DistanceTuningConfig struct {
+	// Sets the view distance, %v is replaced with the distance
+	ViewCommand string `json:"view_command,omitempty"`
+	// Sets the simulation distance, %v is replaced with the distance
+	SimulationCommand string         `json:"simulation_command,omitempty"`
+	Steps             []DistanceStep `json:"steps"`
+}
+
+type DistanceStep struct {
+	// The step applies from this many players online
+	Players int `json:"players"`
+	// Distances in chunks, a zero distance is left as it is
+	ViewDistance       int `json:"view_distance,omitempty"`
+	SimulationDistance int `json:"simulation_distance,omitempty"`
+}
+
+func (c *DistanceTuningConfig) Validate() error {
+	if len(c.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	for i, step := range c.Steps {
+		if i > 0 && step.Players <= c.Steps[i-1].Players {
+			return errors.New("steps have to be sorted by players")
+		}
+		for _, distance := range []int{step.ViewDistance, step.SimulationDistance} {
+			if distance != 0 && (distance < 2 || distance > 32) {
+				return fmt.Errorf("distance %v is outside 2-32", distance)
+			}
+		}
+		if step.ViewDistance != 0 && !strings.Contains(c.ViewCommand, "%v") {
+			return errors.New("view_command with %v is required to set the view distance")
+		}
+		if step.SimulationDistance != 0 && !strings.Contains(c.SimulationCommand, "%v") {
+			return errors.New("simulation_command with %v is required to set the simulation distance")
+		}
+	}
+	return nil
+}
+
+// Step for the player count, -1 while there are fewer players than the first step needs
+func (c *DistanceTuningConfig) Step(online int) int {
+	step := -1
+	for i := range c.Steps {
+		if c.Steps[i].Players <= online {
+			step = i
+		}
+	}
+	return step
+}
+
+// Vanilla distances when server.properties does not set them
+const DEFAULT_VIEW_DISTANCE = 10
+const DEFAULT_SIMULATION_DISTANCE = 10
+
+// The distances of server.properties, the server starts with them
+func baselineDistances(dir string) DistanceStep {
+	distances := DistanceStep{ViewDistance: DEFAULT_VIEW_DISTANCE, SimulationDistance: DEFAULT_SIMULATION_DISTANCE}
+	properties, err := ReadServerProperties(dir)
+	if err != nil {
+		warnf("Failed to read %v: %v", SERVER_PROPERTIES_FILE, err)
+		return distances
+	}
+	if view, err := strconv.Atoi(properties["view-distance"]); err == nil {
+		distances.ViewDistance = view
+	}
+	if simulation, err := strconv.Atoi(properties["simulation-distance"]); err == nil {
+		distances.SimulationDistance = simulation
+	}
+	return distances
+}
+
+// Applies the distances for the players online when the step changes. Below the first
+// step the distances go back to the ones of server.properties.
+func (s *Server) tuneDistances() {
+	cfg := s.Config().DistanceTuning
+	if cfg == nil {
+		return
+	}
+	online := len(s.sessions.Online())
+	step := cfg.Step(online)
+	// Stored off by one, zero is the distance from server.properties after a start
+	if s.distanceStep.Swap(int32(step+1)) == int32(step+1) {
+		return
+	}
+	var distances DistanceStep
+	if step < 0 {
+		distances = baselineDistances(s.Config().WorkDir)
+		// Distances without a command were never changed
+		if !strings.Contains(cfg.ViewCommand, "%v") {
+			distances.ViewDistance = 0
+		}
+		if !strings.Contains(cfg.SimulationCommand, "%v") {
+			distances.SimulationDistance = 0
+		}
+	} else {
+		distances = cfg.Steps[step]
+	}
+	infof("%v players online, view distance %v, simulation distance %v", online, distances.ViewDistance, distances.SimulationDistance)
+	if distances.ViewDistance != 0 {
+		s.queue.Push(ConsoleCommand(fmt.Sprintf(cfg.ViewCommand, distances.ViewDistance), OriginLauncher, PriorityAdmin))
+	}
+	if distances.SimulationDistance != 0 {
+		s.queue.Push(ConsoleCommand(fmt.Sprintf(cfg.SimulationCommand, distances.SimulationDistance), OriginLauncher, PriorityAdmin))
+	}
+}
@@ -8,14 +8,17 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
-const PAPER_API_VERSION_URL = "https://api.papermc.io/v2/projects/paper"
-const PAPER_API_BUILDS_URL_TEMPLATE = "https://api.papermc.io/v2/projects/paper/versions/%v/builds"
-const PAPER_API_JAR_DOWNLOAD_TEMPLATE = "https://api.papermc.io/v2/projects/paper/versions/%v/builds/%v/downloads/%v"
+const PAPER_API_PROJECT_URL_TEMPLATE = "https://api.papermc.io/v2/projects/%v"
+const PAPER_API_BUILDS_URL_TEMPLATE = "https://api.papermc.io/v2/projects/%v/versions/%v/builds"
+const PAPER_API_JAR_DOWNLOAD_TEMPLATE = "https://api.papermc.io/v2/projects/%v/versions/%v/builds/%v/downloads/%v"
 
 const VERSIONS_FILE = "version.json"
+const VERSIONS_LOCK_TIMEOUT = 30 * time.Second
 
 type VersionInfo struct {
 	Version string `json:"version"`
@@ -23,13 +26,18 @@ type VersionInfo struct {
 }
 
 type VersionsInfo struct {
-	PaperVer VersionInfo            `json:"paper"`
-	Plugins  map[string]VersionInfo `json:"plugins,omitempty"`
+	PaperVer VersionInfo `json:"paper"`
+	// Which project PaperVer is a build of, paper when empty
+	Flavor    ServerFlavor           `json:"flavor,omitempty"`
+	Plugins   map[string]VersionInfo `json:"plugins,omitempty"`
+	Datapacks map[string]VersionInfo `json:"datapacks,omitempty"`
+	// Packs in Geyser's packs folder
+	BedrockPacks map[string]VersionInfo `json:"bedrock_packs,omitempty"`
 }
 
-// LoadConfig loads the configuration from a JSON file
-func LoadVersionsInfo() (VersionsInfo, error) {
-	file, err := os.Open(VERSIONS_FILE)
+// LoadVersionsInfo loads the versions of paper and plugins installed into dir
+func LoadVersionsInfo(dir string) (VersionsInfo, error) {
+	file, err := os.Open(filepath.Join(dir, VERSIONS_FILE))
 	if err != nil {
 		return VersionsInfo{}, fmt.Errorf("error opening versions_info file: %w", err)
 	}
@@ -44,27 +52,40 @@ func LoadVersionsInfo() (VersionsInfo, error) {
 	return info, nil
 }
 
-func DumpVersionsInfo(info VersionsInfo) error {
-	f, err := os.OpenFile(VERSIONS_FILE, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return err
+// MigrateVersionsInfo moves the version file older launchers kept in the current directory
+// into dir. Only the first instance started takes it, the others start without one.
+func MigrateVersionsInfo(dir string) error {
+	target := filepath.Join(dir, VERSIONS_FILE)
+	if _, err := os.Stat(target); err == nil {
+		return nil
 	}
-	defer f.Close()
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	err = enc.Encode(info)
-	return err
+	if _, err := os.Stat(VERSIONS_FILE); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	infof("Moving %v into %v", VERSIONS_FILE, dir)
+	return os.Rename(VERSIONS_FILE, target)
+}
+
+func DumpVersionsInfo(dir string, info VersionsInfo) error {
+	return writeJSON(filepath.Join(dir, VERSIONS_FILE), info)
+}
+
+// LockVersionsInfo guards the read-modify-write of the version file against other launcher instances
+func LockVersionsInfo(dir string) (func(), error) {
+	return AcquireLockFile(filepath.Join(dir, VERSIONS_FILE+".lock"), VERSIONS_LOCK_TIMEOUT)
 }
 
 func LoadFileIfDoesNotExist(url, dir, filename, checksum string) error {
-	f, err := os.OpenFile(dir+"/"+filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if JarCacheDir != "" && checksum != "" {
+		return loadCachedFile(url, dir, filename, checksum)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, filename), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 	downloadRes, err := http.Get(url)
 	if err != nil {
-		panic(err)
 		return err
 	}
 	defer downloadRes.Body.Close()
@@ -90,68 +111,173 @@ func LoadFileIfDoesNotExist(url, dir, filename, checksum string) error {
 	return nil
 }
 
-func LoadPaper(dir string) {
-	info, err := LoadVersionsInfo()
+// LinkFile makes target point to source. Symlinks require extra privileges
+// on Windows, so it falls back to a hard link and then to a copy.
+func LinkFile(source, target string) error {
+	err := os.Symlink(filepath.Base(source), target)
+	if err == nil {
+		return nil
+	}
+	if os.Link(source, target) == nil {
+		return nil
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
 	if err != nil {
-		fmt.Printf("[WARN] Failed to read versions info from %v\n", VERSIONS_FILE)
+		return err
 	}
-	resp, err := http.Get(PAPER_API_VERSION_URL)
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+type PaperVersions struct {
+	Versions []string `json:"versions"`
+}
+
+type PaperBuild struct {
+	Build int `json:"build"`
+	// default for the stable builds, experimental otherwise
+	Channel string `json:"channel"`
+	Changes []struct {
+		Summary string `json:"summary"`
+	} `json:"changes"`
+	Downloads struct {
+		Application struct {
+			Name   string `json:"name"`
+			Sha256 string `json:"sha256"`
+		} `json:"application"`
+	} `json:"downloads"`
+}
+
+type PaperBuilds struct {
+	Builds []PaperBuild `json:"builds"`
+}
+
+func getJSON(url string, v any) error {
+	resp, err := http.Get(url)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v returned %v", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// LoadPaper downloads the latest build of the flavor into dir and links it as paper.jar.
+// A major upgrade is skipped while critical plugins have no build for it.
+// Failures are wrapped in ErrDownload.
+// LoadPaper downloads the latest build of the installed version, or of the latest version when
+// newVersion is set or nothing is installed yet
+// Update argument which moves the server to a new minecraft version
+const NEW_VERSION_FLAG = "new-version"
+
+func LoadPaper(dir string, flavor ServerFlavor, plugins []PluginCompatibility, newVersion bool) error {
+	if err := loadPaper(dir, flavor, plugins, newVersion); err != nil {
+		return fmt.Errorf("%w: %w", ErrDownload, err)
+	}
+	return nil
+}
+
+func loadPaper(dir string, flavor ServerFlavor, plugins []PluginCompatibility, newVersion bool) error {
+	unlock, err := LockVersionsInfo(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	info, err := LoadVersionsInfo(dir)
 	if err != nil {
-		panic(err)
-	}
-	var parsed map[string]interface{}
-	json.Unmarshal(body, &parsed)
-	version := parsed["versions"].([]interface{})[len(parsed["versions"].([]interface{}))-1].(string)
-	if version != info.PaperVer.Version {
-		fmt.Printf("A new version of paper found: %v (current is %v). Would you like to update? [y/N]\n", version, info.PaperVer.Version)
-		var answer string
-		fmt.Scanln(&answer)
-		if strings.ToLower(answer) != "yes" && strings.ToLower(answer) != "y" {
-			version = info.PaperVer.Version
+		warnf("Failed to read versions info from %v", VERSIONS_FILE)
+	}
+	// Switching between paper and folia installs the other project from scratch
+	if info.Flavor.Project() != flavor.Project() {
+		info.PaperVer = VersionInfo{}
+	}
+	var versions PaperVersions
+	if err := getJSON(fmt.Sprintf(PAPER_API_PROJECT_URL_TEMPLATE, flavor.Project()), &versions); err != nil {
+		return err
+	}
+	if len(versions.Versions) == 0 {
+		return fmt.Errorf("No versions found")
+	}
+	version := versions.Versions[len(versions.Versions)-1]
+	current := info.PaperVer.Version
+	if current != "" && MajorVersion(version) != MajorVersion(current) {
+		if blockers := UpgradeBlockers(plugins, flavor, version); len(blockers) > 0 {
+			warnf("Paper %v is blocked by plugins without a compatible build: %v", version, strings.Join(blockers, ", "))
+			version = latestInMajor(versions.Versions, current)
 		}
 	}
-	fmt.Println("Chosen version: " + version)
-	buildsResp, err := http.Get(fmt.Sprintf(PAPER_API_BUILDS_URL_TEMPLATE, version))
+	if current != "" && version != current && !newVersion {
+		infof("A new version of %v found: %v (current is %v), `update %v` installs it", flavor.Project(), version, current, NEW_VERSION_FLAG)
+		version = current
+	}
+	infof("Chosen version: %v", version)
+	var builds PaperBuilds
+	if err := getJSON(fmt.Sprintf(PAPER_API_BUILDS_URL_TEMPLATE, flavor.Project(), version), &builds); err != nil {
+		return err
+	}
+	if len(builds.Builds) == 0 {
+		return fmt.Errorf("No builds found")
+	}
+	build := builds.Builds[len(builds.Builds)-1]
+	_, jarErr := os.Stat(filepath.Join(dir, "paper.jar"))
+	if info.PaperVer.Build > 0 && info.PaperVer.Build == build.Build && jarErr == nil {
+		infof("Already latest %v build", flavor.Project())
+		return nil
+	}
+	if err := installPaperBuild(dir, flavor, version, build, &info); err != nil {
+		return err
+	}
+	err = DumpVersionsInfo(dir, info)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer buildsResp.Body.Close()
-	body, err = io.ReadAll(buildsResp.Body)
+	infof("Sucessfuly downloaded %v", build.Downloads.Application.Name)
+	return nil
+}
+
+// LoadPaperBuild installs the given build of the version without asking, for the auto-update
+func LoadPaperBuild(dir string, flavor ServerFlavor, version string, build PaperBuild) error {
+	unlock, err := LockVersionsInfo(dir)
 	if err != nil {
-		panic(err)
-	}
-	json.Unmarshal(body, &parsed)
-	build := parsed["builds"].([]interface{})[len(parsed["builds"].([]interface{}))-1].(map[string]interface{})
-	buildNumber := int(build["build"].(float64))
-	if info.PaperVer.Build > 0 && info.PaperVer.Build == buildNumber {
-		fmt.Println("Already latest paper build")
-		return
-	}
-	filename := build["downloads"].(map[string]interface{})["application"].(map[string]interface{})["name"].(string)
-	checksum := build["downloads"].(map[string]interface{})["application"].(map[string]interface{})["sha256"].(string)
-	url := fmt.Sprintf(PAPER_API_JAR_DOWNLOAD_TEMPLATE, version, buildNumber, filename)
-	err = LoadFileIfDoesNotExist(url, dir, filename, checksum)
+		return err
+	}
+	defer unlock()
+	info, err := LoadVersionsInfo(dir)
+	if err != nil {
+		warnf("Failed to read versions info from %v", VERSIONS_FILE)
+	}
+	if err := installPaperBuild(dir, flavor, version, build, &info); err != nil {
+		return fmt.Errorf("%w: %w", ErrDownload, err)
+	}
+	return DumpVersionsInfo(dir, info)
+}
+
+// Downloads the build, links it as paper.jar and records it in info. The caller holds the versions lock.
+func installPaperBuild(dir string, flavor ServerFlavor, version string, build PaperBuild, info *VersionsInfo) error {
+	filename := build.Downloads.Application.Name
+	url := fmt.Sprintf(PAPER_API_JAR_DOWNLOAD_TEMPLATE, flavor.Project(), version, build.Build, filename)
+	err := LoadFileIfDoesNotExist(url, dir, filename, build.Downloads.Application.Sha256)
 	if err != nil && !os.IsExist(err) {
-		panic(err)
+		return err
 	}
-	err = os.Remove(dir + "/paper.jar")
+	err = os.Remove(filepath.Join(dir, "paper.jar"))
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		panic(err)
+		return err
 	}
-	err = os.Symlink(filename, dir+"/paper.jar")
+	err = LinkFile(filepath.Join(dir, filename), filepath.Join(dir, "paper.jar"))
 	if err != nil {
-		panic(err)
+		return err
 	}
 	info.PaperVer.Version = version
-	info.PaperVer.Build = buildNumber
-	err = DumpVersionsInfo(info)
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Sucessfuly downloaded %v\n", filename)
+	info.PaperVer.Build = build.Build
+	info.Flavor = flavor
+	return nil
 }
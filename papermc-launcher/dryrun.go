@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// How far ahead the dry run simulates the schedule
+const DRY_RUN_PERIOD = 7 * 24 * time.Hour
+
+// DryRun prints the scheduled commands and what they would do without starting the server.
+// With speed above zero a virtual clock runs that many times faster than the real one,
+// otherwise the whole period is printed at once.
+func (s *Server) DryRun(ctx context.Context, period time.Duration, speed float64) error {
+	now := time.Now()
+	end := now.Add(period)
+	fmt.Printf("Dry run until %v\n", end.Format("2006-01-02 15:04 MST"))
+	for {
+		next, cmd := s.nextScheduled(now)
+		if next == nil || next.After(end) {
+			break
+		}
+		if speed > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Duration(float64(next.Sub(now)) / speed)):
+			}
+		}
+		fmt.Printf("[dry-run %v] %v\n", next.Format("Mon 2006-01-02 15:04 MST"), cmd)
+		for _, action := range s.dryRunActions(cmd, *next) {
+			fmt.Printf("    %v\n", action)
+		}
+		now = *next
+	}
+	fmt.Println("Dry run finished")
+	return nil
+}
+
+// What the command would do at the time, server commands as they would be sent
+func (s *Server) dryRunActions(cmd InnerCmd, at time.Time) []string {
+	var actions []string
+	switch cmd {
+	case Wake:
+		actions = append(actions, fmt.Sprintf("start the server %v before the opening", s.Config().Sleep.warmUp()))
+	case OpenAccess:
+		for _, player := range s.Config().Players {
+			actions = append(actions, WhitelistCommand(player, true))
+		}
+		if s.Config().Firewall != nil {
+			actions = append(actions, fmt.Sprintf("unblock UDP port %v (%v)", s.bedrockPort(), s.Config().Firewall.Backend))
+		}
+		if s.Config().PortMapping.Enabled {
+			actions = append(actions, "open the port mappings")
+		}
+		actions = append(actions, fmt.Sprintf("notify %v: %v", EventScheduleOpen, s.msg(MsgServerOpen)))
+	case Warn:
+		actions = append(actions, s.dryRunSay(s.msg(MsgClosingSoon), at)+" (if players are online)")
+	case CloseAccess:
+		if s.Config().CloseGrace > 0 {
+			actions = append(actions, fmt.Sprintf("delay by %v if players are online", time.Duration(s.Config().CloseGrace)))
+		}
+		actions = append(actions, s.dryRunSay(s.msg(MsgClosingNow), at)+" (if players are online)")
+		for _, player := range s.Config().Players {
+			actions = append(actions, WhitelistCommand(player, false))
+		}
+		for _, player := range s.Config().Players {
+			actions = append(actions, fmt.Sprintf("kick %v %v (if online)", player.ServerName(), s.msg(MsgKickClosed)))
+		}
+		if s.Config().PortMapping.Enabled {
+			actions = append(actions, "close the port mappings")
+		}
+		if s.Config().Firewall != nil {
+			actions = append(actions, fmt.Sprintf("block UDP port %v (%v)", s.bedrockPort(), s.Config().Firewall.Backend))
+		}
+		actions = append(actions, fmt.Sprintf("notify %v: %v", EventScheduleClose, s.msg(MsgServerClosed)))
+		if s.Config().Sleep != nil {
+			actions = append(actions, "stop the server until the next warm-up")
+		}
+	case Backup, ColdBackupCmd:
+		if !s.awakeAt(at) {
+			actions = append(actions, "archive "+s.Config().WorkDir+" while the server is asleep")
+		} else if cmd == Backup {
+			actions = append(actions, "save-off", "save-all flush", "archive "+s.Config().WorkDir, "save-on")
+		} else {
+			actions = append(actions, s.dryRunSay(s.msg(MsgRestartBackup), at), "stop", "archive "+s.Config().WorkDir, "start the server")
+		}
+		for _, target := range s.Config().Backup.Targets {
+			actions = append(actions, fmt.Sprintf("upload to %v (%v %v:%v)", target.Name, target.Type, target.Host, target.Path))
+		}
+	case AutoUpdate:
+		actions = append(actions,
+			"look up new paper builds of the installed version and geyser patch releases",
+			"back up "+s.Config().WorkDir,
+			fmt.Sprintf("install them, roll back if the server is not running within %v", AUTO_UPDATE_START_TIMEOUT))
+	}
+	return actions
+}
+
+// The broadcast as the dry run lists it, skipped during quiet hours
+func (s *Server) dryRunSay(text string, at time.Time) string {
+	if s.quietAt(at) {
+		return "no say during quiet hours: " + text
+	}
+	return "say " + text
+}
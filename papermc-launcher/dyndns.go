@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DYNDNS_DEFAULT_INTERVAL = 5 * time.Minute
+const DYNDNS_DEFAULT_IP_LOOKUP = "https://api.ipify.org"
+const DYNDNS_DEFAULT_UPDATE_URL = "https://members.dyndns.org/nic/update"
+const CLOUDFLARE_API = "https://api.cloudflare.com/client/v4"
+
+const (
+	DnsCloudflare = "cloudflare"
+	DnsDynDns     = "dyndns"
+)
+
+// Keeps a DNS record pointed at the public IP of this machine
+type DynDnsConfig struct {
+	// cloudflare or dyndns (any service speaking the dyndns2 protocol)
+	Provider string `json:"provider"`
+	Hostname string `json:"hostname"`
+	// How often the public IP is checked
+	Interval Duration `json:"interval,omitempty"`
+	// Url returning the public IP as plain text
+	IpLookup string `json:"ip_lookup,omitempty"`
+	// Cloudflare API token with DNS edit permission and the zone of the record
+	Token  string `json:"token,omitempty"`
+	ZoneID string `json:"zone_id,omitempty"`
+	// dyndns2 endpoint and credentials
+	UpdateURL string `json:"update_url,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+}
+
+func (c DynDnsConfig) Validate() error {
+	if c.Hostname == "" {
+		return errors.New("hostname is not set")
+	}
+	switch c.Provider {
+	case DnsCloudflare:
+		if c.Token == "" || c.ZoneID == "" {
+			return errors.New("cloudflare needs token and zone_id")
+		}
+	case DnsDynDns:
+		if c.Username == "" || c.Password == "" {
+			return errors.New("dyndns needs username and password")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q", c.Provider)
+	}
+	if c.Interval < 0 {
+		return errors.New("interval should be positive")
+	}
+	return nil
+}
+
+var dnsClient = http.Client{Timeout: 30 * time.Second}
+
+// PublicIP asks the lookup service for the address this machine is seen from
+func (c DynDnsConfig) PublicIP() (string, error) {
+	lookup := c.IpLookup
+	if lookup == "" {
+		lookup = DYNDNS_DEFAULT_IP_LOOKUP
+	}
+	resp, err := dnsClient.Get(lookup)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("ip lookup returned %q", ip)
+	}
+	return ip, nil
+}
+
+// Update points the record at ip
+func (c DynDnsConfig) Update(ip string) error {
+	if c.Provider == DnsCloudflare {
+		return c.updateCloudflare(ip)
+	}
+	return c.updateDynDns(ip)
+}
+
+func (c DynDnsConfig) updateDynDns(ip string) error {
+	endpoint := c.UpdateURL
+	if endpoint == "" {
+		endpoint = DYNDNS_DEFAULT_UPDATE_URL
+	}
+	query := url.Values{"hostname": {c.Hostname}, "myip": {ip}}
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("User-Agent", "papermc-launcher")
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+	answer := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(answer, "good") && !strings.HasPrefix(answer, "nochg") {
+		return fmt.Errorf("dyndns update failed: %v %q", resp.Status, answer)
+	}
+	return nil
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (c DynDnsConfig) cloudflare(method string, path string, payload interface{}, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, CLOUDFLARE_API+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var answer cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("cloudflare responded with %v: %w", resp.Status, err)
+	}
+	if !answer.Success {
+		return fmt.Errorf("cloudflare error: %v", answer.Errors)
+	}
+	if result != nil {
+		return json.Unmarshal(answer.Result, result)
+	}
+	return nil
+}
+
+func (c DynDnsConfig) updateCloudflare(ip string) error {
+	recordType := "A"
+	if strings.Contains(ip, ":") {
+		recordType = "AAAA"
+	}
+	query := url.Values{"name": {c.Hostname}, "type": {recordType}}
+	var records []cloudflareRecord
+	path := fmt.Sprintf("/zones/%v/dns_records", c.ZoneID)
+	if err := c.cloudflare(http.MethodGet, path+"?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+	record := cloudflareRecord{Type: recordType, Name: c.Hostname, Content: ip}
+	if len(records) == 0 {
+		return c.cloudflare(http.MethodPost, path, record, nil)
+	}
+	if records[0].Content == ip {
+		return nil
+	}
+	return c.cloudflare(http.MethodPatch, path+"/"+records[0].ID, map[string]string{"content": ip}, nil)
+}
+
+// StartDynDns checks the public IP periodically and updates the record when it changes
+func (s *Server) StartDynDns(ctx context.Context) {
+	cfg := s.Config().DynDns
+	if cfg == nil {
+		return
+	}
+	interval := time.Duration(cfg.Interval)
+	if interval == 0 {
+		interval = DYNDNS_DEFAULT_INTERVAL
+	}
+	go func() {
+		var current string
+		for {
+			ip, err := cfg.PublicIP()
+			if err != nil {
+				warnf("Failed to get public IP: %v", err)
+			} else if ip != current {
+				if err := cfg.Update(ip); err != nil {
+					warnf("Failed to update DNS record %v: %v", cfg.Hostname, err)
+				} else {
+					infof("DNS record %v points to %v", cfg.Hostname, ip)
+					current = ip
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
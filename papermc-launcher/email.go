@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const ChannelEmail = "email"
+
+// Events mailed by default, the ones an admin has to act on
+var defaultEmailEvents = []string{EventCrash, EventCrashLoop, EventBackupFailed, EventDiskSpace}
+
+// Port of SMTP over TLS, other ports switch to TLS with STARTTLS when the server offers it
+const SMTPS_PORT = "465"
+
+// Limit of the whole SMTP conversation, a stuck mail server must not hold up the notifications
+const EMAIL_TIMEOUT = 30 * time.Second
+
+type EmailConfig struct {
+	// SMTP server as host:port
+	Server   string   `json:"server"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// Events mailed unless a route names the email channel, crashes, failed backups and low disk space by default
+	Events []string `json:"events,omitempty"`
+}
+
+func (c *EmailConfig) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Server); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	if c.From == "" || len(c.To) == 0 {
+		return errors.New("from and to are required")
+	}
+	return nil
+}
+
+func (c *EmailConfig) wants(event string) bool {
+	events := c.Events
+	if events == nil {
+		events = defaultEmailEvents
+	}
+	return slices.Contains(events, event) || slices.Contains(events, DEFAULT_ROUTE)
+}
+
+// Mails notifications to the admins
+type EmailSink struct {
+	Config EmailConfig
+	Format func(Notification) string
+}
+
+func (e EmailSink) Send(n Notification) error {
+	subject := fmt.Sprintf("[papermc-launcher] %v", n.Message)
+	message := emailMessage(e.Config.From, e.Config.To, subject, e.Format(n), n.Time)
+	host, port, err := net.SplitHostPort(e.Config.Server)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if e.Config.Username != "" {
+		auth = smtp.PlainAuth("", e.Config.Username, e.Config.Password, host)
+	}
+	dialer := &net.Dialer{Timeout: EMAIL_TIMEOUT}
+	var conn net.Conn
+	if port == SMTPS_PORT {
+		conn, err = tls.DialWithDialer(dialer, "tcp", e.Config.Server, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", e.Config.Server)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(EMAIL_TIMEOUT)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if port != SMTPS_PORT {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.Config.From); err != nil {
+		return err
+	}
+	for _, to := range e.Config.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Plain text mail with the subject encoded for non-ASCII messages
+func emailMessage(from string, to []string, subject, body string, at time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %v\r\n", from)
+	fmt.Fprintf(&b, "To: %v\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %v\r\n", at.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,45 @@
+package main
+
+import "errors"
+
+// Exit codes of the launcher, for wrapper scripts and systemd's RestartPreventExitStatus
+const (
+	EXIT_FAILURE      = 1
+	EXIT_CONFIG       = 3
+	EXIT_DOWNLOAD     = 4
+	EXIT_JAVA_MISSING = 5
+	EXIT_CRASH        = 6
+	EXIT_CRASH_LOOP   = 7
+	EXIT_LOCKED       = 8
+)
+
+var (
+	ErrConfig      = errors.New("invalid config")
+	ErrDownload    = errors.New("download failed")
+	ErrJavaMissing = errors.New("java executable not found")
+	ErrCrash       = errors.New("server crashed")
+	ErrCrashLoop   = errors.New("server keeps crashing")
+	ErrLocked      = errors.New("work dir is locked")
+)
+
+// ExitCode maps an error returned by the launcher to the process exit code
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrConfig):
+		return EXIT_CONFIG
+	case errors.Is(err, ErrDownload):
+		return EXIT_DOWNLOAD
+	case errors.Is(err, ErrJavaMissing):
+		return EXIT_JAVA_MISSING
+	case errors.Is(err, ErrCrashLoop):
+		return EXIT_CRASH_LOOP
+	case errors.Is(err, ErrCrash):
+		return EXIT_CRASH
+	case errors.Is(err, ErrLocked):
+		return EXIT_LOCKED
+	default:
+		return EXIT_FAILURE
+	}
+}
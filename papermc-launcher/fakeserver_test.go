@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// When set, the test binary acts as a paper server instead of running the tests
+const FAKE_SERVER_ENV = "PAPERMC_LAUNCHER_FAKE_SERVER"
+
+// Every command the fake server receives is appended to this file in its work dir
+const FAKE_COMMANDS_LOG = "commands.log"
+
+// runFakeServer mimics the console of a paper server: it prints the usual log
+// lines and answers the commands the launcher relies on. Besides the real
+// commands it understands `fake-join <player>`, `fake-leave <player>`,
+// `fake-reject <player>`, `fake-lock-whitelist` and `fake-crash`, which let
+// the tests drive the server.
+func runFakeServer() int {
+	logLine := func(format string, args ...interface{}) {
+		fmt.Printf("[%v INFO]: %v\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+	}
+	commands, err := os.OpenFile(FAKE_COMMANDS_LOG, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer commands.Close()
+
+	logLine("Starting minecraft server version 1.21.1")
+	logLine(`Done (0.123s)! For help, type "help"`)
+	online := make(map[string]bool)
+	whitelist := make(map[string]bool)
+	whitelistLocked := false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		input := scanner.Text()
+		fmt.Fprintln(commands, input)
+		command, arg, _ := strings.Cut(input, " ")
+		switch command {
+		case "stop":
+			logLine("Stopping the server")
+			return 0
+		case "save-off":
+			logLine("Automatic saving is now disabled")
+		case "save-on":
+			logLine("Automatic saving is now enabled")
+		case "save-all":
+			logLine("Saving the game (this may take a moment!)")
+			logLine("Saved the game")
+		case "list":
+			logLine("There are %v of a max of 20 players online: ", len(online))
+		case "say":
+			logLine("[Server] %v", arg)
+		case "whitelist", "fwhitelist":
+			action, player, _ := strings.Cut(arg, " ")
+			if command == "fwhitelist" {
+				player = "." + player
+			}
+			switch action {
+			case "add", "remove":
+				if whitelistLocked {
+					logLine("Player is already whitelisted")
+					break
+				}
+				if action == "remove" {
+					delete(whitelist, player)
+					logLine("Removed %v from the whitelist", player)
+					break
+				}
+				whitelist[player] = true
+				logLine("Added %v to the whitelist", player)
+			case "list":
+				if len(whitelist) == 0 {
+					logLine("There are no whitelisted players")
+					break
+				}
+				var players []string
+				for player := range whitelist {
+					players = append(players, player)
+				}
+				logLine("There are %v whitelisted player(s): %v", len(players), strings.Join(players, ", "))
+			}
+		case "fake-join":
+			online[arg] = true
+			logLine("%v joined the game", arg)
+		case "fake-leave":
+			delete(online, arg)
+			logLine("%v left the game", arg)
+		case "fake-reject":
+			logLine("%v (/127.0.0.1:50123) lost connection: You are not white-listed on this server!", arg)
+		case "fake-lock-whitelist":
+			whitelistLocked = true
+		case "fake-crash":
+			os.MkdirAll("crash-reports", os.ModePerm)
+			report := filepath.Join("crash-reports", fmt.Sprintf("crash-%v-server.txt", time.Now().Format("2006-01-02_15.04.05")))
+			os.WriteFile(report, []byte(strings.Join([]string{
+				"---- Minecraft Crash Report ----",
+				"Description: Exception in server tick loop",
+				"",
+				"java.lang.IllegalStateException: Fake crash",
+				"\tat net.minecraft.server.MinecraftServer.tick(MinecraftServer.java:1)",
+			}, "\n")), 0644)
+			fmt.Fprintln(os.Stderr, "Fake crash")
+			return 1
+		default:
+			logLine("Unknown or incomplete command, see below for error")
+		}
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const DEFAULT_SUMMARY_WINDOW = time.Minute
+
+type FilterAction string
+
+const (
+	FilterHide      FilterAction = "hide"
+	FilterSummarize FilterAction = "summarize"
+)
+
+// Hides noisy server output from the launcher console. The server still writes it to logs/latest.log.
+type LogFilter struct {
+	Name    string       `json:"name,omitempty"`
+	Pattern Regexp       `json:"pattern"`
+	Action  FilterAction `json:"action"`
+	// For summarize: how long matching lines are suppressed after one is shown
+	Window Duration `json:"window,omitempty"`
+}
+
+type filterState struct {
+	windowStart time.Time
+	suppressed  int
+}
+
+type LogFilters struct {
+	mu    sync.Mutex
+	state map[int]*filterState
+}
+
+// Show reports whether the line should be printed to the console.
+// It may print summaries of previously suppressed lines.
+func (f *LogFilters) Show(filters []LogFilter, line string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state == nil {
+		f.state = make(map[int]*filterState)
+	}
+	for i, filter := range filters {
+		if filter.Pattern.Regexp == nil || !filter.Pattern.MatchString(line) {
+			continue
+		}
+		if filter.Action != FilterSummarize {
+			return false
+		}
+		window := time.Duration(filter.Window)
+		if window <= 0 {
+			window = DEFAULT_SUMMARY_WINDOW
+		}
+		state, ok := f.state[i]
+		now := time.Now()
+		if ok && now.Sub(state.windowStart) < window {
+			state.suppressed++
+			return false
+		}
+		if ok && state.suppressed > 0 {
+			name := filter.Name
+			if name == "" {
+				name = filter.Pattern.String()
+			}
+			infof("[Filter %v]: %v similar lines hidden", name, state.suppressed)
+		}
+		f.state[i] = &filterState{windowStart: now}
+		return true
+	}
+	return true
+}
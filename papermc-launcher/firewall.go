@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	FirewallNftables = "nftables"
+	FirewallIptables = "iptables"
+	FirewallHook     = "hook"
+)
+
+// nftables table holding the launcher's rule, deleting it removes the block
+const NFT_TABLE = "papermc_launcher"
+
+const IPTABLES_COMMENT = "papermc-launcher"
+
+// Blocks the Bedrock port outside the open hours, so clients can not even ping the server
+type FirewallConfig struct {
+	// nftables, iptables or hook
+	Backend string `json:"backend"`
+	// Bedrock UDP port, geyser.port or 19132 by default
+	Port int `json:"port,omitempty"`
+	// Commands of the hook backend, {port} is replaced with the port
+	OpenCommand  []string `json:"open_command,omitempty"`
+	CloseCommand []string `json:"close_command,omitempty"`
+}
+
+func (c FirewallConfig) Validate() error {
+	switch c.Backend {
+	case FirewallNftables, FirewallIptables:
+		return nil
+	case FirewallHook:
+		if len(c.OpenCommand) == 0 || len(c.CloseCommand) == 0 {
+			return errors.New("hook backend needs open_command and close_command")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown firewall backend %q", c.Backend)
+	}
+}
+
+func runFirewallCommand(stdin string, args ...string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (c FirewallConfig) iptablesRule(port int) []string {
+	return []string{"INPUT", "-p", "udp", "--dport", strconv.Itoa(port), "-m", "comment", "--comment", IPTABLES_COMMENT, "-j", "DROP"}
+}
+
+// SetBlocked adds or removes the rule dropping the port. Both directions are idempotent.
+func (c FirewallConfig) SetBlocked(port int, blocked bool) error {
+	switch c.Backend {
+	case FirewallNftables:
+		// Declaring the table first makes the delete succeed when it does not exist
+		script := fmt.Sprintf("table inet %v {}\ndelete table inet %v\n", NFT_TABLE, NFT_TABLE)
+		if blocked {
+			script += fmt.Sprintf("table inet %v {\n\tchain input {\n\t\ttype filter hook input priority 0; policy accept;\n\t\tudp dport %v drop\n\t}\n}\n", NFT_TABLE, port)
+		}
+		return runFirewallCommand(script, "nft", "-f", "-")
+	case FirewallIptables:
+		rule := c.iptablesRule(port)
+		exists := exec.Command("iptables", append([]string{"-C"}, rule...)...).Run() == nil
+		if blocked && !exists {
+			return runFirewallCommand("", append([]string{"iptables", "-I"}, rule...)...)
+		}
+		if !blocked && exists {
+			return runFirewallCommand("", append([]string{"iptables", "-D"}, rule...)...)
+		}
+		return nil
+	case FirewallHook:
+		command := c.OpenCommand
+		if blocked {
+			command = c.CloseCommand
+		}
+		args := make([]string, len(command))
+		for i, arg := range command {
+			args[i] = strings.ReplaceAll(arg, "{port}", strconv.Itoa(port))
+		}
+		return runFirewallCommand("", args...)
+	}
+	return fmt.Errorf("unknown firewall backend %q", c.Backend)
+}
+
+func (s *Server) bedrockPort() int {
+	switch {
+	case s.Config().Firewall != nil && s.Config().Firewall.Port != 0:
+		return s.Config().Firewall.Port
+	case s.Config().Geyser.Port != 0:
+		return s.Config().Geyser.Port
+	default:
+		return DEFAULT_BEDROCK_PORT
+	}
+}
+
+// Blocks or unblocks the Bedrock port if the firewall is configured
+func (s *Server) setBedrockBlocked(blocked bool) {
+	if s.Config().Firewall == nil {
+		return
+	}
+	if err := s.Config().Firewall.SetBlocked(s.bedrockPort(), blocked); err != nil {
+		warnf("Failed to update the firewall: %v", err)
+		return
+	}
+	if blocked {
+		infof("Bedrock port %v is blocked", s.bedrockPort())
+	} else {
+		infof("Bedrock port %v is open", s.bedrockPort())
+	}
+}
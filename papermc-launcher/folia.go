@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// Server software from the PaperMC downloads API, selected by server_flavor
+type ServerFlavor string
+
+const (
+	FlavorPaper ServerFlavor = "paper"
+	// Paper with regionised multithreading, plugins have to declare folia-supported
+	FlavorFolia ServerFlavor = "folia"
+)
+
+func (f ServerFlavor) Validate() error {
+	switch f {
+	case "", FlavorPaper, FlavorFolia:
+		return nil
+	}
+	return fmt.Errorf("unknown server flavor %q, expected paper or folia", f)
+}
+
+// Project name on the downloads API, paper when not set
+func (f ServerFlavor) Project() string {
+	if f == "" {
+		return string(FlavorPaper)
+	}
+	return string(f)
+}
+
+// Modrinth loaders whose builds run on the flavor
+func (f ServerFlavor) loaders() string {
+	if f == FlavorFolia {
+		return `["folia"]`
+	}
+	return `["paper","spigot","bukkit"]`
+}
+
+// Folia reports the TPS per region instead of the paper summary:
+//
+//	Lowest Region TPS: 19.95 (MSPT: 12.1)
+var foliaTpsLineRegexp = regexp.MustCompile(`Lowest Region TPS: (.*)$`)
+
+// Start of the line the tps command answers with
+func (f ServerFlavor) tpsMarker() string {
+	if f == FlavorFolia {
+		return "Lowest Region TPS"
+	}
+	return "TPS from last"
+}
+
+// Installed plugins that do not declare folia-supported, Folia refuses to load them
+func foliaUnsupportedPlugins(dir string) []string {
+	var unsupported []string
+	jars, _ := filepath.Glob(filepath.Join(dir, "plugins", "*.jar"))
+	for _, jar := range jars {
+		description, err := readPluginDescription(jar)
+		if err != nil {
+			continue
+		}
+		if !description.FoliaSupported {
+			unsupported = append(unsupported, description.Name)
+		}
+	}
+	return unsupported
+}
+
+// Warns about the plugins Folia will not load, the server itself starts without them
+func (s *Server) checkFoliaPlugins() {
+	if s.Config().ServerFlavor != FlavorFolia {
+		return
+	}
+	for _, plugin := range foliaUnsupportedPlugins(s.Config().WorkDir) {
+		warnf("Plugin %v does not declare folia-supported, Folia will not load it", plugin)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const GC_LOG_FILE = "logs/gc.log"
+const GC_LOG_POLL_INTERVAL = 2 * time.Second
+
+type GcMonitorConfig struct {
+	Enabled bool `json:"enabled"`
+	// Warn when there were more full GCs within window
+	MaxFullGcs int      `json:"max_full_gcs,omitempty"`
+	Window     Duration `json:"window,omitempty"`
+	// Warn when the heap stays this full (in percent) after collections for sustained_for
+	OccupancyThreshold float64  `json:"occupancy_threshold,omitempty"`
+	SustainedFor       Duration `json:"sustained_for,omitempty"`
+}
+
+func (c GcMonitorConfig) withDefaults() GcMonitorConfig {
+	if c.MaxFullGcs <= 0 {
+		c.MaxFullGcs = 3
+	}
+	if c.Window <= 0 {
+		c.Window = Duration(10 * time.Minute)
+	}
+	if c.OccupancyThreshold <= 0 {
+		c.OccupancyThreshold = 85
+	}
+	if c.SustainedFor <= 0 {
+		c.SustainedFor = Duration(5 * time.Minute)
+	}
+	return c
+}
+
+func (c GcMonitorConfig) JvmFlag() string {
+	return fmt.Sprintf("-Xlog:gc:file=%v:uptime,level,tags:filecount=5,filesize=20M", GC_LOG_FILE)
+}
+
+// [12.345s][info][gc] GC(13) Pause Full (G1 Compaction Pause) 3900M->3500M(4096M) 1234.567ms
+var gcLineRegexp = regexp.MustCompile(`GC\(\d+\) Pause (\w+).* (\d+)([KMG])->(\d+)([KMG])\((\d+)([KMG])\)`)
+
+type GcEvent struct {
+	Full      bool
+	Occupancy float64
+}
+
+func ParseGcLine(line string) (GcEvent, bool) {
+	match := gcLineRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return GcEvent{}, false
+	}
+	after, err := ParseSize(match[4] + match[5])
+	if err != nil {
+		return GcEvent{}, false
+	}
+	total, err := ParseSize(match[6] + match[7])
+	if err != nil || total == 0 {
+		return GcEvent{}, false
+	}
+	return GcEvent{
+		Full:      match[1] == "Full",
+		Occupancy: float64(after) * 100 / float64(total),
+	}, true
+}
+
+type GcMonitor struct {
+	Config    GcMonitorConfig
+	fullGcs   []time.Time
+	highSince time.Time
+	warned    time.Time
+}
+
+// Feed accounts a GC event and returns a warning when the heap is under pressure
+func (m *GcMonitor) Feed(event GcEvent, now time.Time) string {
+	cfg := m.Config.withDefaults()
+	var warning string
+	if event.Full {
+		m.fullGcs = append(m.fullGcs, now)
+		cutoff := now.Add(-time.Duration(cfg.Window))
+		for len(m.fullGcs) > 0 && m.fullGcs[0].Before(cutoff) {
+			m.fullGcs = m.fullGcs[1:]
+		}
+		if len(m.fullGcs) > cfg.MaxFullGcs {
+			warning = fmt.Sprintf("%v full GCs within %v", len(m.fullGcs), time.Duration(cfg.Window))
+		}
+	}
+	if event.Occupancy >= cfg.OccupancyThreshold {
+		if m.highSince.IsZero() {
+			m.highSince = now
+		}
+		if now.Sub(m.highSince) >= time.Duration(cfg.SustainedFor) && warning == "" {
+			warning = fmt.Sprintf("heap is %.0f%% full after GC for %v", event.Occupancy, now.Sub(m.highSince).Round(time.Second))
+		}
+	} else {
+		m.highSince = time.Time{}
+	}
+	// Do not repeat warnings more often than the window
+	if warning != "" && now.Sub(m.warned) < time.Duration(cfg.Window) {
+		return ""
+	}
+	if warning != "" {
+		m.warned = now
+	}
+	return warning
+}
+
+// Follows the gc log of the running server, handling rotation by the JVM
+func (s *Server) monitorGcLog(ctx context.Context) {
+	path := filepath.Join(s.Config().WorkDir, GC_LOG_FILE)
+	monitor := GcMonitor{Config: s.Config().GcMonitor}
+	var offset int64
+	// Skip what previous runs have logged
+	if stat, err := os.Stat(path); err == nil {
+		offset = stat.Size()
+	}
+	ticker := time.NewTicker(GC_LOG_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		stat, err := f.Stat()
+		if err == nil && stat.Size() < offset {
+			offset = 0
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			continue
+		}
+		reader := bufio.NewReader(f)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				// Partial line, read it again next time
+				break
+			}
+			offset += int64(len(line))
+			event, ok := ParseGcLine(strings.TrimSpace(line))
+			if !ok {
+				continue
+			}
+			if warning := monitor.Feed(event, time.Now()); warning != "" {
+				s.Notify(EventHeapPressure, s.msg(MsgHeapPressure, warning, s.Config().Memory), "")
+			}
+		}
+		f.Close()
+	}
+}
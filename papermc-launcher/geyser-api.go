@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 )
 
 const GEYSER_API_PROJECT_INFO = "https://download.geysermc.org/v2/projects/%v"
@@ -80,16 +81,8 @@ func GetLatestBuild(id, ver string) (BuildInfo, error) {
 	return info.Builds[len(info.Builds)-1], nil
 }
 
+// LoadGeyser downloads the latest geyser build
 func LoadGeyser(dir string) error {
-	info, err := LoadVersionsInfo()
-	if err != nil {
-		fmt.Printf("[WARN] Failed to read versions info from %v\n", VERSIONS_FILE)
-	}
-	loadDir := dir + "/plugins"
-	ver, ok := info.Plugins["geyser"]
-	if ok {
-		loadDir += "/update"
-	}
 	latestVer, err := GetLatestVersion("geyser")
 	if err != nil {
 		return err
@@ -98,14 +91,37 @@ func LoadGeyser(dir string) error {
 	if err != nil {
 		return err
 	}
-	if ver.Build > 0 && ver.Build == latestBuild.Build {
-		fmt.Println("Already latest build of geyser")
+	return LoadGeyserBuild(dir, latestVer, latestBuild)
+}
+
+// LoadGeyserBuild downloads the build of the version, into plugins/update when geyser is installed
+func LoadGeyserBuild(dir, version string, build BuildInfo) error {
+	unlock, err := LockVersionsInfo(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	info, err := LoadVersionsInfo(dir)
+	if err != nil {
+		warnf("Failed to read versions info from %v", VERSIONS_FILE)
+	}
+	loadDir := filepath.Join(dir, "plugins")
+	ver, ok := info.Plugins["geyser"]
+	if ok {
+		loadDir = filepath.Join(loadDir, "update")
+	}
+	if ver.Build > 0 && ver.Version == version && ver.Build == build.Build {
+		infof("Already latest build of geyser")
 		return nil
 	}
 	platform := "spigot"
-	fmt.Printf("Downloading geyser version %v build #%v for %v", latestVer, latestBuild.Build, platform)
-	checksum := latestBuild.Downloads["spigot"].Sha256
-	url := fmt.Sprintf(GEYSER_API_DOWNLOAD_URL, "geyser", latestVer, latestBuild.Build, platform)
+	infof("Downloading geyser version %v build #%v for %v", version, build.Build, platform)
+	checksum := build.Downloads["spigot"].Sha256
+	url := fmt.Sprintf(GEYSER_API_DOWNLOAD_URL, "geyser", version, build.Build, platform)
+	err = os.MkdirAll(loadDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
 	err = LoadFileIfDoesNotExist(url, loadDir, "Geyser-Spigot.jar", checksum)
 	if err != nil && !os.IsExist(err) {
 		return err
@@ -114,9 +130,9 @@ func LoadGeyser(dir string) error {
 		info.Plugins = make(map[string]VersionInfo)
 	}
 	info.Plugins["geyser"] = VersionInfo{
-		Version: latestVer,
-		Build:   latestBuild.Build,
+		Version: version,
+		Build:   build.Build,
 	}
-	err = DumpVersionsInfo(info)
+	err = DumpVersionsInfo(dir, info)
 	return err
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+const GEYSER_CONFIG_FILE = "plugins/Geyser-Spigot/config.yml"
+
+// Geyser sends the resource and behavior packs found here to Bedrock players
+const GEYSER_PACKS_DIR = "plugins/Geyser-Spigot/packs"
+
+// Settings pushed into Geyser's config.yml so bedrock players can connect right away
+type GeyserConfig struct {
+	Port       int    `json:"port,omitempty"`
+	AuthType   string `json:"auth_type,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// Returns the value node of key in a yaml mapping node
+func yamlChild(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// SetYamlValue sets section.key to value keeping comments. Reports whether the value changed.
+func SetYamlValue(doc *yaml.Node, section, key, value string) (bool, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return false, errors.New("empty yaml document")
+	}
+	parent := yamlChild(doc.Content[0], section)
+	if parent == nil {
+		return false, fmt.Errorf("no %v section", section)
+	}
+	node := yamlChild(parent, key)
+	if node == nil {
+		return false, fmt.Errorf("no %v.%v key", section, key)
+	}
+	if node.Value == value {
+		return false, nil
+	}
+	node.Value = value
+	return true, nil
+}
+
+// ProvisionGeyserConfig patches Geyser's config from the launcher config.
+// Reports whether the file was changed and Geyser needs a reload.
+func ProvisionGeyserConfig(workDir string, cfg GeyserConfig) (bool, error) {
+	path := filepath.Join(workDir, GEYSER_CONFIG_FILE)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return false, fmt.Errorf("error parsing %v: %w", path, err)
+	}
+	type setting struct {
+		section, key, value string
+	}
+	var settings []setting
+	if cfg.Port != 0 {
+		settings = append(settings, setting{"bedrock", "port", strconv.Itoa(cfg.Port)})
+	}
+	if cfg.ServerName != "" {
+		settings = append(settings, setting{"bedrock", "server-name", cfg.ServerName})
+	}
+	if cfg.AuthType != "" {
+		settings = append(settings, setting{"remote", "auth-type", cfg.AuthType})
+	}
+	changed := false
+	for _, s := range settings {
+		updated, err := SetYamlValue(&doc, s.section, s.key, s.value)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || updated
+	}
+	if !changed {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func (s *Server) ProvisionGeyser() error {
+	if s.Config().Geyser == (GeyserConfig{}) {
+		return nil
+	}
+	changed, err := ProvisionGeyserConfig(s.Config().WorkDir, s.Config().Geyser)
+	if errors.Is(err, os.ErrNotExist) {
+		warnf("Geyser config is not generated yet, it will be provisioned on the next start")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if changed {
+		infof("Geyser config updated, reloading Geyser")
+		return s.sendInput(s.runningCtx, "geyser reload")
+	}
+	return nil
+}
@@ -1,3 +1,12 @@
 module papermc-launcher
 
 go 1.23.2
+
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/huin/goupnp v1.3.0
+	github.com/jackpal/gateway v1.0.6
+	github.com/jackpal/go-nat-pmp v1.0.2
+	gopkg.in/yaml.v3 v3.0.1
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+)
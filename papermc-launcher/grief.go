@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_GRIEF_WINDOW = 10 * time.Minute
+
+const DEFAULT_TEMPBAN_DURATION = time.Hour
+
+type GriefAction string
+
+const (
+	GriefAlert   GriefAction = ""
+	GriefKick    GriefAction = "kick"
+	GriefTempban GriefAction = "tempban"
+)
+
+// Alerts on log lines that look like griefing, for example
+//
+//	{"name": "tnt", "pattern": "(\\w+) ignited TNT", "action": "kick"}
+//	{"name": "spawn deaths", "pattern": "^(\\w+) (?:was|died|fell|drowned).* at spawn", "threshold": 5, "window": "10m"}
+//
+// The player is the "player" group of the pattern, or the first group.
+type GriefRule struct {
+	Name    string `json:"name"`
+	Pattern Regexp `json:"pattern"`
+	// Matches of the same player within the window that trigger the rule, 1 by default
+	Threshold int      `json:"threshold,omitempty"`
+	Window    Duration `json:"window,omitempty"`
+	// Taken on the player in addition to the alert
+	Action GriefAction `json:"action,omitempty"`
+	// How long a tempban lasts, an hour by default
+	BanDuration Duration `json:"ban_duration,omitempty"`
+}
+
+type AntiGriefConfig struct {
+	Rules []GriefRule `json:"rules"`
+}
+
+func (c *AntiGriefConfig) Validate() error {
+	if len(c.Rules) == 0 {
+		return errors.New("no rules")
+	}
+	for _, rule := range c.Rules {
+		if rule.Name == "" || rule.Pattern.Regexp == nil {
+			return errors.New("rules need a name and a pattern")
+		}
+		switch rule.Action {
+		case GriefAlert, GriefKick, GriefTempban:
+		default:
+			return fmt.Errorf("rule %v: unknown action %q", rule.Name, rule.Action)
+		}
+	}
+	return nil
+}
+
+// Player named by the line, empty when the pattern has no groups
+func (r GriefRule) Player(line string) (string, bool) {
+	match := r.Pattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	if i := r.Pattern.SubexpIndex("player"); i > 0 {
+		return match[i], true
+	}
+	if len(match) > 1 {
+		return match[1], true
+	}
+	return "", true
+}
+
+// Recent matches by rule and player
+type GriefTracker struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+}
+
+// Hit records a match and reports whether the rule triggers. The count restarts once it does.
+func (t *GriefTracker) Hit(rule GriefRule, player string, at time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hits == nil {
+		t.hits = make(map[string][]time.Time)
+	}
+	window := time.Duration(rule.Window)
+	if window <= 0 {
+		window = DEFAULT_GRIEF_WINDOW
+	}
+	key := rule.Name + "\x00" + strings.ToLower(player)
+	recent := []time.Time{at}
+	for _, hit := range t.hits[key] {
+		if at.Sub(hit) < window {
+			recent = append(recent, hit)
+		}
+	}
+	if len(recent) < max(rule.Threshold, 1) {
+		t.hits[key] = recent
+		return false
+	}
+	delete(t.hits, key)
+	return true
+}
+
+func (s *Server) trackGrief(line string) {
+	if s.Config().AntiGrief == nil {
+		return
+	}
+	now := time.Now()
+	for _, rule := range s.Config().AntiGrief.Rules {
+		player, ok := rule.Player(line)
+		if !ok || !s.grief.Hit(rule, player, now) {
+			continue
+		}
+		s.Notify(EventGrief, s.msg(MsgGriefAlert, rule.Name, player), line)
+		if player == "" {
+			continue
+		}
+		reason := s.msg(MsgGriefReason, rule.Name)
+		switch rule.Action {
+		case GriefKick:
+			s.queue.Push(ConsoleCommand(fmt.Sprintf("kick %v %v", player, reason), OriginLauncher, PriorityAdmin))
+		case GriefTempban:
+			duration := time.Duration(rule.BanDuration)
+			if duration <= 0 {
+				duration = DEFAULT_TEMPBAN_DURATION
+			}
+			s.queue.Push(ConsoleCommand(fmt.Sprintf("ban %v %v", player, reason), OriginLauncher, PriorityAdmin))
+			// Forgotten if the launcher restarts before, pardon by hand then
+			time.AfterFunc(duration, func() {
+				s.queue.Push(ConsoleCommand("pardon "+player, OriginLauncher, PriorityAdmin))
+			})
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How often the scheduler wakes up and pings the heartbeat url
+const HEALTH_CYCLE = 5 * time.Minute
+
+// Ping urls of a dead man's switch service like healthchecks.io
+type HealthchecksConfig struct {
+	// Pinged on every scheduler cycle
+	Heartbeat string `json:"heartbeat,omitempty"`
+	// Pinged after every backup, with /fail appended when it failed
+	Backup string `json:"backup,omitempty"`
+}
+
+// PingHealthcheck reports success or failure (when err is set) to url
+func (s *Server) PingHealthcheck(url string, err error) {
+	if url == "" {
+		return
+	}
+	body := "OK"
+	if err != nil {
+		url = strings.TrimSuffix(url, "/") + "/fail"
+		body = err.Error()
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, pingErr := client.Post(url, "text/plain", strings.NewReader(body))
+	if pingErr != nil {
+		warnf("Healthcheck ping failed: %v", pingErr)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		warnf("Healthcheck ping responded with %v", resp.Status)
+	}
+}
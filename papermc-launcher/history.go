@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+	"sync"
+)
+
+const DEFAULT_HISTORY_LINES = 5000
+
+// Keeps the last lines of the server output in memory
+type LineBuffer struct {
+	mu    sync.Mutex
+	size  int
+	lines []string
+}
+
+func (b *LineBuffer) Add(size int, line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if size <= 0 {
+		size = DEFAULT_HISTORY_LINES
+	}
+	b.size = size
+	b.lines = append(b.lines, line)
+	// Trim lazily so that appending stays amortized O(1)
+	if len(b.lines) > 2*size {
+		b.lines = append([]string(nil), b.lines[len(b.lines)-size:]...)
+	}
+}
+
+// Returns stored lines from the oldest to the newest. Requires the lock.
+func (b *LineBuffer) recent() []string {
+	if len(b.lines) > b.size {
+		return b.lines[len(b.lines)-b.size:]
+	}
+	return b.lines
+}
+
+func (b *LineBuffer) Tail(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := b.recent()
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return append([]string(nil), lines...)
+}
+
+func (b *LineBuffer) Grep(pattern *regexp.Regexp) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var found []string
+	for _, line := range b.recent() {
+		if pattern.MatchString(line) {
+			found = append(found, line)
+		}
+	}
+	return found
+}
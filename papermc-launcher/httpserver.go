@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+const HEALTH_PATH = "/healthz"
+
+const METRICS_PATH = "/metrics"
+
+const PPROF_PATH = "/debug/pprof/"
+
+// How long open requests get to finish once the server shuts down
+const HTTP_SHUTDOWN_TIMEOUT = 5 * time.Second
+
+// serveHTTP serves the handler on the listener until ctx is done
+func serveHTTP(ctx context.Context, name string, listener net.Listener, handler http.Handler) {
+	httpServer := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), HTTP_SHUTDOWN_TIMEOUT)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		err := httpServer.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errorf("%v: %v", name, err)
+		}
+	}()
+}
+
+// authenticated lets requests with the token of a user having at least the role through
+func (s *Server) authenticated(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := s.Config().Authenticate(requestToken(r))
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if user.Role < role {
+			http.Error(w, fmt.Sprintf("requires role %v", role), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// The routes every launcher HTTP server has: health without a token, metrics for viewers
+// and, when enabled, the Go profiler for admins
+func (s *Server) baseMux(withPprof bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc(HEALTH_PATH, s.serveHealth)
+	mux.HandleFunc(METRICS_PATH, s.authenticated(Viewer, s.serveMetrics))
+	if withPprof {
+		mux.HandleFunc(PPROF_PATH, s.authenticated(Admin, pprof.Index))
+		mux.HandleFunc(PPROF_PATH+"cmdline", s.authenticated(Admin, pprof.Cmdline))
+		mux.HandleFunc(PPROF_PATH+"profile", s.authenticated(Admin, pprof.Profile))
+		mux.HandleFunc(PPROF_PATH+"symbol", s.authenticated(Admin, pprof.Symbol))
+		mux.HandleFunc(PPROF_PATH+"trace", s.authenticated(Admin, pprof.Trace))
+	}
+	return mux
+}
+
+// Answers 200 while the server runs or sleeps as scheduled and 503 otherwise,
+// for load balancers and uptime checks
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	state := s.Status()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if state != Running && !s.asleep.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, state)
+}
+
+// Prometheus text exposition of the launcher state
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	report := s.StatusReport()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metric := func(name, help string, value any) {
+		fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v gauge\n%v %v\n", name, help, name, name, value)
+	}
+	boolValue := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	metric("papermc_up", "Whether the server is running.", boolValue(report.State == Running))
+	metric("papermc_asleep", "Whether the server is stopped by the schedule.", boolValue(report.Asleep))
+	metric("papermc_state_since_seconds", "Unix time of the last state change.", report.Since.Unix())
+	metric("papermc_players_online", "Players on the server.", len(report.Players))
+	if backup := report.LastBackup; backup != nil {
+		metric("papermc_last_backup_timestamp_seconds", "Unix time of the last backup.", backup.Time.Unix())
+		metric("papermc_last_backup_duration_seconds", "How long the last backup took.", time.Duration(backup.Duration).Seconds())
+		metric("papermc_last_backup_size_bytes", "Size of the last backup archive.", backup.Size)
+		metric("papermc_last_backup_success", "Whether the last backup succeeded.", boolValue(backup.Error == ""))
+	}
+}
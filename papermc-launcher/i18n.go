@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const DEFAULT_LANGUAGE = "en"
+
+// Keys of the message catalog
+const (
+	MsgClosingSoon       = "closing_soon"
+	MsgClosingNow        = "closing_now"
+	MsgClosesIn          = "closes_in"
+	MsgKickClosed        = "kick_closed"
+	MsgRestartBackup     = "restart_backup"
+	MsgRestartUpdateIn   = "restart_update_in"
+	MsgRestartUpdateNow  = "restart_update_now"
+	MsgRestartRollback   = "restart_rollback"
+	MsgRestartRollbackIn = "restart_rollback_in"
+	MsgTimeLeft          = "time_left"
+	MsgNotClosing        = "not_closing"
+	MsgServerOpen        = "server_open"
+	MsgExternalAddress   = "external_address"
+	MsgServerClosed      = "server_closed"
+	MsgCloseDelayed      = "close_delayed"
+	MsgOpenUntilEmpty    = "open_until_empty"
+	MsgHeldOpen          = "held_open"
+	MsgDailySummary      = "daily_summary"
+	MsgNobodyPlayed      = "nobody_played"
+	MsgPlayedTotal       = "played_total"
+	MsgPlayerJoined      = "player_joined"
+	MsgPlayerLeft        = "player_left"
+	MsgCrashed           = "crashed"
+	MsgExited            = "exited"
+	MsgExitedNoReport    = "exited_no_report"
+	MsgBackupFailed      = "backup_failed"
+	MsgCrashLoop         = "crash_loop"
+	MsgDiskSpaceLow      = "disk_space_low"
+	MsgAutoUpdated       = "auto_updated"
+	MsgAutoUpdateFailed  = "auto_update_failed"
+	MsgUploadFailed      = "upload_failed"
+	MsgBackupGrowth      = "backup_growth"
+	MsgBackupGrowthHint  = "backup_growth_hint"
+	MsgWhitelistMismatch = "whitelist_mismatch"
+	MsgHeapPressure      = "heap_pressure"
+	MsgTpsDropped        = "tps_dropped"
+	MsgProfilerReport    = "profiler_report"
+	MsgStatus            = "status"
+	MsgStatusFor         = "status_for"
+	MsgStatusAsleep      = "status_asleep"
+	MsgStatusPaused      = "status_paused"
+	MsgSchedulePaused    = "schedule_paused"
+	MsgScheduleResumed   = "schedule_resumed"
+	MsgOnline            = "online"
+	MsgAsleep            = "asleep"
+	MsgJoinRequest       = "join_request"
+	MsgJoinApproved      = "join_approved"
+	MsgJoinDenied        = "join_denied"
+	MsgGriefAlert        = "grief_alert"
+	MsgGriefReason       = "grief_reason"
+)
+
+// Messages by language, the arguments are formatted with fmt
+var messageCatalog = map[string]map[string]string{
+	"en": {
+		MsgClosingSoon:       "Server will close soon",
+		MsgClosingNow:        "Server is closing now!",
+		MsgClosesIn:          "Server closes in %v",
+		MsgKickClosed:        "Server is closed",
+		MsgRestartBackup:     "Server restarts for a backup",
+		MsgRestartUpdateIn:   "Server restarts for an update in %v",
+		MsgRestartUpdateNow:  "Server restarts for an update, please log out",
+		MsgRestartRollback:   "Server restarts to restore data of %v",
+		MsgRestartRollbackIn: "Server restarts in %v to restore data of %v",
+		MsgTimeLeft:          "The server closes in %v (at %v)",
+		MsgNotClosing:        "The server is not scheduled to close now",
+		MsgServerOpen:        "Server is open",
+		MsgExternalAddress:   "External address: %v",
+		MsgServerClosed:      "Server is closed",
+		MsgCloseDelayed:      "Close delayed by %v, %v players online",
+		MsgOpenUntilEmpty:    "The server stays open until the last player leaves, at most %v",
+		MsgHeldOpen:          "Server stays open until empty, at most %v, %v players online",
+		MsgDailySummary:      "Daily summary: %v",
+		MsgNobodyPlayed:      "Nobody played today",
+		MsgPlayedTotal:       "%v players, %v played in total:",
+		MsgPlayerJoined:      "%v joined the game",
+		MsgPlayerLeft:        "%v left the game after %v",
+		MsgCrashed:           "Server crashed: %v",
+		MsgExited:            "Server exited unexpectedly",
+		MsgExitedNoReport:    "Server exited unexpectedly, no crash report found",
+		MsgBackupFailed:      "Backup failed",
+		MsgCrashLoop:         "Server crashed %v times within %v, the launcher gives up",
+		MsgDiskSpaceLow:      "Only %v MiB of disk space left (alert below %v MiB)",
+		MsgAutoUpdated:       "Server updated to %v",
+		MsgAutoUpdateFailed:  "Update to %v failed, the previous builds are back: %v",
+		MsgUploadFailed:      "Backup upload failed",
+		MsgBackupGrowth:      "Backup is %.1f times larger than usual (%v MiB)",
+		MsgBackupGrowthHint:  "Check for explored but unused chunks, the world may be sprawling",
+		MsgWhitelistMismatch: "Whitelist change did not apply",
+		MsgHeapPressure:      "Heap pressure: %v. Consider increasing memory (currently %v)",
+		MsgTpsDropped:        "TPS dropped to %.2f (threshold %.2f)",
+		MsgProfilerReport:    "Profiler report (%v): %v",
+		MsgStatus:            "Server is %v",
+		MsgStatusFor:         " for %v",
+		MsgStatusAsleep:      ", asleep outside the open hours",
+		MsgStatusPaused:      "Schedule paused until %v",
+		MsgSchedulePaused:    "Schedule paused until %v, the server will not open, close or back up on its own",
+		MsgScheduleResumed:   "Schedule resumed",
+		MsgOnline:            "Online: %v",
+		MsgAsleep:            "Server is asleep outside the open hours, send wake to start it",
+		MsgJoinRequest:       "%v is not whitelisted and tried to join. Reply /approve %v or /deny %v",
+		MsgJoinApproved:      "%v is approved and can join",
+		MsgJoinDenied:        "Join request of %v is denied",
+		MsgGriefAlert:        "Possible griefing (%v): %v",
+		MsgGriefReason:       "Anti-grief rule %v",
+	},
+	"ru": {
+		MsgClosingSoon:       "Сервер скоро закроется",
+		MsgClosingNow:        "Сервер закрывается!",
+		MsgClosesIn:          "Сервер закроется через %v",
+		MsgKickClosed:        "Сервер закрыт",
+		MsgRestartBackup:     "Сервер перезапускается для резервного копирования",
+		MsgRestartUpdateIn:   "Сервер перезапустится для обновления через %v",
+		MsgRestartUpdateNow:  "Сервер перезапускается для обновления, пожалуйста, выйдите",
+		MsgRestartRollback:   "Сервер перезапускается, чтобы восстановить данные %v",
+		MsgRestartRollbackIn: "Сервер перезапустится через %v, чтобы восстановить данные %v",
+		MsgTimeLeft:          "Сервер закроется через %v (в %v)",
+		MsgNotClosing:        "Сейчас закрытие сервера не запланировано",
+		MsgServerOpen:        "Сервер открыт",
+		MsgExternalAddress:   "Внешний адрес: %v",
+		MsgServerClosed:      "Сервер закрыт",
+		MsgCloseDelayed:      "Закрытие отложено на %v, игроков онлайн: %v",
+		MsgOpenUntilEmpty:    "Сервер открыт, пока не выйдет последний игрок, но не дольше %v",
+		MsgHeldOpen:          "Сервер открыт до выхода игроков, но не дольше %v, игроков онлайн: %v",
+		MsgDailySummary:      "Итоги дня: %v",
+		MsgNobodyPlayed:      "Сегодня никто не играл",
+		MsgPlayedTotal:       "Игроков: %v, всего сыграно %v:",
+		MsgPlayerJoined:      "%v зашёл в игру",
+		MsgPlayerLeft:        "%v вышел из игры через %v",
+		MsgCrashed:           "Сервер упал: %v",
+		MsgExited:            "Сервер неожиданно завершился",
+		MsgExitedNoReport:    "Сервер неожиданно завершился, отчёт о сбое не найден",
+		MsgBackupFailed:      "Резервное копирование не удалось",
+		MsgCrashLoop:         "Сервер упал %v раз за %v, лаунчер останавливается",
+		MsgDiskSpaceLow:      "На диске осталось всего %v МиБ (порог %v МиБ)",
+		MsgAutoUpdated:       "Сервер обновлён: %v",
+		MsgAutoUpdateFailed:  "Обновление %v не удалось, возвращены прежние версии: %v",
+		MsgUploadFailed:      "Не удалось выгрузить резервную копию",
+		MsgBackupGrowth:      "Резервная копия в %.1f раза больше обычной (%v МиБ)",
+		MsgBackupGrowthHint:  "Проверьте исследованные, но неиспользуемые чанки, мир может разрастаться",
+		MsgWhitelistMismatch: "Изменение белого списка не применилось",
+		MsgHeapPressure:      "Нехватка памяти: %v. Увеличьте память (сейчас %v)",
+		MsgTpsDropped:        "TPS упал до %.2f (порог %.2f)",
+		MsgProfilerReport:    "Отчёт профилировщика (%v): %v",
+		MsgStatus:            "Сервер: %v",
+		MsgStatusFor:         " уже %v",
+		MsgStatusAsleep:      ", спит вне часов работы",
+		MsgStatusPaused:      "Расписание приостановлено до %v",
+		MsgSchedulePaused:    "Расписание приостановлено до %v, сервер не будет сам открываться, закрываться и делать бэкапы",
+		MsgScheduleResumed:   "Расписание возобновлено",
+		MsgOnline:            "Онлайн: %v",
+		MsgAsleep:            "Сервер спит вне часов работы, отправьте wake, чтобы запустить его",
+		MsgJoinRequest:       "%v нет в белом списке, игрок пытался зайти. Ответьте /approve %v или /deny %v",
+		MsgJoinApproved:      "%v одобрен и может заходить",
+		MsgJoinDenied:        "Запрос %v на вход отклонён",
+		MsgGriefAlert:        "Похоже на гриферство (%v): %v",
+		MsgGriefReason:       "Сработало правило против гриферства: %v",
+	},
+}
+
+// Message formats the message in the language, falling back to English
+func Message(lang, key string, args ...any) string {
+	format, ok := messageCatalog[lang][key]
+	if !ok {
+		format = messageCatalog[DEFAULT_LANGUAGE][key]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func validateLanguage(lang string) error {
+	if lang == "" {
+		return nil
+	}
+	if _, ok := messageCatalog[lang]; !ok {
+		languages := make([]string, 0, len(messageCatalog))
+		for language := range messageCatalog {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+		return fmt.Errorf("unsupported language %q, use one of %v", lang, strings.Join(languages, ", "))
+	}
+	return nil
+}
+
+// Message in the configured language
+func (s *Server) msg(key string, args ...any) string {
+	return Message(s.Config().Language, key, args...)
+}
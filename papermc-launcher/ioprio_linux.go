@@ -0,0 +1,31 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	IOPRIO_WHO_PROCESS = 1
+	IOPRIO_CLASS_SHIFT = 13
+)
+
+// Sets the IO class of the calling thread, lock the goroutine to its thread first
+func setThreadIOClass(class string) error {
+	var prio uintptr
+	switch class {
+	case "best-effort":
+		prio = 2<<IOPRIO_CLASS_SHIFT | 7
+	case "idle":
+		prio = 3 << IOPRIO_CLASS_SHIFT
+	default:
+		return fmt.Errorf("unknown io class %q", class)
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, IOPRIO_WHO_PROCESS, uintptr(syscall.Gettid()), prio)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func setThreadIOClass(class string) error {
+	return errors.New("io priorities are only available on linux")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Values of server.properties saved while the server runs in LAN mode
+const LAN_MODE_STATE_FILE = "lan-mode.json"
+
+// Without internet the players can not be authenticated with Mojang, so the
+// server switches to offline mode. Offline players get different uuids, the
+// whitelist entries do not match them and the whitelist is turned off,
+// which is only acceptable while the server is not reachable from outside.
+var lanModeProperties = map[string]string{
+	"online-mode":            "false",
+	"enforce-secure-profile": "false",
+	"white-list":             "false",
+	"enforce-whitelist":      "false",
+}
+
+// Minecraft defaults, restored when a property was missing before LAN mode
+var lanModeDefaults = map[string]string{
+	"online-mode":            "true",
+	"enforce-secure-profile": "true",
+	"white-list":             "false",
+	"enforce-whitelist":      "false",
+}
+
+// Applies or reverts LAN mode in server.properties, must be called while the server is stopped
+func (s *Server) applyLanMode() error {
+	statePath := filepath.Join(s.Config().WorkDir, LAN_MODE_STATE_FILE)
+	_, err := os.Stat(statePath)
+	active := err == nil
+	if s.Config().LanMode == active {
+		return nil
+	}
+	if s.Config().LanMode {
+		props, err := ReadServerProperties(s.Config().WorkDir)
+		if err != nil {
+			return err
+		}
+		saved := make(map[string]string)
+		for key := range lanModeProperties {
+			if value, ok := props[key]; ok {
+				saved[key] = value
+			}
+		}
+		if err := writeJSON(statePath, saved); err != nil {
+			return err
+		}
+		if _, err := SetServerProperties(s.Config().WorkDir, lanModeProperties); err != nil {
+			return err
+		}
+		warnf("LAN mode: online-mode and the whitelist are off, anyone who can reach the server may join")
+		return nil
+	}
+	var saved map[string]string
+	content, err := os.ReadFile(statePath)
+	if err == nil {
+		err = json.Unmarshal(content, &saved)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %v: %w", LAN_MODE_STATE_FILE, err)
+	}
+	restore := make(map[string]string)
+	for key, value := range lanModeDefaults {
+		restore[key] = value
+		if value, ok := saved[key]; ok {
+			restore[key] = value
+		}
+	}
+	if _, err := SetServerProperties(s.Config().WorkDir, restore); err != nil {
+		return err
+	}
+	infof("LAN mode is off, online-mode and the whitelist are restored")
+	return os.Remove(statePath)
+}
+
+// SetLanMode switches LAN mode and restarts the server to apply it
+func (s *Server) SetLanMode(ctx context.Context, enable bool) error {
+	if enable && s.Config().PortMapping.Enabled {
+		return errors.New("disable port_mapping first, LAN mode must not be reachable from the internet")
+	}
+	if s.cmdCtx != nil {
+		if err := s.Stop(); err != nil {
+			return err
+		}
+	}
+	s.updateConfig(func(config *Config) { config.LanMode = enable })
+	return s.Start(ctx)
+}
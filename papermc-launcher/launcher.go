@@ -7,32 +7,53 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
-	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func BackupFolder(dir string) error {
-	bakName := fmt.Sprintf("%v-backup-%v.tar.bz2", dir, time.Now().Format("2006-01-02_15-04_MST"))
-	fmt.Printf("Backing up folder %v to %v\n", dir, bakName)
-	bakCmd := exec.Command("tar", "-cvjf", bakName, "./"+dir)
-	err := bakCmd.Run()
-	if err != nil {
-		return fmt.Errorf("%v\nstderr: %v", err, err.(*exec.ExitError).Stderr)
-	}
-	return nil
-}
-
 type ListenRequest struct {
-	query    string
+	query string
+	// Done of the requester's context, the request is dropped once it is closed
+	done     <-chan struct{}
 	accepted chan struct{}
 	found    chan string
 }
 
+// Whether the requester stopped waiting
+func (r ListenRequest) abandoned() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Delivers the line to the requests waiting for it and returns the ones still waiting
+func matchPending(pending []ListenRequest, text string) []ListenRequest {
+	remaining := pending[:0]
+	for _, req := range pending {
+		if req.abandoned() {
+			continue
+		}
+		if strings.Contains(text, req.query) {
+			req.found <- text
+		} else {
+			remaining = append(remaining, req)
+		}
+	}
+	return remaining
+}
+
 type InnerCmd int
 
 const (
@@ -40,19 +61,98 @@ const (
 	CloseAccess
 	OpenAccess
 	Warn
+	ReconcileOps
+	ColdBackupCmd
+	ProvisionGeyser
+	EnableDatapacks
+	Sleep
+	Wake
+	AutoUpdate
+	// The update countdown is over
+	UpdateDue
 )
 
+func (c InnerCmd) String() string {
+	switch c {
+	case Backup:
+		return "backup"
+	case CloseAccess:
+		return "close-access"
+	case OpenAccess:
+		return "open-access"
+	case Warn:
+		return "warn"
+	case ReconcileOps:
+		return "reconcile-ops"
+	case ColdBackupCmd:
+		return "cold-backup"
+	case ProvisionGeyser:
+		return "provision-geyser"
+	case EnableDatapacks:
+		return "enable-datapacks"
+	case Sleep:
+		return "sleep"
+	case Wake:
+		return "wake"
+	case AutoUpdate:
+		return "auto-update"
+	case UpdateDue:
+		return "update-due"
+	default:
+		return fmt.Sprintf("InnerCmd(%d)", int(c))
+	}
+}
+
 type Server struct {
-	Config        *Config
+	// Replaced as a whole by reload-config, read it through Config()
+	config        atomic.Pointer[Config]
+	ConfigPath    string
 	cmdCtx        context.Context
 	runningCtx    context.Context
 	contextCancel context.CancelFunc
 	Cmd           *exec.Cmd
+	startedAt     time.Time
 	WaitWorkers   sync.WaitGroup
 	requestsPipe  chan ListenRequest
 	inputsPipe    chan string
 	outputsPipe   chan string
-	innerCmds     chan InnerCmd
+	queue         CommandQueue
+	audit         AuditTrail
+	output        OutputBroadcaster
+	filters       LogFilters
+	history       LineBuffer
+	chatBridge    ChatBridge
+	joinRequests  JoinRequests
+	grief         GriefTracker
+	notifyLimiter NotifyLimiter
+	notifications NotifyQueue
+	// Only touched by the command loop
+	countdown  *pendingCountdown
+	sessions   PlayerSessions
+	profiling  atomic.Bool
+	stateMu    sync.Mutex
+	state      ServerState
+	stateSince time.Time
+	ports      PortMapper
+	// Set while a close waits for the players to finish
+	closeDelayed bool
+	// End of the hard cap while the server is open until empty
+	holdUntil   time.Time
+	holdTimer   *time.Timer
+	holdingOpen atomic.Bool
+	// The process is stopped outside the open hours
+	asleep atomic.Bool
+	// Set while stage-update prepares the staging copy
+	staging atomic.Bool
+	// Set by !pause-schedule, scheduled actions are skipped until then
+	pausedUntil atomic.Pointer[time.Time]
+	pauseTimer  *time.Timer
+	// Index+1 of the applied distance tuning step, 0 after a start
+	distanceStep atomic.Int32
+	// Whether the disk alert has fired and the space has not recovered yet
+	diskLow atomic.Bool
+	// Replaces the java executable, tests run a fake server this way
+	javaCommand []string
 }
 
 func (s *Server) startIOListeners(ctx context.Context) error {
@@ -73,7 +173,7 @@ func (s *Server) startIOListeners(ctx context.Context) error {
 	go func(ctx context.Context, steamIn io.WriteCloser, pipeIn chan string) {
 		defer s.WaitWorkers.Done()
 		defer streamIn.Close()
-		defer fmt.Println("Input writer: done")
+		defer infof("Input writer: done")
 		for {
 			select {
 			case input := <-pipeIn:
@@ -92,35 +192,110 @@ func (s *Server) startIOListeners(ctx context.Context) error {
 		for scanner.Scan() {
 			pipeOut <- scanner.Text()
 		}
-		fmt.Println("Output reader: done")
+		infof("Output reader: done")
 	}(streamOut, s.outputsPipe)
 
 	go func(streamErr io.ReadCloser) {
 		defer s.WaitWorkers.Done()
-		redColor := "\033[31m"
-		resetColor := "\033[0m"
-
 		scanner := bufio.NewScanner(streamErr)
 		for scanner.Scan() {
-			// Color the stderr output in red
-			fmt.Printf("[%vError%v]: %v\n", redColor, resetColor, scanner.Text())
+			slog.Error(scanner.Text())
+			s.output.Publish("[Error]: " + scanner.Text())
 		}
-		fmt.Println("StdErr reader: done")
+		infof("StdErr reader: done")
 	}(streamErr)
 	return nil
 }
 
+// Prints a line of server output and hands it to the remote consoles
+func (s *Server) handleOutput(text string) {
+	s.history.Add(s.Config().HistoryLines, text)
+	if player, message, ok := ParseChatLine(text); ok {
+		s.chatBridge.OnChat(player, message)
+		s.handleChatCommand(player, message)
+	}
+	s.trackSessions(text)
+	s.trackJoinRequests(text)
+	s.trackGrief(text)
+	if s.filters.Show(s.Config().LogFilters, text) {
+		slog.Info(text)
+	}
+	s.output.Publish(text)
+}
+
+// Prints a launcher response to the console and the remote consoles
+func (s *Server) reply(text string) {
+	slog.Info(text)
+	s.output.Publish(text)
+}
+
 func (s *Server) IsStarted() bool {
-	return s.cmdCtx != nil && s.cmdCtx.Err() != nil
+	return s.Status() != Stopped
+}
+
+func (s *Server) javaArgs() []string {
+	java := []string{"java"}
+	if s.Config().Java.Path != "" {
+		java = []string{s.Config().Java.Path}
+	}
+	if len(s.javaCommand) > 0 {
+		java = s.javaCommand
+	}
+	args := append(slices.Clone(java), "-Xms"+s.Config().Memory, "-Xmx"+s.Config().Memory, "-XX:+UseG1GC", "-XX:+ParallelRefProcEnabled")
+	if s.Config().GcMonitor.Enabled {
+		args = append(args, s.Config().GcMonitor.JvmFlag())
+	}
+	args = append(args, s.Config().Java.JvmArgs...)
+	args = append(args, "-jar", "paper.jar", "nogui")
+	return append(args, s.Config().Java.ServerArgs...)
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	if s.IsStarted() {
+	if s.cmdCtx != nil {
 		return fmt.Errorf("Already started")
 	}
-	fmt.Println("Starting process")
-	s.Cmd = exec.Command("java", "-Xms"+s.Config.Memory, "-Xmx"+s.Config.Memory, "-XX:+UseG1GC", "-XX:+ParallelRefProcEnabled", "-jar", "paper.jar", "nogui")
-	s.Cmd.Dir = s.Config.WorkDir
+	if err := s.transition(Starting); err != nil {
+		return err
+	}
+	java := s.javaArgs()[0]
+	if _, err := exec.LookPath(java); err != nil {
+		s.transition(Stopped)
+		return fmt.Errorf("%w: %w", ErrJavaMissing, err)
+	}
+	if err := s.applyLanMode(); err != nil {
+		s.transition(Stopped)
+		return fmt.Errorf("error applying LAN mode: %w", err)
+	}
+	if err := s.applyResourcePack(); err != nil {
+		warnf("Failed to set up the resource pack: %v", err)
+	}
+	s.checkFoliaPlugins()
+	infof("Starting process")
+	limits := s.Config().Limits
+	cgroupDir := ""
+	fallback := false
+	if limits.NeedsCgroup() {
+		var err error
+		cgroupDir, err = prepareCgroup(limits)
+		if err != nil {
+			warnf("Can not apply cgroup limits: %v. Falling back to nice/ionice", err)
+			fallback = true
+		}
+	}
+	if s.Config().GcMonitor.Enabled {
+		// The JVM does not create the directory for its log file
+		os.MkdirAll(filepath.Join(s.Config().WorkDir, "logs"), os.ModePerm)
+	}
+	args := wrapWithPriority(s.javaArgs(), limits, fallback)
+	s.Cmd = exec.Command(args[0], args[1:]...)
+	s.Cmd.Dir = s.Config().WorkDir
+	if len(s.Config().Java.Env) > 0 {
+		s.Cmd.Env = os.Environ()
+		for key, value := range s.Config().Java.Env {
+			s.Cmd.Env = append(s.Cmd.Env, key+"="+value)
+		}
+	}
+	s.startedAt = time.Now()
 	cmdCtx, cancel := context.WithCancel(ctx)
 	s.cmdCtx = cmdCtx
 	s.contextCancel = cancel
@@ -129,49 +304,54 @@ func (s *Server) Start(ctx context.Context) error {
 	var err error
 	err = s.startIOListeners(s.runningCtx)
 	if err != nil {
+		cancelRunning()
+		cancel()
+		s.cmdCtx = nil
+		s.transition(Stopped)
 		return err
 	}
+	err = s.Cmd.Start()
+	if err != nil {
+		cancelRunning()
+		cancel()
+		s.cmdCtx = nil
+		s.transition(Stopped)
+		return err
+	}
+	if cgroupDir != "" {
+		if err := joinCgroup(cgroupDir, s.Cmd.Process.Pid); err != nil {
+			warnf("Failed to move the server into cgroup %v: %v", cgroupDir, err)
+		}
+	}
 	go func() {
-		err := s.Cmd.Run()
+		err := s.Cmd.Wait()
 		if err != nil {
-			fmt.Println(err)
+			warnf("Server process exited: %v", err)
 		}
+		s.sessions.LeaveAll(time.Now())
 		cancelRunning()
+		s.transition(Stopped)
 	}()
 	// Start listening Worker
 	s.WaitWorkers.Add(1)
 	go func(ctx context.Context) {
 		defer s.WaitWorkers.Done()
-		defer fmt.Println("Output analyzer: done")
-		var reqPtr *ListenRequest
+		defer infof("Output analyzer: done")
+		var pending []ListenRequest
 		for {
-			if reqPtr != nil {
-				select {
-				case text, ok := <-s.outputsPipe:
-					if !ok {
-						return
-					}
-					if strings.Contains(text, reqPtr.query) {
-						reqPtr.found <- text
-						reqPtr = nil
-					}
-					fmt.Println(text)
-				case <-ctx.Done():
-					return
-				}
-			} else {
-				select {
-				case text, ok := <-s.outputsPipe:
-					if !ok {
-						return
-					}
-					fmt.Println(text)
-				case req := <-s.requestsPipe:
-					reqPtr = &req
-					reqPtr.accepted <- struct{}{}
-				case <-ctx.Done():
+			select {
+			case text, ok := <-s.outputsPipe:
+				if !ok {
 					return
 				}
+				pending = matchPending(pending, text)
+				s.handleOutput(text)
+			case req := <-s.requestsPipe:
+				// The server may stay quiet for long, do not wait for a line to prune
+				pending = append(slices.DeleteFunc(pending, ListenRequest.abandoned), req)
+				req.accepted <- struct{}{}
+			case <-ctx.Done():
+				return
 			}
 		}
 	}(runningCtx)
@@ -180,86 +360,287 @@ func (s *Server) Start(ctx context.Context) error {
 	s.WaitWorkers.Add(1)
 	go func(ctx context.Context) {
 		defer s.WaitWorkers.Done()
-		defer fmt.Println("Scheduler: done")
+		defer infof("Scheduler: done")
 		timer := time.NewTimer(time.Hour)
+		var announced *time.Time
 		for {
-			nextCommand := Backup
-			loc := time.Location(s.Config.AccessSchedule.Timezone)
-			now := time.Now().In(&loc)
-			midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, &loc)
-			var nextTime *time.Time
-			for _ = range 8 {
-				weekday := Weekday(midnight.Weekday())
-				schedule, ok := s.Config.AccessSchedule.DaysSchedule[weekday]
-				if ok {
-					startTime := midnight.Add(schedule.Start.Duration())
-					if (nextTime == nil || startTime.Before(*nextTime)) && now.Before(startTime) {
-						nextTime = &startTime
-						nextCommand = OpenAccess
-					}
-					endTime := midnight.Add(schedule.End.Duration())
-					for _, offset := range s.Config.WarnBefore {
-						warnTime := endTime.Add(-time.Duration(offset))
-						if (nextTime == nil || warnTime.Before(*nextTime)) && now.Before(warnTime) {
-							nextTime = &warnTime
-							nextCommand = Warn
-						}
-					}
-					if (nextTime == nil || endTime.Before(*nextTime)) && now.Before(endTime) {
-						nextTime = &endTime
-						nextCommand = CloseAccess
-					}
-				} else {
-					fmt.Println("No schedule for day %v", time.Weekday(weekday))
+			nextTime, nextCommand := s.nextScheduled(time.Now())
+			go s.PingHealthcheck(s.Config().Healthchecks.Heartbeat, nil)
+			s.checkDiskSpace()
+			wait := time.Hour
+			if nextTime == nil {
+				if announced == nil || !announced.IsZero() {
+					infof("Nothing is scheduled for the next week!")
+					announced = &time.Time{}
 				}
-				if time.Weekday(weekday) == time.Monday {
-					bakTime := midnight.Add(time.Hour * 5)
-					if (nextTime == nil || bakTime.Before(*nextTime)) && now.Before(bakTime) {
-						nextTime = &bakTime
-						nextCommand = Backup
-					}
+			} else {
+				if announced == nil || !nextTime.Equal(*announced) {
+					infof("Scheduled %v at %v", nextCommand, nextTime.Format("2006-01-02 at 15:04 MST"))
+					announced = nextTime
 				}
-				midnight = midnight.Add(time.Hour * 24)
+				wait = time.Until(*nextTime)
 			}
-			if nextTime == nil {
-				fmt.Println("Nothing is scheduled for the next week!")
-				timer.Reset(time.Hour)
-			} else {
-				fmt.Printf("Scheduled %v at %v\n", nextCommand, nextTime.Format("2006-01-02 at 15:04 MST"))
-				timer.Reset(time.Until(*nextTime))
+			// Wake up regularly so the heartbeat proves the scheduler is alive
+			if wait > HEALTH_CYCLE {
+				wait = HEALTH_CYCLE
 			}
+			timer.Reset(wait)
 			select {
 			case <-ctx.Done():
 				return
 			case t := <-timer.C:
-				if nextTime != nil {
-					fmt.Printf("[%v Scheduler]: sending command %v\n", t.Format("Jan 02 15:04"), nextCommand)
-					s.innerCmds <- nextCommand
+				if nextTime != nil && !time.Now().Before(*nextTime) {
+					infof("[%v Scheduler]: sending command %v", t.Format("Jan 02 15:04"), nextCommand)
+					s.queue.Push(InnerCommand(nextCommand, OriginSchedule))
 				}
 			}
 		}
 	}(cmdCtx)
 
+	if s.Config().GcMonitor.Enabled {
+		s.WaitWorkers.Add(1)
+		go func(ctx context.Context) {
+			defer s.WaitWorkers.Done()
+			s.monitorGcLog(ctx)
+		}(runningCtx)
+	}
+
+	if len(s.Config().Announcements) > 0 {
+		s.WaitWorkers.Add(1)
+		go func(ctx context.Context) {
+			defer s.WaitWorkers.Done()
+			s.runAnnouncements(ctx)
+		}(runningCtx)
+	}
+
+	if s.Config().TpsAlert != nil {
+		s.WaitWorkers.Add(1)
+		go func(ctx context.Context) {
+			defer s.WaitWorkers.Done()
+			s.monitorTps(ctx)
+		}(runningCtx)
+	}
+
+	// Mark the server running and reconcile operators once it is ready
+	s.WaitWorkers.Add(1)
+	go func(ctx context.Context) {
+		defer s.WaitWorkers.Done()
+		if _, err := s.WaitFor(ctx, "Done ("); err != nil {
+			return
+		}
+		s.transitionFrom(Starting, Running)
+		s.distanceStep.Store(0)
+		s.tuneDistances()
+		s.queue.Push(InnerCommand(ReconcileOps, OriginLauncher))
+		s.queue.Push(InnerCommand(ProvisionGeyser, OriginLauncher))
+		s.queue.Push(InnerCommand(EnableDatapacks, OriginLauncher))
+	}(runningCtx)
+
+	return nil
+}
+
+// Expect registers interest in the next server output line containing query.
+// The line is delivered to the returned channel.
+func (s *Server) Expect(ctx context.Context, query string) (<-chan string, error) {
+	notify := make(chan struct{}, 1)
+	find := make(chan string, 1)
+	select {
+	case s.requestsPipe <- ListenRequest{query: query, done: ctx.Done(), accepted: notify, found: find}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case <-notify:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return find, nil
+}
+
+// WaitFor blocks until the server outputs a line containing query and returns that line.
+func (s *Server) WaitFor(ctx context.Context, query string) (string, error) {
+	find, err := s.Expect(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case line := <-find:
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Query sends a command to the server and waits for the response line containing query
+func (s *Server) Query(ctx context.Context, command, query string) (string, error) {
+	find, err := s.Expect(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	if err := s.sendInput(ctx, command); err != nil {
+		return "", err
+	}
+	select {
+	case line := <-find:
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// How long SendBatch waits for the feedback of a single command
+const COMMAND_ACK_TIMEOUT = 5 * time.Second
+
+// SendBatch sends the commands one by one, each after the server printed
+// feedback for the previous one, so a busy server does not drop any.
+// A command without feedback is reported and the batch goes on.
+func (s *Server) SendBatch(ctx context.Context, commands []string) error {
+	for _, command := range commands {
+		ackCtx, cancel := context.WithTimeout(ctx, COMMAND_ACK_TIMEOUT)
+		// Any line is taken as the feedback, console commands are processed in order
+		_, err := s.Query(ackCtx, command, "")
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			warnf("No feedback for %q: %v", command, err)
+		}
+	}
 	return nil
 }
 
-func (s *Server) Backup() error {
-	notify := make(chan struct{})
-	find := make(chan string)
-	s.requestsPipe <- ListenRequest{query: "Automatic saving is now disabled", accepted: notify, found: find}
-	<-notify
-	s.inputsPipe <- "save-off"
-	<-find
-	s.requestsPipe <- ListenRequest{query: "Saved the game", accepted: notify, found: find}
-	<-notify
-	s.inputsPipe <- "save-all"
-	<-find
-	err := BackupFolder(s.Config.WorkDir)
-	time.Sleep(200 * time.Millisecond)
-	s.requestsPipe <- ListenRequest{query: "Automatic saving is now enabled", accepted: notify, found: find}
-	<-notify
-	s.inputsPipe <- "save-on"
-	<-find
+func (s *Server) sendInput(ctx context.Context, input string) error {
+	select {
+	case s.inputsPipe <- input:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func NewServer(config *Config, configPath string) *Server {
+	s := &Server{ConfigPath: configPath, requestsPipe: make(chan ListenRequest)}
+	s.config.Store(config)
+	return s
+}
+
+// Config is the current config. It is never changed in place, a caller keeps a consistent
+// snapshot while reload-config swaps in a new one.
+func (s *Server) Config() *Config {
+	return s.config.Load()
+}
+
+// updateConfig swaps in a copy of the config with the change applied. Slices of the copy
+// are shared with the old config, change has to replace them instead of writing into them.
+func (s *Server) updateConfig(change func(config *Config)) {
+	for {
+		old := s.config.Load()
+		config := *old
+		change(&config)
+		if s.config.CompareAndSwap(old, &config) {
+			return
+		}
+	}
+}
+
+func (s *Server) ReloadConfig() error {
+	config, err := LoadConfig(s.ConfigPath)
+	if err != nil {
+		return err
+	}
+	if config.WorkDir != s.Config().WorkDir {
+		warnf("work_dir change requires a restart of the launcher")
+		config.WorkDir = s.Config().WorkDir
+	}
+	s.config.Store(&config)
+	return s.ReconcileOps()
+}
+
+// How long to wait for the server to acknowledge each save command
+const SAVE_COMMAND_TIMEOUT = 5 * time.Minute
+
+func (s *Server) Backup(trigger string) error {
+	started := time.Now()
+	bakName, err := s.hotBackup(trigger)
+	if err == nil {
+		// Verify after autosave is back on, reading the archive may take a while
+		err = VerifyAndReport(bakName)
+	}
+	s.reportBackup(trigger, started, bakName, err)
+	return err
+}
+
+// Pings the backup healthcheck, records the run, notifies about failures and uploads good backups
+func (s *Server) reportBackup(trigger string, started time.Time, archive string, err error) {
+	go s.PingHealthcheck(s.Config().Healthchecks.Backup, err)
+	s.checkDiskSpace()
+	s.recordBackupRun(trigger, started, archive, err)
+	if err != nil {
+		s.Notify(EventBackupFailed, s.msg(MsgBackupFailed), err.Error())
+		return
+	}
+	if len(s.Config().Backup.Targets) > 0 {
+		go s.uploadBackup(archive)
+	}
+}
+
+// Archives the work dir while the server is running with autosave turned off
+func (s *Server) hotBackup(trigger string) (string, error) {
+	if !s.transitionFrom(Running, BackingUp) {
+		return "", fmt.Errorf("can not back up, server is %v", s.Status())
+	}
+	defer s.transitionFrom(BackingUp, Running)
+	for _, command := range s.Config().Backup.PauseCommands {
+		if err := s.sendInput(s.runningCtx, command); err != nil {
+			return "", err
+		}
+	}
+	defer func() {
+		for _, command := range s.Config().Backup.ResumeCommands {
+			s.sendInput(s.runningCtx, command)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(s.runningCtx, SAVE_COMMAND_TIMEOUT)
+	defer cancel()
+	if _, err := s.Query(ctx, "save-off", "Automatic saving is now disabled"); err != nil {
+		return "", fmt.Errorf("error disabling autosave: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(s.runningCtx, SAVE_COMMAND_TIMEOUT)
+		defer cancel()
+		if _, err := s.Query(ctx, "save-on", "Automatic saving is now enabled"); err != nil {
+			errorf("Failed to enable autosave back: %v", err)
+		}
+	}()
+	// With flush the confirmation is printed only after all chunks are written to disk
+	if _, err := s.Query(ctx, "save-all flush", "Saved the game"); err != nil {
+		return "", fmt.Errorf("error saving the world: %w", err)
+	}
+	return BackupFolder(s.Config().WorkDir, trigger, HotBackup, s.Config().Backup.Throttle)
+}
+
+// Stops the server, archives the work dir and starts the server again
+func (s *Server) ColdBackup(ctx context.Context, trigger string) error {
+	started := time.Now()
+	s.say(s.runningCtx, s.msg(MsgRestartBackup))
+	time.Sleep(5 * time.Second)
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	if !s.transitionFrom(Stopped, BackingUp) {
+		return fmt.Errorf("can not back up, server is %v", s.Status())
+	}
+	bakName, err := BackupFolder(s.Config().WorkDir, trigger, ColdBackup, nil)
+	s.transition(Stopped)
+	if startErr := s.Start(ctx); startErr != nil {
+		return startErr
+	}
+	if err == nil {
+		err = VerifyAndReport(bakName)
+	}
+	s.reportBackup(trigger, started, bakName, err)
 	return err
 }
 
@@ -268,84 +649,393 @@ func (s *Server) Stop() error {
 		return fmt.Errorf("Already stopped.")
 	}
 	if s.runningCtx.Err() == nil {
+		if err := s.transition(Stopping); err != nil {
+			return err
+		}
 		s.inputsPipe <- "stop"
 		<-s.runningCtx.Done()
-		fmt.Println("Cmd finished successfuly!")
+		infof("Cmd finished successfuly!")
 	}
 	s.contextCancel()
 	s.WaitWorkers.Wait()
 	s.Cmd = nil
 	s.cmdCtx = nil
 	s.contextCancel = nil
+	s.transition(Stopped)
 	return nil
 }
 
-func (s *Server) Run() error {
-	runCtx, cancelRun := context.WithCancel(context.Background())
-	err := s.Start(runCtx)
-	if err != nil {
-		return err
+// nextScheduled finds the first scheduled command after now within the next week
+func (s *Server) nextScheduled(now time.Time) (*time.Time, InnerCmd) {
+	nextCommand := Backup
+	loc := time.Location(s.Config().AccessSchedule.Timezone)
+	now = now.In(&loc)
+	day := now
+	var nextTime *time.Time
+	for _ = range 8 {
+		weekday := Weekday(day.Weekday())
+		schedule, ok := s.Config().AccessSchedule.DaysSchedule[weekday]
+		if ok {
+			startTime := schedule.Start.On(day)
+			if s.Config().Sleep != nil {
+				wakeTime := startTime.Add(-s.Config().Sleep.warmUp())
+				if (nextTime == nil || wakeTime.Before(*nextTime)) && now.Before(wakeTime) {
+					nextTime = &wakeTime
+					nextCommand = Wake
+				}
+			}
+			if (nextTime == nil || startTime.Before(*nextTime)) && now.Before(startTime) {
+				nextTime = &startTime
+				nextCommand = OpenAccess
+			}
+			endTime := schedule.End.On(day)
+			for _, offset := range schedule.Warnings(s.Config().WarnBefore) {
+				warnTime := endTime.Add(-time.Duration(offset))
+				if (nextTime == nil || warnTime.Before(*nextTime)) && now.Before(warnTime) {
+					nextTime = &warnTime
+					nextCommand = Warn
+				}
+			}
+			if (nextTime == nil || endTime.Before(*nextTime)) && now.Before(endTime) {
+				nextTime = &endTime
+				nextCommand = CloseAccess
+			}
+		}
+		for _, entry := range s.Config().Backup.Entries() {
+			if entry.Day != weekday {
+				continue
+			}
+			bakTime := entry.Time.On(day)
+			if (nextTime == nil || bakTime.Before(*nextTime)) && now.Before(bakTime) {
+				nextTime = &bakTime
+				nextCommand = Backup
+				if entry.Mode == ColdBackup {
+					nextCommand = ColdBackupCmd
+				}
+			}
+		}
+		if cfg := s.Config().AutoUpdate; cfg != nil && cfg.Day == weekday {
+			updateTime := cfg.Start.On(day)
+			if (nextTime == nil || updateTime.Before(*nextTime)) && now.Before(updateTime) {
+				nextTime = &updateTime
+				nextCommand = AutoUpdate
+			}
+		}
+		// Calendar days, 24 hours would drift by the DST change
+		day = day.AddDate(0, 0, 1)
 	}
-	defer cancelRun()
+	return nextTime, nextCommand
+}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		<-c
-		cancelRun()
-	}()
+func (s *Server) handleInnerCmd(runCtx context.Context, cmd InnerCmd) {
+	switch cmd {
+	case Backup:
+		err := s.Backup(TriggerSchedule)
+		if err != nil {
+			errorf("Backup failed: %v", err)
+		}
+	case CloseAccess:
+		{
+			online, err := s.OnlineCount(runCtx)
+			if err != nil {
+				warnf("Failed to get online players: %v", err)
+			}
+			if s.holdOpen(online, time.Now()) {
+				break
+			}
+			held := !s.holdUntil.IsZero()
+			s.releaseHold()
+			grace := time.Duration(s.Config().CloseGrace)
+			if online > 0 && grace > 0 && !s.closeDelayed && !held {
+				s.closeDelayed = true
+				s.say(runCtx, s.msg(MsgClosesIn, countdownString(grace)))
+				s.Notify(EventCloseDelayed, s.msg(MsgCloseDelayed, grace, online), "")
+				time.AfterFunc(grace, func() {
+					s.queue.Push(InnerCommand(CloseAccess, OriginSchedule))
+				})
+				break
+			}
+			s.closeDelayed = false
+			infof("Closing server")
+			// Nobody to warn on an empty server
+			if online != 0 {
+				s.say(runCtx, s.msg(MsgClosingNow))
+				time.Sleep(time.Second * 5)
+			}
+			if err := s.SetWhitelisted(runCtx, s.Config().Players, false); err != nil {
+				errorf("%v", err)
+			}
+			if online != 0 {
+				var kicks []string
+				for _, player := range s.Config().Players {
+					kicks = append(kicks, fmt.Sprintf("kick %v %v", player.ServerName(), s.msg(MsgKickClosed)))
+				}
+				s.SendBatch(runCtx, kicks)
+			}
+			if s.Config().PortMapping.Enabled {
+				if err := s.ports.Close(); err != nil {
+					warnf("Failed to remove port mappings: %v", err)
+				}
+			}
+			s.setBedrockBlocked(true)
+			s.Notify(EventScheduleClose, s.msg(MsgServerClosed), "")
+			s.Notify(EventDailySummary, s.msg(MsgDailySummary, s.sessions.Summary(s.Config().Language, time.Now())), "")
+			if s.Config().Sleep != nil {
+				s.queue.Push(InnerCommand(Sleep, OriginSchedule))
+			}
+		}
+	case OpenAccess:
+		{
+			infof("Opening server")
+			if err := s.SetWhitelisted(runCtx, s.Config().Players, true); err != nil {
+				errorf("%v", err)
+			}
+			s.setBedrockBlocked(false)
+			message := s.msg(MsgServerOpen)
+			if !s.Config().PortMapping.Enabled {
+				s.Notify(EventScheduleOpen, message, "")
+				break
+			}
+			// Discovering the router must not hold up the command loop
+			go func(cfg PortMappingConfig) {
+				ip, err := s.ports.Open(cfg)
+				if err != nil {
+					warnf("Port mapping failed: %v", err)
+				}
+				if ip != "" {
+					message += ". " + s.msg(MsgExternalAddress, ip)
+				}
+				s.Notify(EventScheduleOpen, message, "")
+			}(s.Config().PortMapping)
+		}
+	case Warn:
+		online, err := s.OnlineCount(runCtx)
+		if err != nil {
+			warnf("Failed to get online players: %v", err)
+		}
+		if online != 0 {
+			s.say(runCtx, s.msg(MsgClosingSoon))
+		} else {
+			infof("Warn not issued")
+		}
+	case ColdBackupCmd:
+		err := s.ColdBackup(runCtx, TriggerSchedule)
+		if err != nil {
+			errorf("Backup failed: %v", err)
+		}
+	case ReconcileOps:
+		err := s.ReconcileOps()
+		if err != nil {
+			errorf("Failed to reconcile operators: %v", err)
+		}
+	case ProvisionGeyser:
+		err := s.ProvisionGeyser()
+		if err != nil {
+			errorf("Failed to provision the geyser config: %v", err)
+		}
+	case EnableDatapacks:
+		err := s.EnableDatapacks(runCtx)
+		if err != nil {
+			errorf("Failed to enable datapacks: %v", err)
+		}
+	case Sleep:
+		// Somebody may have reopened the server in the meantime
+		if s.awakeAt(time.Now()) {
+			break
+		}
+		if err := s.fallAsleep(); err != nil {
+			errorf("Failed to stop the server: %v", err)
+		}
+	case AutoUpdate:
+		if err := s.AutoUpdate(runCtx); err != nil {
+			errorf("Auto-update failed: %v", err)
+		}
+	}
+}
 
-	s.innerCmds = make(chan InnerCmd)
+func (s *Server) Run(supervisor *Supervisor) error {
+	runCtx, cancelRun := context.WithCancel(supervisor.Context())
+	defer cancelRun()
+	// Last to run, the other hooks may still notify
+	supervisor.OnShutdown("notifications", func() error {
+		if !s.notifications.Flush(NOTIFY_FLUSH_TIMEOUT) {
+			return errors.New("not every notification was sent")
+		}
+		return nil
+	})
+	if s.Config().PortMapping.Enabled {
+		supervisor.OnShutdown("port mappings", func() error {
+			s.ports.Close()
+			return nil
+		})
+	}
+	// Saves the world when Run did not get to stop the server, after a panic
+	supervisor.OnShutdown("server", func() error {
+		if s.asleep.Load() || s.cmdCtx == nil {
+			return nil
+		}
+		return s.Stop()
+	})
+	var err error
+	if s.awakeAt(time.Now()) {
+		err = s.Start(runCtx)
+	} else {
+		err = s.fallAsleep()
+	}
+	if err != nil {
+		return err
+	}
 
-	stdIns := make(chan string)
 	scanner := bufio.NewScanner(os.Stdin)
-	go func() {
+	supervisor.Go("console", func() {
 		for {
 			for scanner.Scan() {
 				if runCtx.Err() != nil {
 					return
 				}
-				stdIns <- scanner.Text()
+				s.queue.Push(ConsoleCommand(scanner.Text(), OriginConsole, PriorityAdmin))
 			}
 		}
-	}()
+	})
+	s.StartChatBridge(runCtx)
+	s.StartDynDns(runCtx)
+	// Match the firewall to the schedule, the launcher may start in the middle of the day
+	_, open := s.Config().AccessSchedule.ClosingTime(time.Now())
+	s.setBedrockBlocked(!open)
+	s.StartStatsExport(runCtx)
+	if err := s.StartStatusSocket(runCtx); err != nil {
+		warnf("Can not open the status socket: %v", err)
+	}
+	if s.Config().RemoteConsole != nil {
+		err := s.StartRemoteConsole(runCtx)
+		if err != nil {
+			errorf("Failed to start the remote console: %v", err)
+		}
+	}
+	// Why the launcher gives up, the process exit code is derived from it
+	var runErr error
 outer:
 	for {
+		var exited <-chan struct{}
+		var wake <-chan time.Time
+		var wakeAt *time.Time
+		var wakeCmd InnerCmd
+		if s.asleep.Load() {
+			wake, wakeAt, wakeCmd = s.sleepTimer()
+		} else {
+			exited = s.runningCtx.Done()
+		}
 		select {
-		case <-s.runningCtx.Done():
+		case <-wake:
+			if wakeAt != nil && !time.Now().Before(*wakeAt) {
+				cmd := InnerCommand(wakeCmd, OriginSchedule)
+				s.audit.Record(s.Config().WorkDir, cmd)
+				if !s.pausedBySchedule(cmd) {
+					s.handleAsleep(runCtx, wakeCmd)
+				}
+			}
+		case <-exited:
 			{
-				fmt.Println("[ERROR] Server exited unexpectedly.")
+				errorf("Server exited unexpectedly.")
+				s.HandleCrash()
+				runErr = s.crashError()
 				break outer
 			}
-		case input := <-stdIns:
+		case <-s.queue.Ready():
 			{
-				switch input {
+				cmd, ok := s.queue.Pop()
+				if !ok {
+					continue
+				}
+				s.audit.Record(s.Config().WorkDir, cmd)
+				if s.pausedBySchedule(cmd) {
+					continue
+				}
+				if cmd.IsInner && cmd.Inner == UpdateDue {
+					if err := s.finishCountdown(runCtx); err != nil {
+						errorf("Update failed: %v", err)
+						if !s.IsStarted() && runCtx.Err() == nil {
+							runErr = err
+							break outer
+						}
+					}
+					continue
+				}
+				if cmd.IsInner {
+					if s.asleep.Load() {
+						s.handleAsleep(runCtx, cmd.Inner)
+					} else {
+						s.handleInnerCmd(runCtx, cmd.Inner)
+					}
+					continue
+				}
+				if cmd.Capture != nil {
+					s.startCapture(cmd)
+				}
+				input := cmd.Input
+				command, arg, _ := strings.Cut(input, " ")
+				if s.asleep.Load() && !canRunAsleep(command) {
+					s.reply(s.msg(MsgAsleep))
+					continue
+				}
+				switch command {
+				case "wake":
+					if !s.asleep.Load() {
+						s.reply("Server is already running")
+						break
+					}
+					if err := s.wakeUp(runCtx); err != nil {
+						s.reply(fmt.Sprintf("Failed to start the server: %v", err))
+					}
 				case "update":
 					{
-						err := s.Stop()
-						if err != nil {
-							panic(err)
-						}
-						err = BackupFolder(s.Config.WorkDir)
-						if err != nil {
-							fmt.Printf("Error during back up: %v\n", err)
-							panic(err)
-						}
-						LoadPaper(s.Config.WorkDir)
-						err = LoadGeyser(s.Config.WorkDir)
-						if err != nil {
-							fmt.Printf("Error downloading geyser: %v\n", err)
+						var options UpdateOptions
+						arg, options.Force = cutForce(arg)
+						for _, word := range strings.Fields(arg) {
+							options.Now = options.Now || word == "now"
+							options.Staged = options.Staged || word == "staged"
+							options.NewVersion = options.NewVersion || word == NEW_VERSION_FLAG
 						}
-						err = s.Start(runCtx)
+						err := s.Update(runCtx, options)
 						if err != nil {
-							panic(err)
+							errorf("Update failed: %v", err)
+							if !s.IsStarted() && runCtx.Err() == nil {
+								runErr = err
+								break outer
+							}
 						}
 					}
+				case "cancel-update":
+					if s.CancelCountdown() {
+						s.reply("Restart countdown cancelled")
+					} else {
+						s.reply("No restart countdown is running")
+					}
+				case "stage-update":
+					if !s.staging.CompareAndSwap(false, true) {
+						s.reply("The update is already being staged")
+						break
+					}
+					go func() {
+						defer s.staging.Store(false)
+						if err := s.StageUpdate(runCtx, arg == NEW_VERSION_FLAG); err != nil {
+							s.reply(fmt.Sprintf("Staging failed: %v", err))
+							return
+						}
+						s.reply("Update staged, run `update staged` to swap it in")
+					}()
 				case "backup":
 					{
-						err := s.Backup()
+						var err error
+						if s.asleep.Load() {
+							err = s.offlineBackup(TriggerConsole)
+						} else if BackupMode(arg) == ColdBackup {
+							err = s.ColdBackup(runCtx, TriggerConsole)
+						} else {
+							err = s.Backup(TriggerConsole)
+						}
 						if err != nil {
-							fmt.Printf("Error during backup: %v\n", err)
+							errorf("Backup failed: %v", err)
 						}
 					}
 				case "reboot":
@@ -354,90 +1044,263 @@ outer:
 						time.Sleep(time.Second)
 						err := s.Start(runCtx)
 						if err != nil {
-							panic(err)
+							runErr = err
+							break outer
 						}
 					}
-				case "stop":
-					break outer
-				default:
-					s.inputsPipe <- input
-				}
-			}
-		case cmd := <-s.innerCmds:
-			{
-				switch cmd {
-				case Backup:
-					err := s.Backup()
-					if err != nil {
-						fmt.Printf("Error during backup: %v\n", err)
+				case "approve", "deny":
+					if err := s.AnswerJoinRequest(runCtx, arg, command == "approve"); err != nil {
+						s.reply(fmt.Sprintf("Failed to answer the join request: %v", err))
 					}
-				case CloseAccess:
+				case "compat":
+					s.printCompatibility(s.compatVersions(arg))
+				case "stats":
+					s.printStats()
+				case "backups":
 					{
-						fmt.Println("Closing server")
-						s.inputsPipe <- "say Server is closing now!"
-						time.Sleep(time.Second * 5)
-						for _, player := range s.Config.Players {
-							switch player.Type {
-							case Java:
-								s.inputsPipe <- fmt.Sprintf("whitelist remove %v", player.Nickname)
-								s.inputsPipe <- fmt.Sprintf("kick %v Server is closed", player.Nickname)
-							case Bedrock:
-								s.inputsPipe <- fmt.Sprintf("fwhitelist remove %v", player.Nickname)
-								s.inputsPipe <- fmt.Sprintf("kick .%v Server is closed", player.Nickname)
+						n := 10
+						if arg != "" {
+							n, err = strconv.Atoi(arg)
+							if err != nil || n <= 0 {
+								s.reply("Usage: backups <n>")
+								break
 							}
-							time.Sleep(time.Millisecond * 200)
 						}
+						s.printBackupHistory(n)
+					}
+				case "verify-backup":
+					{
+						if arg == "" {
+							s.printCatalog()
+							s.reply("Usage: verify-backup <file or catalog number>")
+							break
+						}
+						archive, err := ResolveBackup(s.Config().WorkDir, arg)
+						if err != nil {
+							s.reply(err.Error())
+							break
+						}
+						VerifyAndReport(archive)
 					}
-				case OpenAccess:
+				case "lan-mode":
 					{
-						fmt.Println("Opening server")
-						for _, player := range s.Config.Players {
-							switch player.Type {
-							case Java:
-								s.inputsPipe <- fmt.Sprintf("whitelist add %v", player.Nickname)
-							case Bedrock:
-								s.inputsPipe <- fmt.Sprintf("fwhitelist add %v", player.Nickname)
+						mode, confirm, _ := strings.Cut(arg, " ")
+						if (mode != "on" && mode != "off") || confirm != "confirm" {
+							s.reply("LAN mode turns off online-mode and the whitelist, anyone reaching the server can join under any name.")
+							s.reply("Usage: lan-mode <on|off> confirm")
+							break
+						}
+						if err := s.SetLanMode(runCtx, mode == "on"); err != nil {
+							s.reply(fmt.Sprintf("Failed to switch LAN mode: %v", err))
+							if !s.IsStarted() {
+								runErr = err
+								break outer
 							}
-							time.Sleep(time.Millisecond * 200)
 						}
 					}
-				case Warn:
-					notify := make(chan struct{})
-					find := make(chan string)
-					s.requestsPipe <- ListenRequest{query: "of a max of", accepted: notify, found: find}
-					<-notify
-					s.inputsPipe <- "list"
-					// There are 0 of a max of ## players online
-					playerList := <-find
-					if !strings.Contains(playerList, "There are 0 of a max of") {
-						s.inputsPipe <- "say Server will close soon"
-					} else {
-						fmt.Println("Warn not issued")
+				case "download-backup":
+					{
+						target, name, _ := strings.Cut(arg, " ")
+						if target == "" || name == "" {
+							s.reply("Usage: download-backup <target> <archive name>")
+							break
+						}
+						archive, err := s.DownloadBackup(target, name)
+						if err != nil {
+							s.reply(fmt.Sprintf("Download failed: %v", err))
+							break
+						}
+						s.reply(fmt.Sprintf("Downloaded %v", archive))
+						VerifyAndReport(archive)
+					}
+				case "rollback-player":
+					{
+						arg, force := cutForce(arg)
+						player, backup, _ := strings.Cut(arg, " ")
+						if player == "" || backup == "" {
+							s.printCatalog()
+							s.reply("Usage: rollback-player <nickname> <file or catalog number> [--force]")
+							break
+						}
+						if err := s.ensureSnapshot("rollback", force); err != nil {
+							s.reply(fmt.Sprintf("Rollback cancelled: %v", err))
+							break
+						}
+						if err := s.RollbackPlayer(runCtx, player, backup); err != nil {
+							s.reply(fmt.Sprintf("Rollback failed: %v", err))
+						}
+					}
+				case "!history":
+					{
+						n := 20
+						if arg != "" {
+							n, err = strconv.Atoi(arg)
+							if err != nil || n <= 0 {
+								s.reply("Usage: !history <n>")
+								break
+							}
+						}
+						for _, entry := range s.audit.Recent(n) {
+							s.reply(entry.String())
+						}
+					}
+				case "!status":
+					s.printStatus()
+				case "!pause-schedule":
+					{
+						d, err := time.ParseDuration(arg)
+						if err != nil {
+							s.reply("Usage: !pause-schedule <duration>, e.g. 3h")
+							break
+						}
+						if err := s.PauseSchedule(d); err != nil {
+							s.reply(err.Error())
+						}
+					}
+				case "!resume-schedule":
+					s.ResumeSchedule(runCtx)
+				case "!grep":
+					{
+						pattern, err := regexp.Compile(arg)
+						if err != nil {
+							s.reply(fmt.Sprintf("Invalid pattern: %v", err))
+							break
+						}
+						found := s.history.Grep(pattern)
+						for _, line := range found {
+							s.reply(line)
+						}
+						s.reply(fmt.Sprintf("[grep]: %v matching lines", len(found)))
+					}
+				case "!tail":
+					{
+						n := 20
+						if arg != "" {
+							n, err = strconv.Atoi(arg)
+							if err != nil || n <= 0 {
+								s.reply("Usage: !tail <n>")
+								break
+							}
+						}
+						for _, line := range s.history.Tail(n) {
+							s.reply(line)
+						}
+					}
+				case "profile":
+					{
+						duration := time.Duration(s.Config().Profiling.Duration)
+						if arg != "" {
+							duration, err = time.ParseDuration(arg)
+							if err != nil {
+								s.reply("Usage: profile [duration]")
+								break
+							}
+						}
+						go s.ProfileAndReport(s.runningCtx, duration, "requested from console")
 					}
+				case "reload-config":
+					{
+						err := s.ReloadConfig()
+						if err != nil {
+							errorf("Failed to reload the config: %v", err)
+						}
+					}
+				case "stop":
+					break outer
+				default:
+					s.inputsPipe <- input
 				}
 			}
 		case <-runCtx.Done():
 			break outer
 		}
 	}
-	fmt.Println("Exiting..")
-	return s.Stop()
+	infof("Exiting..")
+	if s.asleep.Load() || s.cmdCtx == nil {
+		return runErr
+	}
+	if err := s.Stop(); err != nil && runErr == nil {
+		return err
+	}
+	return runErr
 }
 
 func main() {
+	supervisor := NewSupervisor(shutdownSignals...)
+	if err := supervisor.Run(func() error { return launch(supervisor) }); err != nil {
+		os.Exit(ExitCode(err))
+	}
+}
+
+func launch(supervisor *Supervisor) error {
 	configFilePtr := flag.String("config", "config.json", "path to the config file")
+	initPtr := flag.Bool("init", false, "interactively create the config and prepare the server")
+	adoptPtr := flag.String("adopt", "", "create the config for an existing server directory")
+	dryRunPtr := flag.Bool("dry-run", false, "print what the scheduler would do during the next week without starting the server")
+	speedPtr := flag.Float64("speed", 0, "with -dry-run, run the virtual clock this many times faster instead of printing the week at once")
+	var logOptions LogOptions
+	flag.StringVar(&logOptions.Level, "log-level", "info", "debug, info, warn or error")
+	flag.StringVar(&logOptions.Format, "log-format", "text", "text or json")
+	flag.StringVar(&logOptions.File, "log-file", "", "also write the log as JSON to this file, rotated by size")
 	flag.Parse()
+	closeLog, err := SetupLogging(logOptions, *configFilePtr)
+	if err != nil {
+		return err
+	}
+	// Registered first to close last, after everything else has been logged
+	supervisor.OnShutdown("log", func() error {
+		closeLog()
+		return nil
+	})
+	switch flag.Arg(0) {
+	case "status":
+		return RunStatus(*configFilePtr, flag.Args()[1:])
+	case "cmd":
+		return RunCommand(*configFilePtr, flag.Args()[1:])
+	}
+	if *adoptPtr != "" {
+		return RunAdopt(*adoptPtr, *configFilePtr)
+	}
+	if *initPtr {
+		return RunInitWizard(*configFilePtr)
+	}
 	config, err := LoadConfig(*configFilePtr)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("%w: %w", ErrConfig, err)
 	}
-	os.MkdirAll(config.WorkDir, os.ModePerm)
-	if _, err := os.Stat(config.WorkDir + "/paper.jar"); errors.Is(err, os.ErrNotExist) {
-		LoadPaper(config.WorkDir)
+	if *dryRunPtr {
+		server := NewServer(&config, *configFilePtr)
+		return server.DryRun(supervisor.Context(), DRY_RUN_PERIOD, *speedPtr)
+	}
+	switch config.CacheDir {
+	case "":
+		JarCacheDir = DefaultJarCacheDir()
+	case "none":
+	default:
+		JarCacheDir = config.CacheDir
 	}
-	server := Server{Config: &config, requestsPipe: make(chan ListenRequest)}
-	err = server.Run()
+	os.MkdirAll(config.WorkDir, os.ModePerm)
+	unlock, err := AcquireInstanceLock(config.WorkDir)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	supervisor.OnShutdown("instance lock", func() error {
+		unlock()
+		return nil
+	})
+	if err := MigrateVersionsInfo(config.WorkDir); err != nil {
+		warnf("Failed to move %v into the work dir: %v", VERSIONS_FILE, err)
+	}
+	if _, err := os.Stat(filepath.Join(config.WorkDir, "paper.jar")); errors.Is(err, os.ErrNotExist) {
+		if err := LoadPaper(config.WorkDir, config.ServerFlavor, config.Compatibility, false); err != nil {
+			return err
+		}
+	}
+	if err := LoadDatapacks(config.WorkDir, config.Datapacks); err != nil {
+		errorf("Failed to download datapacks: %v", err)
+	}
+	if err := LoadBedrockPacks(config.WorkDir, config.BedrockPacks); err != nil {
+		errorf("Failed to download bedrock packs: %v", err)
 	}
+	return NewServer(&config, *configFilePtr).Run(supervisor)
 }
@@ -0,0 +1,1503 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"papermc-launcher/launcherrpc"
+)
+
+const TEST_TIMEOUT = 10 * time.Second
+
+func TestMain(m *testing.M) {
+	if os.Getenv(FAKE_SERVER_ENV) != "" {
+		os.Exit(runFakeServer())
+	}
+	os.Exit(m.Run())
+}
+
+// Collects notifications posted to the webhook
+type notificationRecorder struct {
+	mu     sync.Mutex
+	events []Notification
+}
+
+func (r *notificationRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var n Notification
+	if err := json.NewDecoder(req.Body).Decode(&n); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.events = append(r.events, n)
+	r.mu.Unlock()
+}
+
+func (r *notificationRecorder) find(event string) (Notification, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, n := range r.events {
+		if n.Event == event {
+			return n, true
+		}
+	}
+	return Notification{}, false
+}
+
+// newTestServer prepares a work dir with a world and a server running the fake process
+func newTestServer(t *testing.T) (*Server, *notificationRecorder) {
+	t.Helper()
+	workDir := filepath.Join(t.TempDir(), "server")
+	if err := os.MkdirAll(filepath.Join(workDir, "world"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "world", "level.dat"), []byte("level"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &notificationRecorder{}
+	webhook := httptest.NewServer(recorder)
+	t.Cleanup(webhook.Close)
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FAKE_SERVER_ENV, "1")
+	config := Config{
+		WorkDir: workDir,
+		Memory:  "1G",
+		Players: []Player{
+			{Type: Java, Nickname: "Steve"},
+			{Type: Bedrock, Nickname: "Alex"},
+		},
+		Notifications: NotificationsConfig{Webhook: webhook.URL},
+	}
+	s := NewServer(&config, "")
+	s.javaCommand = []string{executable}
+	return s, recorder
+}
+
+func startTestServer(t *testing.T, s *Server) {
+	t.Helper()
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if s.cmdCtx != nil {
+			s.Stop()
+		}
+	})
+	waitForState(t, s, Running)
+}
+
+func waitForState(t *testing.T, s *Server, state ServerState) {
+	t.Helper()
+	deadline := time.Now().Add(TEST_TIMEOUT)
+	for s.Status() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("server is %v, expected %v", s.Status(), state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Commands received by the fake server so far
+func receivedCommands(t *testing.T, s *Server) []string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(s.Config().WorkDir, FAKE_COMMANDS_LOG))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func waitForCommand(t *testing.T, s *Server, command string) {
+	t.Helper()
+	deadline := time.Now().Add(TEST_TIMEOUT)
+	for {
+		for _, received := range receivedCommands(t, s) {
+			if received == command {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not receive %q, got %q", command, receivedCommands(t, s))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func hasCommand(t *testing.T, s *Server, command string) bool {
+	for _, received := range receivedCommands(t, s) {
+		if received == command {
+			return true
+		}
+	}
+	return false
+}
+
+func waitForNotification(t *testing.T, recorder *notificationRecorder, event string) Notification {
+	t.Helper()
+	deadline := time.Now().Add(TEST_TIMEOUT)
+	for {
+		if n, ok := recorder.find(event); ok {
+			return n
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %v notification", event)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	s, _ := newTestServer(t)
+	startTestServer(t, s)
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Status() != Stopped {
+		t.Errorf("server is %v after stop", s.Status())
+	}
+	waitForCommand(t, s, "stop")
+}
+
+func TestHotBackup(t *testing.T) {
+	s, _ := newTestServer(t)
+	startTestServer(t, s)
+	if err := s.Backup(TriggerConsole); err != nil {
+		t.Fatal(err)
+	}
+	if s.Status() != Running {
+		t.Errorf("server is %v after backup", s.Status())
+	}
+	for _, command := range []string{"save-off", "save-all flush", "save-on"} {
+		waitForCommand(t, s, command)
+	}
+	catalog, err := LoadCatalog(s.Config().WorkDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 1 || catalog[0].Trigger != TriggerConsole {
+		t.Fatalf("unexpected catalog %v", catalog)
+	}
+	report, err := VerifyBackup(catalog[0].Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.HasLevel || report.Checked == 0 {
+		t.Errorf("backup not verified against the work dir: %v", report)
+	}
+	archive, err := os.Open(catalog[0].Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	reader, err := openArchive(archive, catalog[0].Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(header.Name, "server/") {
+			t.Errorf("entry %v is not relative to the work dir parent", header.Name)
+		}
+	}
+	history, err := LoadBackupHistory(s.Config().WorkDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Error != "" || history[0].Size != catalog[0].Size {
+		t.Errorf("unexpected backup history %v", history)
+	}
+}
+
+func TestWarn(t *testing.T) {
+	s, _ := newTestServer(t)
+	startTestServer(t, s)
+
+	s.handleInnerCmd(context.Background(), Warn)
+	waitForCommand(t, s, "list")
+	if hasCommand(t, s, "say Server will close soon") {
+		t.Error("warned an empty server")
+	}
+
+	if _, err := s.Query(context.Background(), "fake-join Steve", "joined the game"); err != nil {
+		t.Fatal(err)
+	}
+	s.handleInnerCmd(context.Background(), Warn)
+	waitForCommand(t, s, "say Server will close soon")
+}
+
+func TestOpenClose(t *testing.T) {
+	s, recorder := newTestServer(t)
+	startTestServer(t, s)
+
+	s.handleInnerCmd(context.Background(), OpenAccess)
+	waitForCommand(t, s, "whitelist add Steve")
+	waitForCommand(t, s, "fwhitelist add Alex")
+	waitForNotification(t, recorder, EventScheduleOpen)
+
+	if _, err := s.Query(context.Background(), "fake-join Steve", "joined the game"); err != nil {
+		t.Fatal(err)
+	}
+	s.handleInnerCmd(context.Background(), CloseAccess)
+	waitForCommand(t, s, "whitelist remove Steve")
+	waitForCommand(t, s, "kick Steve Server is closed")
+	waitForCommand(t, s, "kick .Alex Server is closed")
+	waitForNotification(t, recorder, EventScheduleClose)
+	summary := waitForNotification(t, recorder, EventDailySummary)
+	if !strings.Contains(summary.Message, "Steve") {
+		t.Errorf("summary does not mention the player: %q", summary.Message)
+	}
+}
+
+func TestCloseEmptyServer(t *testing.T) {
+	s, recorder := newTestServer(t)
+	startTestServer(t, s)
+
+	s.handleInnerCmd(context.Background(), CloseAccess)
+	waitForNotification(t, recorder, EventScheduleClose)
+	if hasCommand(t, s, "say Server is closing now!") || hasCommand(t, s, "kick Steve Server is closed") {
+		t.Errorf("empty server was warned: %q", receivedCommands(t, s))
+	}
+}
+
+func TestCloseGrace(t *testing.T) {
+	s, recorder := newTestServer(t)
+	s.Config().CloseGrace = Duration(100 * time.Millisecond)
+	startTestServer(t, s)
+
+	if _, err := s.Query(context.Background(), "fake-join Steve", "joined the game"); err != nil {
+		t.Fatal(err)
+	}
+	s.handleInnerCmd(context.Background(), CloseAccess)
+	waitForNotification(t, recorder, EventCloseDelayed)
+	if hasCommand(t, s, "whitelist remove Steve") {
+		t.Fatal("closed without the grace period")
+	}
+	// Skip the commands queued on start
+	for closed := false; !closed; {
+		select {
+		case <-s.queue.Ready():
+		case <-time.After(TEST_TIMEOUT):
+			t.Fatal("delayed close was not queued")
+		}
+		if cmd, ok := s.queue.Pop(); ok && cmd.IsInner && cmd.Inner == CloseAccess {
+			s.handleInnerCmd(context.Background(), cmd.Inner)
+			closed = true
+		}
+	}
+	waitForCommand(t, s, "whitelist remove Steve")
+	waitForNotification(t, recorder, EventScheduleClose)
+}
+
+func TestOpenUntilEmpty(t *testing.T) {
+	s, recorder := newTestServer(t)
+	s.Config().AccessSchedule.DaysSchedule = make(map[Weekday]TimeInterval)
+	for day := range 7 {
+		s.Config().AccessSchedule.DaysSchedule[Weekday(day)] = TimeInterval{UntilEmpty: Duration(time.Hour)}
+	}
+	startTestServer(t, s)
+
+	if _, err := s.Query(context.Background(), "fake-join Steve", "joined the game"); err != nil {
+		t.Fatal(err)
+	}
+	s.handleInnerCmd(context.Background(), CloseAccess)
+	waitForNotification(t, recorder, EventCloseDelayed)
+	if hasCommand(t, s, "whitelist remove Steve") {
+		t.Fatal("closed with a player online")
+	}
+	if _, err := s.Query(context.Background(), "fake-leave Steve", "left the game"); err != nil {
+		t.Fatal(err)
+	}
+	for closed := false; !closed; {
+		select {
+		case <-s.queue.Ready():
+		case <-time.After(TEST_TIMEOUT):
+			t.Fatal("close was not queued when the last player left")
+		}
+		if cmd, ok := s.queue.Pop(); ok && cmd.IsInner && cmd.Inner == CloseAccess {
+			s.handleInnerCmd(context.Background(), cmd.Inner)
+			closed = true
+		}
+	}
+	waitForNotification(t, recorder, EventScheduleClose)
+	if s.holdTimer != nil || s.holdingOpen.Load() {
+		t.Error("hold is not released after the close")
+	}
+}
+
+func TestWhitelistMismatch(t *testing.T) {
+	s, recorder := newTestServer(t)
+	startTestServer(t, s)
+
+	if err := s.SetWhitelisted(context.Background(), s.Config().Players[:1], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.sendInput(context.Background(), "fake-lock-whitelist"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetWhitelisted(context.Background(), s.Config().Players, true); err == nil {
+		t.Fatal("expected a whitelist mismatch")
+	}
+	n := waitForNotification(t, recorder, EventWhitelistMismatch)
+	if !strings.Contains(n.Details, ".Alex") || strings.Contains(n.Details, "Steve") {
+		t.Errorf("unexpected mismatch details %q", n.Details)
+	}
+}
+
+func TestCrashRestart(t *testing.T) {
+	s, recorder := newTestServer(t)
+	startTestServer(t, s)
+
+	if err := s.sendInput(context.Background(), "fake-crash"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.runningCtx.Done():
+	case <-time.After(TEST_TIMEOUT):
+		t.Fatal("server did not exit")
+	}
+	s.HandleCrash()
+	crash := waitForNotification(t, recorder, EventCrash)
+	if !strings.Contains(crash.Message, "Fake crash") {
+		t.Errorf("crash notification does not contain the exception: %q", crash.Message)
+	}
+	archived, _ := filepath.Glob(filepath.Join(s.Config().WorkDir+"-crashes", "*.txt"))
+	if len(archived) != 1 {
+		t.Errorf("expected one archived crash report, got %v", archived)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	startTestServer(t, s)
+}
+
+func TestSleepWake(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().Sleep = &SleepConfig{}
+	startTestServer(t, s)
+
+	s.handleInnerCmd(context.Background(), Sleep)
+	if !s.asleep.Load() || s.Status() != Stopped {
+		t.Fatalf("server is %v after sleep", s.Status())
+	}
+	if err := s.offlineBackup(TriggerSchedule); err != nil {
+		t.Fatal(err)
+	}
+	s.handleAsleep(context.Background(), Wake)
+	if s.asleep.Load() {
+		t.Fatal("server is still asleep")
+	}
+	waitForState(t, s, Running)
+}
+
+func TestJavaMissing(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.javaCommand = []string{filepath.Join(t.TempDir(), "java")}
+	err := s.Start(context.Background())
+	if ExitCode(err) != EXIT_JAVA_MISSING {
+		t.Fatalf("unexpected start error %v", err)
+	}
+	if s.Status() != Stopped {
+		t.Errorf("server is %v after a failed start", s.Status())
+	}
+}
+
+func TestJoinApproval(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().JoinApproval = &JoinApprovalConfig{}
+	s.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := writeJSON(s.ConfigPath, s.Config()); err != nil {
+		t.Fatal(err)
+	}
+	startTestServer(t, s)
+
+	if _, err := s.Query(context.Background(), "fake-reject Steve", "not white-listed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Query(context.Background(), "fake-reject .Herobrine", "not white-listed"); err != nil {
+		t.Fatal(err)
+	}
+	// The output is handled after the query returns, wait until the next line
+	if _, err := s.Query(context.Background(), "list", "players online"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AnswerJoinRequest(context.Background(), "Steve", true); err == nil {
+		t.Error("approved a known player")
+	}
+	if err := s.AnswerJoinRequest(context.Background(), ".Herobrine", true); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(s.ConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := json.Unmarshal(content, &config); err != nil {
+		t.Fatal(err)
+	}
+	last := config.Players[len(config.Players)-1]
+	if len(config.Players) != 3 || last.Type != Bedrock || last.Nickname != "Herobrine" {
+		t.Errorf("unexpected players %v", config.Players)
+	}
+}
+
+func TestStagedSwap(t *testing.T) {
+	s, _ := newTestServer(t)
+	workDir := s.Config().WorkDir
+	staging := StagingDir(workDir)
+	if err := os.WriteFile(filepath.Join(workDir, WHITELIST_FILE), []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "paper.jar"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTree(workDir, staging, map[string]bool{"world": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, "paper.jar"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.validateStaging(context.Background(), staging); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SwapStaging(); err == nil {
+		t.Fatal("swapped a staging copy that was not marked ready")
+	}
+	if err := os.WriteFile(filepath.Join(staging, STAGING_READY_FILE), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Changed by the live server after staging
+	if err := os.WriteFile(filepath.Join(workDir, WHITELIST_FILE), []byte(`[{"name":"Steve"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SwapStaging(); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{
+		"paper.jar":                         "new",
+		WHITELIST_FILE:                      `[{"name":"Steve"}]`,
+		filepath.Join("world", "level.dat"): "level",
+	} {
+		content, err := os.ReadFile(filepath.Join(workDir, file))
+		if err != nil || string(content) != want {
+			t.Errorf("%v: got %q, %v", file, content, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(PreviousDir(workDir), "paper.jar")); err != nil {
+		t.Errorf("previous server is not kept: %v", err)
+	}
+	if _, err := os.Stat(staging); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staging dir is left: %v", err)
+	}
+}
+
+func TestGriefRule(t *testing.T) {
+	rule := GriefRule{Name: "tnt", Pattern: Regexp{regexp.MustCompile(`(?P<player>\w+) ignited TNT`)}, Threshold: 2, Window: Duration(time.Minute)}
+	player, ok := rule.Player("[12:00:00 INFO]: Steve ignited TNT at 1 64 1")
+	if !ok || player != "Steve" {
+		t.Fatalf("got %q, %v", player, ok)
+	}
+	var tracker GriefTracker
+	start := time.Now()
+	if tracker.Hit(rule, "Steve", start) || tracker.Hit(rule, "Steve", start.Add(2*time.Minute)) {
+		t.Error("triggered on hits outside the window")
+	}
+	if !tracker.Hit(rule, "steve", start.Add(150*time.Second)) {
+		t.Error("not triggered on the second hit within the window")
+	}
+	if tracker.Hit(rule, "Steve", start.Add(160*time.Second)) {
+		t.Error("count not restarted after triggering")
+	}
+}
+
+func TestStatusSocket(t *testing.T) {
+	s, _ := newTestServer(t)
+	startTestServer(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.StartStatusSocket(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(filepath.Join(s.Config().WorkDir, STATUS_SOCKET_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm()&0077 != 0 {
+		t.Errorf("the socket is open to other users: %v", stat.Mode())
+	}
+	if _, err := s.Query(ctx, "fake-join Steve", "joined the game"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Query(ctx, "list", "players online"); err != nil {
+		t.Fatal(err)
+	}
+	response, err := socketClient(s.Config().WorkDir).Get("http://launcher" + STATUS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var report StatusReport
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.State != Running || len(report.Players) != 1 || report.Players[0] != "Steve" {
+		t.Errorf("unexpected status %+v", report)
+	}
+}
+
+func TestSocketCommand(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.StartStatusSocket(ctx); err != nil {
+		t.Fatal(err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://launcher"+COMMAND_PATH, strings.NewReader("backup cold\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go socketClient(s.Config().WorkDir).Do(request)
+	select {
+	case <-s.queue.Ready():
+	case <-time.After(TEST_TIMEOUT):
+		t.Fatal("command was not queued")
+	}
+	cmd, ok := s.queue.Pop()
+	if !ok || cmd.Input != "backup cold" || cmd.Origin != OriginSocket {
+		t.Errorf("unexpected command %+v", cmd)
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	quiet := QuietHours{Start: DayTime{hours: 22}, End: DayTime{hours: 7}}
+	for hour, want := range map[int]bool{21: false, 22: true, 23: true, 0: true, 6: true, 7: false, 12: false} {
+		at := time.Date(2024, time.June, 1, hour, 30, 0, 0, time.UTC)
+		if got := quiet.Contains(at); got != want {
+			t.Errorf("%v: got %v, want %v", at.Format("15:04"), got, want)
+		}
+	}
+	s, _ := newTestServer(t)
+	s.Config().QuietHours = &quiet
+	s.Config().WarnBefore = []Duration{Duration(10 * time.Minute)}
+	s.Config().AccessSchedule.DaysSchedule = map[Weekday]TimeInterval{
+		Weekday(time.Saturday): {Start: DayTime{hours: 18}, End: DayTime{hours: 23}, WarnBefore: []Duration{Duration(time.Hour)}},
+	}
+	next, cmd := s.nextScheduled(time.Date(2024, time.June, 1, 19, 0, 0, 0, time.UTC))
+	if cmd != Warn || next.Hour() != 22 || next.Minute() != 0 {
+		t.Errorf("expected the day's warning at 22:00, got %v at %v", cmd, next)
+	}
+	if actions := s.dryRunActions(Warn, *next); !strings.HasPrefix(actions[0], "no say") {
+		t.Errorf("warning is broadcast during quiet hours: %v", actions)
+	}
+}
+
+func TestCaptureOutput(t *testing.T) {
+	s, _ := newTestServer(t)
+	startTestServer(t, s)
+	delivered := make(chan []string, 1)
+	cmd := ConsoleCommand("list", OriginSocket, PriorityAdmin)
+	cmd.Capture = &Capture{Idle: 200 * time.Millisecond, Deliver: func(lines []string) { delivered <- lines }}
+	s.startCapture(cmd)
+	if err := s.sendInput(context.Background(), cmd.Input); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case lines := <-delivered:
+		if len(lines) != 1 || !strings.Contains(lines[0], "players online") {
+			t.Errorf("unexpected output %q", lines)
+		}
+	case <-time.After(TEST_TIMEOUT):
+		t.Fatal("output was not delivered")
+	}
+	audit, err := os.ReadFile(filepath.Clean(s.Config().WorkDir) + "-audit.log")
+	if err != nil || !strings.Contains(string(audit), "players online") {
+		t.Errorf("output is not in the audit log: %q, %v", audit, err)
+	}
+}
+
+func TestScheduleAcrossDst(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, _ := newTestServer(t)
+	s.Config().AccessSchedule.Timezone = Location(*berlin)
+	s.Config().AccessSchedule.DaysSchedule = map[Weekday]TimeInterval{
+		Weekday(time.Sunday): {Start: DayTime{hours: 10}, End: DayTime{hours: 20}},
+		Weekday(time.Monday): {Start: DayTime{hours: 10}, End: DayTime{hours: 20}},
+	}
+	// Clocks go back at 03:00 on Sunday, October 27 2024
+	for _, now := range []time.Time{
+		time.Date(2024, time.October, 26, 12, 0, 0, 0, berlin),
+		time.Date(2024, time.October, 27, 21, 0, 0, 0, berlin),
+	} {
+		next, cmd := s.nextScheduled(now)
+		// Skip the default backups
+		for next != nil && cmd == Backup {
+			next, cmd = s.nextScheduled(*next)
+		}
+		if cmd != OpenAccess || next == nil || next.In(berlin).Hour() != 10 || next.In(berlin).Day() != now.Day()+1 {
+			t.Errorf("after %v: got %v at %v", now, cmd, next)
+		}
+	}
+}
+
+func TestYamlConfig(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.yaml")
+	content := `# Family server
+work_dir: server
+memory: 2G
+backup:
+  schedule: []
+custom_key: kept
+warn_before: [10m, 1m]
+schedule:
+  timezone: UTC
+  days_schedule:
+    Saturday: {start: "10:00", end: "22:30"}
+players:
+  - {type: Java, nickname: Steve}
+`
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saturday := config.AccessSchedule.DaysSchedule[Weekday(time.Saturday)]
+	if config.WorkDir != filepath.Join(dir, "server") || saturday.End.Duration() != 22*time.Hour+30*time.Minute || len(config.WarnBefore) != 2 {
+		t.Errorf("unexpected config %+v", config)
+	}
+	if err := AddPlayerToConfig(filename, Player{Type: Bedrock, Nickname: "Alex"}); err != nil {
+		t.Fatal(err)
+	}
+	written, _ := os.ReadFile(filename)
+	if strings.HasPrefix(strings.TrimSpace(string(written)), "{") {
+		t.Errorf("config is not written as YAML:\n%s", written)
+	}
+	config, err = LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, written)
+	}
+	if len(config.Players) != 2 || config.Players[1].Nickname != "Alex" {
+		t.Errorf("unexpected players %v", config.Players)
+	}
+	for _, kept := range []string{"# Family server", "schedule: []", "custom_key: kept"} {
+		if !strings.Contains(string(written), kept) {
+			t.Errorf("adding a player lost %q:\n%s", kept, written)
+		}
+	}
+}
+
+func TestAddPlayerToJSONConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	for _, c := range []struct{ content, want string }{
+		{`{"work_dir": "server"}`, `{"work_dir": "server", "players": [{"type":"Bedrock","nickname":"Alex"}]}`},
+		{`{"players": [], "custom_key": 1}`, `{"players": [{"type":"Bedrock","nickname":"Alex"}], "custom_key": 1}`},
+		{"{\n  \"players\": [\n    {\"nickname\": \"Steve\"}\n  ]\n}", "{\n  \"players\": [\n    {\"nickname\": \"Steve\"},\n    {\"type\":\"Bedrock\",\"nickname\":\"Alex\"}\n  ]\n}"},
+	} {
+		os.WriteFile(filename, []byte(c.content), 0644)
+		if err := AddPlayerToConfig(filename, Player{Type: Bedrock, Nickname: "Alex"}); err != nil {
+			t.Fatal(err)
+		}
+		if written, _ := os.ReadFile(filename); string(written) != c.want {
+			t.Errorf("expected\n%v\ngot\n%s", c.want, written)
+		}
+	}
+}
+
+func TestNotificationRateLimit(t *testing.T) {
+	s, recorder := newTestServer(t)
+	s.Config().Notifications.RateLimits = map[string]Duration{EventCrash: Duration(time.Hour)}
+	for range 3 {
+		s.Notify(EventCrash, "crashed", "")
+		s.Notify(EventPlayerJoin, "joined", "")
+	}
+	if !s.notifications.Flush(5 * time.Second) {
+		t.Fatal("notifications not sent")
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	counts := make(map[string]int)
+	for _, n := range recorder.events {
+		counts[n.Event]++
+	}
+	if counts[EventCrash] != 1 || counts[EventPlayerJoin] != 3 {
+		t.Errorf("unexpected notifications %v", counts)
+	}
+
+	n := Notification{Event: EventCrash, Message: "crashed", Suppressed: 2}
+	config := NotificationsConfig{Templates: map[string]string{"*": "{{.Event}}: {{.Message}} +{{.Suppressed}}"}}
+	if text := config.Text(n); text != "crash: crashed +2" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
+
+func TestRotatingLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "launcher.log")
+	file, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{"": "fourth\n", ".1": "third\n", ".2": "second\n"} {
+		content, err := os.ReadFile(path + name)
+		if err != nil || string(content) != want {
+			t.Errorf("%v: got %q, %v", name, content, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("kept more files than configured: %v", err)
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	supervisor := NewSupervisor()
+	var order []string
+	supervisor.OnShutdown("first", func() error {
+		order = append(order, "first")
+		return nil
+	})
+	supervisor.OnShutdown("second", func() error {
+		order = append(order, "second")
+		panic("hook")
+	})
+	err := supervisor.Run(func() error {
+		panic("launcher")
+	})
+	if !errors.Is(err, ErrPanic) {
+		t.Errorf("expected the panic as the error, got %v", err)
+	}
+	if strings.Join(order, ",") != "second,first" {
+		t.Errorf("hooks ran in the wrong order: %v", order)
+	}
+	if err := supervisor.Shutdown(); !errors.Is(err, ErrPanic) {
+		t.Errorf("expected the hook panic from the repeated shutdown, got %v", err)
+	}
+
+	supervisor = NewSupervisor()
+	supervisor.Go("worker", func() { panic("worker") })
+	select {
+	case <-supervisor.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("a panicking goroutine did not cancel the context")
+	}
+	if !errors.Is(context.Cause(supervisor.Context()), ErrPanic) {
+		t.Errorf("unexpected cause %v", context.Cause(supervisor.Context()))
+	}
+}
+
+func TestHttpEndpoints(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().Users = []User{{Name: "viewer", Token: "v", Role: Viewer}, {Name: "admin", Token: "a", Role: Admin}}
+	server := httptest.NewServer(s.baseMux(true))
+	defer server.Close()
+	get := func(path, token string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+	if code, _ := get(HEALTH_PATH, ""); code != http.StatusServiceUnavailable {
+		t.Errorf("stopped server reported healthy: %v", code)
+	}
+	startTestServer(t, s)
+	if code, _ := get(HEALTH_PATH, ""); code != http.StatusOK {
+		t.Errorf("running server reported unhealthy: %v", code)
+	}
+	if code, _ := get(METRICS_PATH, ""); code != http.StatusUnauthorized {
+		t.Errorf("metrics without a token: %v", code)
+	}
+	if code, body := get(METRICS_PATH, "v"); code != http.StatusOK || !strings.Contains(body, "papermc_up 1\n") {
+		t.Errorf("unexpected metrics %v:\n%v", code, body)
+	}
+	if code, _ := get(PPROF_PATH, "v"); code != http.StatusForbidden {
+		t.Errorf("viewer reached the profiler: %v", code)
+	}
+	if code, _ := get(PPROF_PATH, "a"); code != http.StatusOK {
+		t.Errorf("admin did not reach the profiler: %v", code)
+	}
+}
+
+func TestFoliaFlavor(t *testing.T) {
+	tps, err := ParseTps(" - Lowest Region TPS: 18.50 (MSPT: 40.1)")
+	if err != nil || tps != 18.5 {
+		t.Errorf("unexpected folia tps %v: %v", tps, err)
+	}
+	if err := ServerFlavor("purpur").Validate(); err == nil {
+		t.Error("unknown flavor accepted")
+	}
+	if ServerFlavor("").Project() != "paper" {
+		t.Error("paper is not the default flavor")
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "plugins"), os.ModePerm)
+	writePlugin := func(file, yml string) {
+		t.Helper()
+		out, err := os.Create(filepath.Join(dir, "plugins", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive := zip.NewWriter(out)
+		w, _ := archive.Create("plugin.yml")
+		w.Write([]byte(yml))
+		archive.Close()
+		out.Close()
+	}
+	writePlugin("regions.jar", "name: Regions\nversion: 1.0\nfolia-supported: true\n")
+	writePlugin("legacy.jar", "name: Legacy\nversion: 2.3\n")
+	if unsupported := foliaUnsupportedPlugins(dir); !slices.Equal(unsupported, []string{"Legacy"}) {
+		t.Errorf("unexpected unsupported plugins %v", unsupported)
+	}
+}
+
+func TestSnapshotBeforeRiskyOperation(t *testing.T) {
+	if arg, force := cutForce("alice --force 3"); arg != "alice 3" || !force {
+		t.Errorf("unexpected %q %v", arg, force)
+	}
+	s, _ := newTestServer(t)
+	// Stopped, the snapshot is made offline
+	if err := s.ensureSnapshot("rollback", false); err != nil {
+		t.Fatal(err)
+	}
+	startTestServer(t, s)
+	if err := s.ensureSnapshot("rollback", false); err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := LoadCatalog(s.Config().WorkDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 1 || catalog[0].Trigger != TriggerSnapshot {
+		t.Errorf("expected one snapshot reused by the second operation, got %v", catalog)
+	}
+}
+
+func TestPauseSchedule(t *testing.T) {
+	s, _ := newTestServer(t)
+	startTestServer(t, s)
+	if err := s.PauseSchedule(48 * time.Hour); err == nil {
+		t.Error("pause longer than the limit accepted")
+	}
+	if err := s.PauseSchedule(3 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !s.pausedBySchedule(InnerCommand(CloseAccess, OriginSchedule)) {
+		t.Error("scheduled close not paused")
+	}
+	if s.pausedBySchedule(ConsoleCommand("backup", OriginConsole, PriorityAdmin)) {
+		t.Error("console command paused")
+	}
+	if report := s.StatusReport(); report.PausedUntil == nil || !strings.Contains(report.String(), "SCHEDULE PAUSED") {
+		t.Errorf("status has no pause banner: %v", report)
+	}
+	s.ResumeSchedule(context.Background())
+	if s.schedulePausedUntil() != nil {
+		t.Error("schedule still paused")
+	}
+	caughtUp := false
+	for cmd, ok := s.queue.Pop(); ok; cmd, ok = s.queue.Pop() {
+		caughtUp = caughtUp || cmd.IsInner && (cmd.Inner == OpenAccess || cmd.Inner == CloseAccess)
+	}
+	if !caughtUp {
+		t.Error("resume did not catch up with the schedule")
+	}
+}
+
+func TestRPC(t *testing.T) {
+	s, _ := newTestServer(t)
+	startTestServer(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.StartStatusSocket(ctx); err != nil {
+		t.Fatal(err)
+	}
+	client := launcherrpc.Dial(s.Config().WorkDir)
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "running" || status.Players == nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+	var rpcErr *launcherrpc.Error
+	if err := client.Call(ctx, "reboot", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != launcherrpc.CodeMethodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+	if err := client.Call(ctx, launcherrpc.MethodCommand, launcherrpc.CommandParams{}, nil); !errors.As(err, &rpcErr) || rpcErr.Code != launcherrpc.CodeInvalidParams {
+		t.Errorf("expected invalid params, got %v", err)
+	}
+	if err := client.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	closed := false
+	for cmd, ok := s.queue.Pop(); ok; cmd, ok = s.queue.Pop() {
+		closed = closed || cmd.IsInner && cmd.Inner == CloseAccess && cmd.Origin == OriginRPC
+	}
+	if !closed {
+		t.Error("close was not queued")
+	}
+}
+
+func TestDistanceTuning(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().DistanceTuning = &DistanceTuningConfig{
+		ViewCommand: "vd %v",
+		Steps:       []DistanceStep{{Players: 1, ViewDistance: 10}, {Players: 2, ViewDistance: 6}},
+	}
+	os.WriteFile(filepath.Join(s.Config().WorkDir, SERVER_PROPERTIES_FILE), []byte("view-distance=12\n"), 0644)
+	if err := s.Config().DistanceTuning.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&DistanceTuningConfig{Steps: []DistanceStep{{Players: 0, SimulationDistance: 4}}}).Validate(); err == nil {
+		t.Error("simulation distance without a command accepted")
+	}
+	startTestServer(t, s)
+	ctx := context.Background()
+	for _, player := range []string{"Steve", "Alex"} {
+		if _, err := s.Query(ctx, "fake-join "+player, "joined the game"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Query(ctx, "list", "players online"); err != nil {
+		t.Fatal(err)
+	}
+	var sent []string
+	for cmd, ok := s.queue.Pop(); ok; cmd, ok = s.queue.Pop() {
+		if strings.HasPrefix(cmd.Input, "vd ") {
+			sent = append(sent, cmd.Input)
+		}
+	}
+	for _, player := range []string{"Steve", "Alex"} {
+		if _, err := s.Query(ctx, "fake-leave "+player, "left the game"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Query(ctx, "list", "players online"); err != nil {
+		t.Fatal(err)
+	}
+	for cmd, ok := s.queue.Pop(); ok; cmd, ok = s.queue.Pop() {
+		if strings.HasPrefix(cmd.Input, "vd ") {
+			sent = append(sent, cmd.Input)
+		}
+	}
+	if !slices.Equal(sent, []string{"vd 10", "vd 6", "vd 10", "vd 12"}) {
+		t.Errorf("unexpected distance commands %v", sent)
+	}
+}
+
+func TestThrottledBackup(t *testing.T) {
+	limiter := newRateLimiter(10)
+	started := time.Now()
+	if _, err := io.Copy(io.Discard, throttled(strings.NewReader(strings.Repeat("x", 1<<20)), limiter)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Errorf("1 MiB at 10 MB/s took only %v", elapsed)
+	}
+	s, _ := newTestServer(t)
+	level := 0
+	s.Config().Backup.Throttle = &BackupThrottle{ReadMBps: 100, IOClass: "idle", CompressionLevel: &level}
+	if err := s.Config().Backup.Validate(); err == nil {
+		t.Error("compression level 0 accepted")
+	}
+	level = 6
+	if err := s.Config().Backup.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	startTestServer(t, s)
+	if err := s.Backup(TriggerConsole); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailNotifications(t *testing.T) {
+	s, recorder := newTestServer(t)
+	s.Config().Notifications.Email = &EmailConfig{Server: "localhost:25", From: "launcher@example.com", To: []string{"admin@example.com"}}
+	if err := s.Config().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	hasEmail := func(event string) bool {
+		for _, sink := range s.Config().NotifySinks(event) {
+			if _, ok := sink.(EmailSink); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasEmail(EventBackupFailed) || hasEmail(EventPlayerJoin) {
+		t.Error("email should only get the critical events by default")
+	}
+	message := string(emailMessage("a@example.com", []string{"b@example.com"}, "Бэкап", "line\nline", time.Now()))
+	if !strings.Contains(message, "Subject: =?utf-8?q?") || !strings.HasSuffix(message, "line\r\nline\r\n") {
+		t.Errorf("unexpected message:\n%v", message)
+	}
+
+	s.Config().Notifications.Email = nil
+	s.Config().DiskAlert = &DiskAlertConfig{MinFree: "1000000G"}
+	s.checkDiskSpace()
+	s.checkDiskSpace()
+	waitForNotification(t, recorder, EventDiskSpace)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	alerts := 0
+	for _, n := range recorder.events {
+		if n.Event == EventDiskSpace {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("expected one disk alert while the space stays low, got %v", alerts)
+	}
+}
+
+func TestAutoUpdate(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().AccessSchedule.Timezone = Location(*time.UTC)
+	s.Config().AutoUpdate = &AutoUpdateConfig{Day: Weekday(time.Monday), Start: DayTime{hours: 4}, End: DayTime{hours: 5}}
+	if err := s.Config().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&AutoUpdateConfig{Start: DayTime{hours: 5}, End: DayTime{hours: 4}}).Validate(); err == nil {
+		t.Error("window ending before it starts accepted")
+	}
+	// Sunday, October 13 2024
+	sunday := time.Date(2024, time.October, 13, 12, 0, 0, 0, time.UTC)
+	next, cmd := s.nextScheduled(sunday)
+	for next != nil && cmd == Backup {
+		next, cmd = s.nextScheduled(*next)
+	}
+	if cmd != AutoUpdate || next == nil || !next.Equal(time.Date(2024, time.October, 14, 4, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the auto-update on Monday 04:00, got %v at %v", cmd, next)
+	}
+	if !s.Config().AutoUpdate.Contains(next.Add(30*time.Minute)) || s.Config().AutoUpdate.Contains(next.Add(time.Hour)) {
+		t.Error("wrong window bounds")
+	}
+
+	build := func(number int, channel string, summary string) PaperBuild {
+		b := PaperBuild{Build: number, Channel: channel}
+		b.Changes = append(b.Changes, struct {
+			Summary string `json:"summary"`
+		}{summary})
+		return b
+	}
+	update := pendingUpdate{version: "1.21.4", geyser: "2.6.1", geyserBuild: BuildInfo{Build: 800}, builds: newerPaperBuilds([]PaperBuild{
+		build(230, "default", "Old fix"),
+		build(231, "default", "Fix chunk loading\n\nLong description"),
+		build(232, "experimental", "Risky change"),
+		build(233, "", "Update upstream"),
+	}, 230)}
+	if update.String() != "paper 1.21.4 #233, geyser 2.6.1 #800" {
+		t.Errorf("unexpected update %q", update)
+	}
+	for _, c := range []struct {
+		installed, latest string
+		patch             bool
+	}{{"2.6.0", "2.6.1", true}, {"2.6.1", "2.6.1", true}, {"2.5.3", "2.6.0", false}, {"2.6.1", "3.0.0", false}, {"2.6.2", "2.6.1", false}} {
+		if patchRelease(c.installed, c.latest) != c.patch {
+			t.Errorf("%v -> %v should be a patch release: %v", c.installed, c.latest, c.patch)
+		}
+	}
+	if changelog := update.changelog(); changelog != "#231: Fix chunk loading\n#233: Update upstream" {
+		t.Errorf("unexpected changelog %q", changelog)
+	}
+
+	workDir := s.Config().WorkDir
+	os.WriteFile(filepath.Join(workDir, "paper-1.21.4-230.jar"), []byte("old"), 0644)
+	if err := LinkFile(filepath.Join(workDir, "paper-1.21.4-230.jar"), filepath.Join(workDir, "paper.jar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveAutoUpdateFiles(workDir); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(workDir, "paper.jar"))
+	os.WriteFile(filepath.Join(workDir, "paper.jar"), []byte("new"), 0644)
+	os.MkdirAll(filepath.Join(workDir, "plugins", "update"), os.ModePerm)
+	os.WriteFile(filepath.Join(workDir, "plugins", "update", "Geyser-Spigot.jar"), []byte("new"), 0644)
+	if err := restoreAutoUpdateFiles(workDir); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(workDir, "paper.jar")); string(content) != "old" {
+		t.Errorf("paper.jar is %q after the rollback", content)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "plugins", "update", "Geyser-Spigot.jar")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("the pending geyser update survived the rollback")
+	}
+}
+
+func TestChatBridgeRoles(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().ChatBridge = ChatBridgeConfig{Operators: []string{"telegram:42"}, Admins: []string{"discord:7"}}
+	if err := s.Config().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (ChatBridgeConfig{Operators: []string{"Steve"}}).Validate(); err == nil {
+		t.Error("operator given by name accepted")
+	}
+	drain := func() []string {
+		var inputs []string
+		for cmd, ok := s.queue.Pop(); ok; cmd, ok = s.queue.Pop() {
+			inputs = append(inputs, cmd.Input)
+		}
+		return inputs
+	}
+	drain()
+	// Same display name as the operator, different account
+	s.handleChatBridgeCommand("telegram", ChatAuthor{Name: "Steve", ID: "43"}, "/cmd list")
+	s.handleChatBridgeCommand("discord", ChatAuthor{Name: "Steve", ID: "42"}, "/cmd list")
+	s.handleChatBridgeCommand("telegram", ChatAuthor{Name: "Steve", ID: "42"}, "/cmd stop")
+	if inputs := drain(); len(inputs) != 0 {
+		t.Errorf("unauthorized commands queued: %v", inputs)
+	}
+	s.handleChatBridgeCommand("telegram", ChatAuthor{Name: "Steve", ID: "42"}, "/cmd list")
+	s.handleChatBridgeCommand("discord", ChatAuthor{Name: "Alex", ID: "7"}, "/cmd stop")
+	if inputs := drain(); !slices.Equal(inputs, []string{"list", "stop"}) {
+		t.Errorf("unexpected commands %v", inputs)
+	}
+}
+
+func TestJoinApprovers(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().ChatBridge = ChatBridgeConfig{Telegram: &TelegramConfig{}, Admins: []string{"telegram:42"}}
+	s.Config().JoinApproval = &JoinApprovalConfig{}
+	if err := s.Config().Validate(); err == nil {
+		t.Error("join approval without approvers accepted")
+	}
+	s.Config().JoinApproval.Approvers = []string{"telegram:42"}
+	if err := s.Config().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, ok := s.queue.Pop(); ok; _, ok = s.queue.Pop() {
+	}
+	s.handleApprovalReply("telegram", ChatAuthor{Name: "Admin", ID: "43"}, "/approve Steve")
+	if cmd, ok := s.queue.Pop(); ok {
+		t.Errorf("approval by a spoofed name queued: %v", cmd)
+	}
+	s.handleApprovalReply("telegram", ChatAuthor{Name: "Admin", ID: "42"}, "/approve Steve")
+	if cmd, ok := s.queue.Pop(); !ok || cmd.Input != "approve Steve" {
+		t.Errorf("approval not queued: %v", cmd)
+	}
+}
+
+func TestSlowNotificationsDoNotBlock(t *testing.T) {
+	s, _ := newTestServer(t)
+	release := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(webhook.Close)
+	t.Cleanup(func() { close(release) })
+	s.Config().Notifications.Webhook = webhook.URL
+	started := time.Now()
+	for range NOTIFY_QUEUE_SIZE * 2 {
+		s.Notify(EventPlayerJoin, "joined", "")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("notifying took %v with a stuck webhook", elapsed)
+	}
+}
+
+func TestUpdateCountdown(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Config().WarnBefore = []Duration{Duration(time.Hour)}
+	startTestServer(t, s)
+	ctx := context.Background()
+	started := time.Now()
+	if err := s.Update(ctx, UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(started) > time.Second || s.countdown == nil {
+		t.Fatal("the countdown should run in the background")
+	}
+	waitForCommand(t, s, "say "+s.msg(MsgRestartUpdateIn, "1h"))
+	if !s.CancelCountdown() || s.CancelCountdown() {
+		t.Error("cancel-update should stop the countdown once")
+	}
+	if err := s.finishCountdown(ctx); err != nil || s.Status() != Running {
+		t.Errorf("cancelled update ran: %v, server is %v", err, s.Status())
+	}
+
+	s.Config().WarnBefore = []Duration{Duration(50 * time.Millisecond)}
+	ran := false
+	s.startCountdown(ctx, s.updateAnnouncement, time.Second, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	deadline := time.Now().Add(TEST_TIMEOUT)
+	for {
+		cmd, ok := s.queue.Pop()
+		if ok && cmd.IsInner && cmd.Inner == UpdateDue {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the countdown did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := s.finishCountdown(ctx); err != nil || !ran || s.countdown != nil {
+		t.Errorf("update after the countdown: ran %v, %v", ran, err)
+	}
+}
+
+func TestAbandonedListenRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gone := ListenRequest{query: "never", done: ctx.Done(), found: make(chan string, 1)}
+	waiting := ListenRequest{query: "Done", found: make(chan string, 1)}
+	cancel()
+	pending := matchPending([]ListenRequest{gone, waiting}, "Preparing level")
+	if len(pending) != 1 || pending[0].query != "Done" {
+		t.Fatalf("abandoned request kept: %v", pending)
+	}
+	if pending = matchPending(pending, "Done (3.2s)!"); len(pending) != 0 || <-waiting.found != "Done (3.2s)!" {
+		t.Error("line not delivered")
+	}
+}
+
+func TestReloadConfigConcurrently(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := writeJSON(s.ConfigPath, s.Config()); err != nil {
+		t.Fatal(err)
+	}
+	old := s.Config()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			for _, player := range s.Config().Players {
+				_ = player.ServerName()
+			}
+		}
+	}()
+	for range 10 {
+		if err := s.ReloadConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if s.Config() == old || len(old.Players) != 2 {
+		t.Error("reload should swap in a new config and leave the old one intact")
+	}
+}
+
+func TestRequiredRole(t *testing.T) {
+	for input, role := range map[string]Role{
+		"!status":            Viewer,
+		"say hello":          Operator,
+		"backup":             Operator,
+		"op Steve":           Admin,
+		"whitelist add Bob":  Admin,
+		"ban-ip 1.2.3.4":     Admin,
+		"update now":         Admin,
+		"!pause-schedule 2h": Admin,
+		"!resume-schedule":   Admin,
+		"some-plugin-cmd":    Admin,
+	} {
+		if got := RequiredRole(input); got != role {
+			t.Errorf("%q requires %v, expected %v", input, got, role)
+		}
+	}
+}
+
+type fakeRouter struct {
+	mapped map[portMapping]bool
+}
+
+func (r *fakeRouter) Map(m portMapping) error {
+	r.mapped[m] = true
+	return nil
+}
+
+func (r *fakeRouter) Unmap(m portMapping) error {
+	delete(r.mapped, m)
+	return nil
+}
+
+func (r *fakeRouter) ExternalIP() (string, error) {
+	return "203.0.113.1", nil
+}
+
+func TestPortMapper(t *testing.T) {
+	router := &fakeRouter{mapped: make(map[portMapping]bool)}
+	p := &PortMapper{router: router}
+	for range 2 {
+		if ip, err := p.Open(PortMappingConfig{Enabled: true}); err != nil || ip != "203.0.113.1" {
+			t.Fatalf("open: %v, %v", ip, err)
+		}
+	}
+	if len(p.mapped) != 2 || p.cancel == nil {
+		t.Errorf("expected two renewed mappings, got %v", p.mapped)
+	}
+	if err := p.Close(); err != nil || len(router.mapped) != 0 || p.cancel != nil {
+		t.Errorf("mappings left after close: %v, %v", router.mapped, err)
+	}
+}
+
+func TestPrefixHandlerKeepsAttrs(t *testing.T) {
+	var out strings.Builder
+	logger := slog.New(&prefixHandler{out: &out, level: slog.LevelInfo, mu: &sync.Mutex{}})
+	logger.With("source", "server").WithGroup("backup").Warn("Backup failed", "trigger", "manual")
+	if want := "[WARN] Backup failed source=server backup.trigger=manual\n"; out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestRestoreFileKeepsEarlierCopies(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "world", "playerdata", "uuid.dat")
+	for i, suffix := range []string{".before-rollback-1", ".before-rollback-2"} {
+		if err := restoreFile(target, suffix, strings.NewReader(strconv.Itoa(i)), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if kept, err := os.ReadFile(target + ".before-rollback-2"); err != nil || string(kept) != "0" {
+		t.Errorf("expected the first restore to be kept, got %q, %v", kept, err)
+	}
+	if err := restoreFile(target, ".before-rollback-2", strings.NewReader("2"), time.Now()); err == nil {
+		t.Error("a kept file was overwritten")
+	}
+}
+
+func TestMigrateVersionsInfo(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := t.TempDir()
+	if err := os.Chdir(legacy); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	os.WriteFile(VERSIONS_FILE, []byte(`{"paper":{"version":"1.21.4","build":230}}`), 0644)
+	first, second := t.TempDir(), t.TempDir()
+	for _, dir := range []string{first, second} {
+		if err := MigrateVersionsInfo(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := LoadVersionsInfo(first); err != nil {
+		t.Errorf("the first instance did not get the version file: %v", err)
+	}
+	if _, err := LoadVersionsInfo(second); err == nil {
+		t.Error("the second instance read the versions of the first one")
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	workDir := filepath.Join(t.TempDir(), "server")
+	auditLog := workDir + "-audit.log"
+	os.WriteFile(auditLog, bytes.Repeat([]byte("x"), AUDIT_LOG_MAX_SIZE), 0644)
+	var audit AuditTrail
+	audit.Record(workDir, ConsoleCommand("list", OriginLauncher, PriorityAdmin))
+	if stat, err := os.Stat(auditLog + ".1"); err != nil || stat.Size() != AUDIT_LOG_MAX_SIZE {
+		t.Fatalf("full audit log not rotated: %v", err)
+	}
+	if content, _ := os.ReadFile(auditLog); !strings.Contains(string(content), "list") || len(content) > 100 {
+		t.Errorf("unexpected audit log %q", content)
+	}
+}
+
+func TestRemoteConsoleAuth(t *testing.T) {
+	for _, c := range []struct {
+		config RemoteConsoleConfig
+		valid  bool
+	}{
+		{RemoteConsoleConfig{Listen: "127.0.0.1:8080"}, true},
+		{RemoteConsoleConfig{Listen: "localhost:8080"}, true},
+		{RemoteConsoleConfig{Listen: ":8080"}, false},
+		{RemoteConsoleConfig{Listen: ":8080", Insecure: true}, true},
+		{RemoteConsoleConfig{Listen: ":8080", CertFile: "cert.pem", KeyFile: "key.pem"}, true},
+		{RemoteConsoleConfig{Listen: ":8080", CertFile: "cert.pem"}, false},
+	} {
+		if err := c.config.Validate(); (err == nil) != c.valid {
+			t.Errorf("%+v: valid %v, got %v", c.config, c.valid, err)
+		}
+	}
+
+	s, _ := newTestServer(t)
+	s.Config().Users = []User{{Name: "admin", Token: "secret", Role: Admin}}
+	console := httptest.NewServer(http.HandlerFunc(s.handleConsole))
+	defer console.Close()
+	url := "ws" + strings.TrimPrefix(console.URL, "http")
+	queued := func(input string) bool {
+		deadline := time.Now().Add(TEST_TIMEOUT)
+		for time.Now().Before(deadline) {
+			if cmd, ok := s.queue.Pop(); ok && cmd.Input == input {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+	for _, c := range []struct {
+		url      string
+		header   http.Header
+		messages []string
+		ok       bool
+	}{
+		{url + "?token=secret", nil, []string{"list"}, false},
+		{url, http.Header{"Authorization": {"Bearer secret"}}, []string{"list"}, true},
+		{url, nil, []string{"secret", "list"}, true},
+		{url, nil, []string{"wrong", "list"}, false},
+	} {
+		conn, _, err := websocket.DefaultDialer.Dial(c.url, c.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, message := range c.messages {
+			conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+		if c.ok && !queued("list") {
+			t.Errorf("%v: command not queued", c.messages)
+		}
+		if !c.ok {
+			conn.SetReadDeadline(time.Now().Add(TEST_TIMEOUT))
+			if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Errorf("%v %v: expected unauthorized, got %v", c.url, c.messages, err)
+			}
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,94 @@
+package launcherrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Client talks to the launcher managing a work dir
+type Client struct {
+	http   *http.Client
+	nextID atomic.Int64
+}
+
+// Dial returns a client for the launcher running in workDir. Nothing is connected
+// until the first call, a launcher that is not running fails the calls.
+func Dial(workDir string) *Client {
+	path := filepath.Join(workDir, SocketFile)
+	return &Client{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}}
+}
+
+// Call sends the request and decodes the result into result unless it is nil.
+// Errors returned by the launcher are *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	request := Request{JSONRPC: "2.0", Method: method}
+	request.ID, _ = json.Marshal(c.nextID.Add(1))
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		request.Params = encoded
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://launcher"+Path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpResponse, err := c.http.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	var response Response
+	if err := json.NewDecoder(httpResponse.Body).Decode(&response); err != nil {
+		return fmt.Errorf("error decoding the response (%v): %w", httpResponse.Status, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.Call(ctx, MethodStatus, nil, &status)
+	return status, err
+}
+
+func (c *Client) Open(ctx context.Context) error {
+	return c.Call(ctx, MethodOpen, nil, nil)
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	return c.Call(ctx, MethodClose, nil, nil)
+}
+
+// Command runs a console command and returns its output, collected until the output
+// has been quiet for idle
+func (c *Client) Command(ctx context.Context, command string, idle time.Duration) ([]string, error) {
+	var result CommandResult
+	err := c.Call(ctx, MethodCommand, CommandParams{Command: command, Idle: Duration(idle)}, &result)
+	return result.Output, err
+}
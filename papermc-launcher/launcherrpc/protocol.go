@@ -0,0 +1,108 @@
+// Package launcherrpc is the client side of the launcher control protocol: JSON-RPC 2.0
+// over HTTP on the launcher.sock socket in the server work dir.
+//
+// The protocol is versioned by its path, incompatible changes get a new path and
+// the launcher keeps serving the old one. Batch requests are not supported.
+package launcherrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Path of version 1 of the protocol on the socket
+const Path = "/rpc/v1"
+
+// Name of the socket in the work dir
+const SocketFile = "launcher.sock"
+
+// Methods of version 1
+const (
+	// Status of the server, no params, returns Status
+	MethodStatus = "status"
+	// Opens the server to the players as the schedule would, no params
+	MethodOpen = "open"
+	// Closes the server as the schedule would, no params
+	MethodClose = "close"
+	// Runs a console command, CommandParams, returns CommandResult
+	MethodCommand = "command"
+)
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeServerError    = -32000
+)
+
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("launcher error %v: %v", e.Code, e.Message)
+}
+
+type ScheduledEvent struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+}
+
+// Result of MethodStatus, the fields of the launcher's status report a client needs
+type Status struct {
+	// stopped, starting, running, stopping or backup
+	State       string           `json:"state"`
+	Since       time.Time        `json:"since"`
+	Asleep      bool             `json:"asleep,omitempty"`
+	PausedUntil *time.Time       `json:"paused_until,omitempty"`
+	Players     []string         `json:"players"`
+	NextEvents  []ScheduledEvent `json:"next_events"`
+}
+
+type CommandParams struct {
+	Command string `json:"command"`
+	// How long the output has to be quiet before it is returned, a second by default
+	Idle Duration `json:"idle,omitempty"`
+}
+
+type CommandResult struct {
+	Output []string `json:"output"`
+}
+
+// Duration encoded as a Go duration string like "3s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type ResourceLimits struct {
+	// Number of CPUs the server may use, e.g. 1.5
+	CPUs float64 `json:"cpus,omitempty"`
+	// Hard memory limit of the whole java process, e.g. 6G
+	MemoryMax string `json:"memory_max,omitempty"`
+	// cgroup v2 to put the server into, relative to /sys/fs/cgroup. Has to be delegated to the launcher user.
+	Cgroup string `json:"cgroup,omitempty"`
+	// Used directly or when cgroups are not available
+	Nice    int    `json:"nice,omitempty"`
+	IOClass string `json:"io_class,omitempty"`
+}
+
+const DEFAULT_CGROUP = "papermc-launcher"
+const FALLBACK_NICE = 10
+
+func (l ResourceLimits) NeedsCgroup() bool {
+	return l.CPUs > 0 || l.MemoryMax != ""
+}
+
+func (l ResourceLimits) Validate() error {
+	if l.CPUs < 0 {
+		return fmt.Errorf("cpus should not be negative")
+	}
+	if l.MemoryMax != "" {
+		if _, err := ParseSize(l.MemoryMax); err != nil {
+			return err
+		}
+	}
+	if l.Nice < -20 || l.Nice > 19 {
+		return fmt.Errorf("nice should be in [-20, 19]")
+	}
+	switch l.IOClass {
+	case "", "idle", "best-effort", "realtime":
+		return nil
+	default:
+		return fmt.Errorf("invalid io_class %q", l.IOClass)
+	}
+}
+
+// ParseSize parses java style sizes like 512M or 4G into bytes
+func ParseSize(value string) (int64, error) {
+	if !memoryRegexp.MatchString(value) {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// Prefixes the command with nice and ionice when they are requested or needed as a fallback
+func wrapWithPriority(args []string, limits ResourceLimits, fallback bool) []string {
+	nice := limits.Nice
+	if nice == 0 && fallback {
+		nice = FALLBACK_NICE
+	}
+	ioClass := limits.IOClass
+	if ioClass == "" && fallback {
+		ioClass = "best-effort"
+	}
+	if ioClass != "" {
+		if path, err := exec.LookPath("ionice"); err == nil {
+			classes := map[string]string{"realtime": "1", "best-effort": "2", "idle": "3"}
+			prefix := []string{path, "-c", classes[ioClass]}
+			if ioClass == "best-effort" {
+				prefix = append(prefix, "-n", "7")
+			}
+			args = append(prefix, args...)
+		} else {
+			warnf("ionice is not available, io_class is ignored")
+		}
+	}
+	if nice != 0 {
+		if path, err := exec.LookPath("nice"); err == nil {
+			args = append([]string{path, "-n", strconv.Itoa(nice)}, args...)
+		} else {
+			warnf("nice is not available, nice is ignored")
+		}
+	}
+	return args
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const CGROUP_ROOT = "/sys/fs/cgroup"
+const CPU_PERIOD = 100000
+
+// Creates the cgroup and writes the limits into it. Returns the cgroup directory.
+func prepareCgroup(limits ResourceLimits) (string, error) {
+	if _, err := os.Stat(filepath.Join(CGROUP_ROOT, "cgroup.controllers")); err != nil {
+		return "", errors.New("cgroup v2 is not mounted")
+	}
+	name := limits.Cgroup
+	if name == "" {
+		name = DEFAULT_CGROUP
+	}
+	dir := filepath.Join(CGROUP_ROOT, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if limits.CPUs > 0 {
+		quota := int(limits.CPUs * CPU_PERIOD)
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, CPU_PERIOD)), 0644); err != nil {
+			return "", err
+		}
+	}
+	if limits.MemoryMax != "" {
+		size, err := ParseSize(limits.MemoryMax)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatInt(size, 10)), 0644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func joinCgroup(dir string, pid int) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
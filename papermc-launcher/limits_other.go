@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func prepareCgroup(limits ResourceLimits) (string, error) {
+	return "", errors.New("cgroups are only available on linux")
+}
+
+func joinCgroup(dir string, pid int) error {
+	return errors.New("cgroups are only available on linux")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const LOCK_RETRY_INTERVAL = 500 * time.Millisecond
+
+// Locks older than this are considered left over by a killed process
+const LOCK_STALE_AFTER = 10 * time.Minute
+
+// AcquireLockFile creates path exclusively with our PID inside, waiting up to timeout
+// for another holder to release it. Returns the function releasing the lock.
+func AcquireLockFile(path string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if stat, err := os.Stat(path); err == nil && time.Since(stat.ModTime()) > LOCK_STALE_AFTER {
+			warnf("Removing stale lock %v", path)
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%v is locked by process %v", path, lockHolder(path))
+		}
+		time.Sleep(LOCK_RETRY_INTERVAL)
+	}
+}
+
+func lockHolder(path string) string {
+	pid, err := lockPid(path)
+	if err != nil {
+		return "unknown"
+	}
+	return strconv.Itoa(pid)
+}
+
+func lockPid(path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// Held by the launcher managing the server for as long as it runs
+const INSTANCE_LOCK_FILE = "launcher.lock"
+
+// AcquireInstanceLock makes sure only one launcher manages the work dir.
+// A lock left by a process which is no longer running is taken over.
+func AcquireInstanceLock(dir string) (func(), error) {
+	path := filepath.Join(dir, INSTANCE_LOCK_FILE)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		pid, err := lockPid(path)
+		if err == nil && pid != os.Getpid() && processAlive(pid) {
+			return nil, fmt.Errorf("%w: another launcher (PID %v) is already managing %v, remove %v if it is not running", ErrLocked, pid, dir, path)
+		}
+		warnf("Removing stale lock %v", path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// The log file is rotated when it grows past this size
+const LOG_MAX_SIZE = 10 << 20
+
+// Rotated log files kept as <file>.1 .. <file>.N
+const LOG_MAX_FILES = 5
+
+type LogOptions struct {
+	// debug, info, warn or error
+	Level string
+	// text prints the messages as before with a [LEVEL] prefix, json prints one object per line
+	Format string
+	// Also write the log as JSON to this file, rotated by size
+	File string
+}
+
+func parseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// SetupLogging makes slog and log write through the launcher's handlers.
+// JSON records carry the component and the instance, the work dir the launcher manages,
+// the text console leaves them out to stay readable.
+func SetupLogging(options LogOptions, instance string) (func(), error) {
+	level, err := parseLevel(options.Level)
+	if err != nil {
+		return nil, err
+	}
+	base := []slog.Attr{slog.String("component", "papermc-launcher"), slog.String("instance", instance)}
+	var console slog.Handler
+	switch options.Format {
+	case "", "text":
+		console = &prefixHandler{out: os.Stdout, level: level, mu: &sync.Mutex{}}
+	case "json":
+		console = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}).WithAttrs(base)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", options.Format)
+	}
+	handlers := []slog.Handler{console}
+	closeLog := func() {}
+	if options.File != "" {
+		file, err := openRotatingFile(options.File, LOG_MAX_SIZE, LOG_MAX_FILES)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, slog.NewJSONHandler(file, &slog.HandlerOptions{Level: level}).WithAttrs(base))
+		closeLog = func() { file.Close() }
+	}
+	slog.SetDefault(slog.New(fanoutHandler(handlers)))
+	log.SetFlags(0)
+	return closeLog, nil
+}
+
+func infof(format string, args ...any) {
+	slog.Info(fmt.Sprintf(format, args...))
+}
+
+func warnf(format string, args ...any) {
+	slog.Warn(fmt.Sprintf(format, args...))
+}
+
+func errorf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+}
+
+// Prints records as the launcher always did: [WARN] message, info without a prefix,
+// followed by the logger and the record attributes.
+type prefixHandler struct {
+	out   io.Writer
+	level slog.Level
+	mu    *sync.Mutex
+	attrs []slog.Attr
+	group string
+}
+
+func (h *prefixHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *prefixHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if r.Level != slog.LevelInfo {
+		fmt.Fprintf(&b, "[%v] ", r.Level)
+	}
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		fmt.Fprintf(&b, " %v", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %v%v", h.group, a)
+		return true
+	})
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+func (h *prefixHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		a.Key = h.group + a.Key
+		clone.attrs = append(clone.attrs, a)
+	}
+	return &clone
+}
+
+func (h *prefixHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group = h.group + name + "."
+	return &clone
+}
+
+// Sends every record to all handlers
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// Appends to a file and moves it to <path>.1 once it grows past maxSize
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	return r, r.open()
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size+int64(len(p)) > r.maxSize && r.size > 0 {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%v.%v", r.path, r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%v.%v", r.path, i), fmt.Sprintf("%v.%v", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	EventCrash             = "crash"
+	EventPlayerJoin        = "player_join"
+	EventPlayerLeave       = "player_leave"
+	EventDailySummary      = "daily_summary"
+	EventTpsAlert          = "tps_alert"
+	EventProfile           = "profile"
+	EventHeapPressure      = "heap_pressure"
+	EventScheduleOpen      = "schedule_open"
+	EventScheduleClose     = "schedule_close"
+	EventBackupFailed      = "backup_failed"
+	EventWhitelistMismatch = "whitelist_mismatch"
+	EventCloseDelayed      = "close_delayed"
+	EventBackupGrowth      = "backup_growth"
+	EventGrief             = "grief"
+	EventCrashLoop         = "crash_loop"
+	EventDiskSpace         = "disk_space"
+	EventAutoUpdate        = "auto_update"
+)
+
+const (
+	ChannelConsole  = "console"
+	ChannelWebhook  = "webhook"
+	ChannelTelegram = "telegram"
+	ChannelDiscord  = "discord"
+)
+
+// Route used for events without an explicit one
+const DEFAULT_ROUTE = "*"
+
+type Notification struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Details string    `json:"details,omitempty"`
+	// Notifications of the event held back by the rate limit since the previous one
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+type NotificationsConfig struct {
+	Webhook string `json:"webhook,omitempty"`
+	// Chat bridge channels are used when these are not set
+	Telegram *TelegramConfig `json:"telegram,omitempty"`
+	Discord  *DiscordConfig  `json:"discord,omitempty"`
+	// Mailed only for the critical events unless routed explicitly
+	Email *EmailConfig `json:"email,omitempty"`
+	// Event name (or "*") to the list of channels it goes to,
+	// events without a route go to every configured channel
+	Routes map[string][]string `json:"routes,omitempty"`
+	// Event name (or "*") to the minimal time between its notifications,
+	// the console still gets every one
+	RateLimits map[string]Duration `json:"rate_limits,omitempty"`
+	// Event name (or "*") to the text/template of the telegram and discord messages,
+	// executed with the Notification
+	Templates map[string]string `json:"templates,omitempty"`
+}
+
+// Per event lookup with the DEFAULT_ROUTE fallback
+func forEvent[T any](values map[string]T, event string) (T, bool) {
+	value, ok := values[event]
+	if !ok {
+		value, ok = values[DEFAULT_ROUTE]
+	}
+	return value, ok
+}
+
+// Text of the notification for the chat channels, from the template when configured
+func (c NotificationsConfig) Text(n Notification) string {
+	text, ok := forEvent(c.Templates, n.Event)
+	if !ok {
+		return notificationText(n)
+	}
+	tmpl, err := template.New(n.Event).Parse(text)
+	if err != nil {
+		return notificationText(n)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, n); err != nil {
+		warnf("Failed to render the %v notification: %v", n.Event, err)
+		return notificationText(n)
+	}
+	return b.String()
+}
+
+// Holds back notifications of an event that come more often than its rate limit
+type NotifyLimiter struct {
+	mu    sync.Mutex
+	state map[string]*limiterState
+}
+
+type limiterState struct {
+	last       time.Time
+	suppressed int
+}
+
+// Allow reports whether the event may be sent now and how many were held back before it
+func (l *NotifyLimiter) Allow(event string, limit time.Duration, at time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == nil {
+		l.state = make(map[string]*limiterState)
+	}
+	state, ok := l.state[event]
+	if !ok {
+		l.state[event] = &limiterState{last: at}
+		return true, 0
+	}
+	if at.Sub(state.last) < limit {
+		state.suppressed++
+		return false, 0
+	}
+	suppressed := state.suppressed
+	*state = limiterState{last: at}
+	return true, suppressed
+}
+
+type NotifySink interface {
+	Send(n Notification) error
+}
+
+type ConsoleSink struct{}
+
+func (ConsoleSink) Send(n Notification) error {
+	infof("[Notify %v]: %v", n.Event, n.Message)
+	if n.Details != "" {
+		slog.Info(n.Details)
+	}
+	return nil
+}
+
+// Posts notifications as JSON to an arbitrary URL
+type WebhookSink struct {
+	URL string
+}
+
+func (w WebhookSink) Send(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %v", resp.Status)
+	}
+	return nil
+}
+
+// Sends notifications to the telegram chat
+type TelegramSink struct {
+	Client *TelegramClient
+	Format func(Notification) string
+}
+
+func (t TelegramSink) Send(n Notification) error {
+	return t.Client.Send(t.Format(n))
+}
+
+// Sends notifications to the discord channel
+type DiscordSink struct {
+	Client *DiscordClient
+	Format func(Notification) string
+}
+
+func (d DiscordSink) Send(n Notification) error {
+	return d.Client.Send(d.Format(n))
+}
+
+func notificationText(n Notification) string {
+	text := fmt.Sprintf("[%v] %v", n.Event, n.Message)
+	if n.Details != "" {
+		text += "\n" + n.Details
+	}
+	if n.Suppressed > 0 {
+		text += fmt.Sprintf("\n(%v similar notifications suppressed)", n.Suppressed)
+	}
+	return text
+}
+
+// Configured notification channels by name
+func (c *Config) NotifyChannels() map[string]NotifySink {
+	channels := map[string]NotifySink{ChannelConsole: ConsoleSink{}}
+	if c.Notifications.Webhook != "" {
+		channels[ChannelWebhook] = WebhookSink{URL: c.Notifications.Webhook}
+	}
+	telegram := c.Notifications.Telegram
+	if telegram == nil {
+		telegram = c.ChatBridge.Telegram
+	}
+	if telegram != nil {
+		channels[ChannelTelegram] = TelegramSink{&TelegramClient{Config: *telegram}, c.Notifications.Text}
+	}
+	discord := c.Notifications.Discord
+	if discord == nil {
+		discord = c.ChatBridge.Discord
+	}
+	if discord != nil {
+		channels[ChannelDiscord] = DiscordSink{&DiscordClient{Config: *discord}, c.Notifications.Text}
+	}
+	if c.Notifications.Email != nil {
+		channels[ChannelEmail] = EmailSink{*c.Notifications.Email, c.Notifications.Text}
+	}
+	return channels
+}
+
+// NotifySinks returns the channels the event is routed to
+func (c *Config) NotifySinks(event string) []NotifySink {
+	channels := c.NotifyChannels()
+	route, ok := forEvent(c.Notifications.Routes, event)
+	var sinks []NotifySink
+	if !ok {
+		for name, sink := range channels {
+			if name == ChannelEmail && !c.Notifications.Email.wants(event) {
+				continue
+			}
+			sinks = append(sinks, sink)
+		}
+		return sinks
+	}
+	for _, name := range route {
+		if sink, ok := channels[name]; ok {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+func (c *Config) validateRoutes() error {
+	if c.Notifications.Email != nil {
+		if err := c.Notifications.Email.Validate(); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+	}
+	channels := c.NotifyChannels()
+	for event, route := range c.Notifications.Routes {
+		for _, name := range route {
+			if _, ok := channels[name]; !ok {
+				return fmt.Errorf("route for %v uses channel %q which is not configured", event, name)
+			}
+		}
+	}
+	for event, text := range c.Notifications.Templates {
+		if _, err := template.New(event).Parse(text); err != nil {
+			return fmt.Errorf("template for %v: %w", event, err)
+		}
+	}
+	for event, limit := range c.Notifications.RateLimits {
+		if limit < 0 {
+			return fmt.Errorf("rate limit for %v should not be negative", event)
+		}
+	}
+	return nil
+}
+
+// Notifications waiting for the network channels, more are dropped
+const NOTIFY_QUEUE_SIZE = 64
+
+// How long the shutdown waits for the queued notifications to go out
+const NOTIFY_FLUSH_TIMEOUT = 10 * time.Second
+
+// Sends notifications to the network channels one by one in the background, so a slow
+// webhook does not hold up the caller, the output analyzer among others
+type NotifyQueue struct {
+	once    sync.Once
+	pending chan func()
+}
+
+func (q *NotifyQueue) start() {
+	q.once.Do(func() {
+		q.pending = make(chan func(), NOTIFY_QUEUE_SIZE)
+		go func() {
+			for send := range q.pending {
+				send()
+			}
+		}()
+	})
+}
+
+// Push queues the send, false when the queue is full and it is dropped
+func (q *NotifyQueue) Push(send func()) bool {
+	q.start()
+	select {
+	case q.pending <- send:
+		return true
+	default:
+		return false
+	}
+}
+
+// Flush waits until the notifications queued so far are sent, at most the timeout
+func (q *NotifyQueue) Flush(timeout time.Duration) bool {
+	q.start()
+	done := make(chan struct{})
+	deadline := time.After(timeout)
+	select {
+	case q.pending <- func() { close(done) }:
+	case <-deadline:
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-deadline:
+		return false
+	}
+}
+
+// Notify prints the notification right away and queues it for the other channels
+func (s *Server) Notify(event, message, details string) {
+	n := Notification{Event: event, Time: time.Now(), Message: message, Details: details}
+	limited := false
+	if limit, ok := forEvent(s.Config().Notifications.RateLimits, event); ok && limit > 0 {
+		var allowed bool
+		allowed, n.Suppressed = s.notifyLimiter.Allow(event, time.Duration(limit), n.Time)
+		limited = !allowed
+	}
+	for _, sink := range s.Config().NotifySinks(event) {
+		if _, console := sink.(ConsoleSink); console {
+			sink.Send(n)
+			continue
+		}
+		if limited {
+			continue
+		}
+		queued := s.notifications.Push(func() {
+			if err := sink.Send(n); err != nil {
+				warnf("Failed to send %v notification: %v", event, err)
+			}
+		})
+		if !queued {
+			warnf("Notification queue is full, dropping the %v notification", event)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const OPS_FILE = "ops.json"
+
+// Entry of the server's ops.json
+type OpEntry struct {
+	UUID                string `json:"uuid"`
+	Name                string `json:"name"`
+	Level               int    `json:"level"`
+	BypassesPlayerLimit bool   `json:"bypassesPlayerLimit"`
+}
+
+func LoadOps(dir string) ([]OpEntry, error) {
+	file, err := os.Open(filepath.Join(dir, OPS_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening ops file: %w", err)
+	}
+	defer file.Close()
+
+	var ops []OpEntry
+	if err := json.NewDecoder(file).Decode(&ops); err != nil {
+		return nil, fmt.Errorf("error decoding ops file: %w", err)
+	}
+	return ops, nil
+}
+
+// OpCommands returns the console commands that make the server operators
+// match the players marked with `op` in the config. Operators which are not
+// flagged in the config are deopped, so the config stays the only source.
+func OpCommands(players []Player, ops []OpEntry) []string {
+	current := make(map[string]bool)
+	for _, op := range ops {
+		current[strings.ToLower(op.Name)] = true
+	}
+	wanted := make(map[string]bool)
+	var commands []string
+	for _, player := range players {
+		if !player.Op {
+			continue
+		}
+		name := player.ServerName()
+		wanted[strings.ToLower(name)] = true
+		if !current[strings.ToLower(name)] {
+			commands = append(commands, fmt.Sprintf("op %v", name))
+		}
+	}
+	for _, op := range ops {
+		if !wanted[strings.ToLower(op.Name)] {
+			commands = append(commands, fmt.Sprintf("deop %v", op.Name))
+		}
+	}
+	return commands
+}
+
+func (s *Server) ReconcileOps() error {
+	ops, err := LoadOps(s.Config().WorkDir)
+	if err != nil {
+		return err
+	}
+	commands := OpCommands(s.Config().Players, ops)
+	if len(commands) == 0 {
+		infof("Operators are up to date")
+		return nil
+	}
+	for _, command := range commands {
+		infof("Reconciling operators: %v", command)
+	}
+	return s.SendBatch(s.runningCtx, commands)
+}
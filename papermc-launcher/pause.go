@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Upper bound of !pause-schedule, a forgotten pause should not disable the schedule for weeks
+const MAX_SCHEDULE_PAUSE = 24 * time.Hour
+
+// When the paused schedule resumes, nil while it is not paused
+func (s *Server) schedulePausedUntil() *time.Time {
+	until := s.pausedUntil.Load()
+	if until == nil || !time.Now().Before(*until) {
+		return nil
+	}
+	return until
+}
+
+// Whether the command is a scheduled action suspended by !pause-schedule
+func (s *Server) pausedBySchedule(cmd Command) bool {
+	if cmd.Origin != OriginSchedule || s.schedulePausedUntil() == nil {
+		return false
+	}
+	infof("Schedule paused, skipping %v", cmd)
+	return true
+}
+
+// PauseSchedule suspends the scheduled open, close, backup and sleep actions for d.
+// Pausing again replaces the previous pause.
+func (s *Server) PauseSchedule(d time.Duration) error {
+	if d <= 0 || d > MAX_SCHEDULE_PAUSE {
+		return fmt.Errorf("the pause has to be between 0 and %v", MAX_SCHEDULE_PAUSE)
+	}
+	until := time.Now().Add(d)
+	s.pausedUntil.Store(&until)
+	if s.pauseTimer != nil {
+		s.pauseTimer.Stop()
+	}
+	s.pauseTimer = time.AfterFunc(d, func() {
+		s.queue.Push(ConsoleCommand("!resume-schedule", OriginLauncher, PriorityAdmin))
+	})
+	s.reply(s.msg(MsgSchedulePaused, until.Format("15:04")))
+	return nil
+}
+
+// ResumeSchedule ends the pause and catches up with the schedule: the server closes
+// or opens as it would have, skipped backups are not made up for
+func (s *Server) ResumeSchedule(ctx context.Context) {
+	if s.pausedUntil.Swap(nil) == nil {
+		s.reply("Schedule is not paused")
+		return
+	}
+	if s.pauseTimer != nil {
+		s.pauseTimer.Stop()
+		s.pauseTimer = nil
+	}
+	s.reply(s.msg(MsgScheduleResumed))
+	now := time.Now()
+	wasAsleep := s.asleep.Load()
+	if wasAsleep {
+		if !s.awakeAt(now) {
+			return
+		}
+		if err := s.wakeUp(ctx); err != nil {
+			errorf("Failed to start the server: %v", err)
+			return
+		}
+	}
+	_, open := s.Config().AccessSchedule.ClosingTime(now)
+	switch {
+	case open:
+		s.queue.Push(InnerCommand(OpenAccess, OriginLauncher))
+	case !wasAsleep:
+		// Woken up for the warm-up the server stays closed anyway
+		s.queue.Push(InnerCommand(CloseAccess, OriginLauncher))
+	}
+}
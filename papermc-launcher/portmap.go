@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huin/goupnp"
+	"github.com/huin/goupnp/dcps/internetgateway2"
+	"github.com/jackpal/gateway"
+	natpmp "github.com/jackpal/go-nat-pmp"
+)
+
+const DEFAULT_JAVA_PORT = 25565
+const DEFAULT_BEDROCK_PORT = 19132
+
+// Mappings expire so a killed launcher does not leave the ports open for good,
+// they are renewed at half of the lifetime
+const PORT_MAPPING_LIFETIME = 2 * time.Hour
+
+// UPnP error of the routers that only accept permanent mappings
+const UPNP_ONLY_PERMANENT_LEASES = "725"
+
+type PortMappingConfig struct {
+	Enabled     bool `json:"enabled"`
+	JavaPort    int  `json:"java_port,omitempty"`
+	BedrockPort int  `json:"bedrock_port,omitempty"`
+}
+
+type portMapping struct {
+	protocol string
+	port     int
+}
+
+func (c PortMappingConfig) mappings() []portMapping {
+	java, bedrock := c.JavaPort, c.BedrockPort
+	if java == 0 {
+		java = DEFAULT_JAVA_PORT
+	}
+	if bedrock == 0 {
+		bedrock = DEFAULT_BEDROCK_PORT
+	}
+	return []portMapping{{"TCP", java}, {"UDP", bedrock}}
+}
+
+// Common part of the UPnP WAN connection services
+type upnpClient interface {
+	AddPortMapping(NewRemoteHost string, NewExternalPort uint16, NewProtocol string, NewInternalPort uint16, NewInternalClient string, NewEnabled bool, NewPortMappingDescription string, NewLeaseDuration uint32) error
+	DeletePortMapping(NewRemoteHost string, NewExternalPort uint16, NewProtocol string) error
+	GetExternalIPAddress() (string, error)
+	GetServiceClient() *goupnp.ServiceClient
+}
+
+type router interface {
+	Map(m portMapping) error
+	Unmap(m portMapping) error
+	ExternalIP() (string, error)
+}
+
+type upnpRouter struct {
+	client upnpClient
+}
+
+func (r upnpRouter) Map(m portMapping) error {
+	local := r.client.GetServiceClient().LocalAddr().String()
+	err := r.client.AddPortMapping("", uint16(m.port), m.protocol, uint16(m.port), local, true, "papermc-launcher", uint32(PORT_MAPPING_LIFETIME.Seconds()))
+	if err != nil && strings.Contains(err.Error(), UPNP_ONLY_PERMANENT_LEASES) {
+		warnf("Router only accepts permanent port mappings, %v %v stays open if the launcher is killed", m.protocol, m.port)
+		return r.client.AddPortMapping("", uint16(m.port), m.protocol, uint16(m.port), local, true, "papermc-launcher", 0)
+	}
+	return err
+}
+
+func (r upnpRouter) Unmap(m portMapping) error {
+	return r.client.DeletePortMapping("", uint16(m.port), m.protocol)
+}
+
+func (r upnpRouter) ExternalIP() (string, error) {
+	return r.client.GetExternalIPAddress()
+}
+
+type natpmpRouter struct {
+	client *natpmp.Client
+}
+
+func (r natpmpRouter) Map(m portMapping) error {
+	_, err := r.client.AddPortMapping(strings.ToLower(m.protocol), m.port, m.port, int(PORT_MAPPING_LIFETIME.Seconds()))
+	return err
+}
+
+func (r natpmpRouter) Unmap(m portMapping) error {
+	_, err := r.client.AddPortMapping(strings.ToLower(m.protocol), m.port, 0, 0)
+	return err
+}
+
+func (r natpmpRouter) ExternalIP() (string, error) {
+	result, err := r.client.GetExternalAddress()
+	if err != nil {
+		return "", err
+	}
+	return net.IP(result.ExternalIPAddress[:]).String(), nil
+}
+
+// Finds the home router, preferring UPnP and falling back to NAT-PMP
+func discoverRouter() (router, error) {
+	if clients, _, err := internetgateway2.NewWANIPConnection2Clients(); err == nil && len(clients) > 0 {
+		return upnpRouter{clients[0]}, nil
+	}
+	if clients, _, err := internetgateway2.NewWANIPConnection1Clients(); err == nil && len(clients) > 0 {
+		return upnpRouter{clients[0]}, nil
+	}
+	if clients, _, err := internetgateway2.NewWANPPPConnection1Clients(); err == nil && len(clients) > 0 {
+		return upnpRouter{clients[0]}, nil
+	}
+	gatewayIP, err := gateway.DiscoverGateway()
+	if err != nil {
+		return nil, fmt.Errorf("no UPnP router found and no gateway for NAT-PMP: %w", err)
+	}
+	r := natpmpRouter{natpmp.NewClient(gatewayIP)}
+	if _, err := r.ExternalIP(); err != nil {
+		return nil, fmt.Errorf("no UPnP or NAT-PMP router found: %w", err)
+	}
+	return r, nil
+}
+
+// Opens the server ports on the router while the server is open for players
+type PortMapper struct {
+	mu     sync.Mutex
+	router router
+	mapped []portMapping
+	// Cleared by Close, an Open still looking for the router maps nothing then
+	open       bool
+	cancel     context.CancelFunc
+	externalIP string
+}
+
+// Open maps the ports and returns the external IP address. Looking for the router
+// takes seconds, callers run it in the background.
+func (p *PortMapper) Open(cfg PortMappingConfig) (string, error) {
+	p.mu.Lock()
+	p.open = true
+	r := p.router
+	p.mu.Unlock()
+	if r == nil {
+		var err error
+		if r, err = discoverRouter(); err != nil {
+			return "", err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.router = r
+	if !p.open {
+		return "", errors.New("closed while looking for the router")
+	}
+	var errs []error
+	for _, m := range cfg.mappings() {
+		if err := p.router.Map(m); err != nil {
+			errs = append(errs, fmt.Errorf("%v %v: %w", m.protocol, m.port, err))
+			continue
+		}
+		if !slices.Contains(p.mapped, m) {
+			p.mapped = append(p.mapped, m)
+		}
+	}
+	if p.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancel = cancel
+		go p.renew(ctx)
+	}
+	ip, err := p.router.ExternalIP()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	p.externalIP = ip
+	return ip, errors.Join(errs...)
+}
+
+func (p *PortMapper) renew(ctx context.Context) {
+	ticker := time.NewTicker(PORT_MAPPING_LIFETIME / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		for _, m := range p.mapped {
+			if err := p.router.Map(m); err != nil {
+				warnf("Failed to renew port mapping %v %v: %v", m.protocol, m.port, err)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Close removes the mappings made by Open
+func (p *PortMapper) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.open = false
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	var errs []error
+	for _, m := range p.mapped {
+		if err := p.router.Unmap(m); err != nil {
+			errs = append(errs, fmt.Errorf("%v %v: %w", m.protocol, m.port, err))
+		}
+	}
+	p.mapped = nil
+	p.externalIP = ""
+	return errors.Join(errs...)
+}
+
+// ExternalIP is the address reported by the router while the ports are open
+func (p *PortMapper) ExternalIP() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.externalIP
+}
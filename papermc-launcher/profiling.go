@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const DEFAULT_PROFILE_DURATION = 2 * time.Minute
+const DEFAULT_TPS_CHECK_INTERVAL = 5 * time.Minute
+
+type ProfilingConfig struct {
+	// spark (default) or timings
+	Tool     string   `json:"tool,omitempty"`
+	Duration Duration `json:"duration,omitempty"`
+	// Start a profiler automatically when a TPS alert fires
+	OnTpsAlert bool `json:"on_tps_alert,omitempty"`
+}
+
+type TpsAlertConfig struct {
+	Threshold float64  `json:"threshold"`
+	Interval  Duration `json:"interval,omitempty"`
+}
+
+var urlRegexp = regexp.MustCompile(`https?://\S+`)
+
+// TPS from last 1m, 5m, 15m: 20.0, 19.97, *20.0
+var tpsLineRegexp = regexp.MustCompile(`TPS from last 1m, 5m, 15m: (.*)$`)
+var tpsValueRegexp = regexp.MustCompile(`[0-9]+(\.[0-9]+)?`)
+
+// Parses the 1 minute TPS from the output of the tps command, the lowest region TPS on Folia
+func ParseTps(line string) (float64, error) {
+	match := tpsLineRegexp.FindStringSubmatch(line)
+	if match == nil {
+		match = foliaTpsLineRegexp.FindStringSubmatch(line)
+	}
+	if match == nil {
+		return 0, fmt.Errorf("not a tps line: %q", line)
+	}
+	// Strip ANSI color codes, they contain digits too
+	values := tpsValueRegexp.FindAllString(ansiRegexp.ReplaceAllString(match[1], ""), -1)
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no tps values in %q", line)
+	}
+	return strconv.ParseFloat(values[0], 64)
+}
+
+var ansiRegexp = regexp.MustCompile(`\x1b\[[0-9;]*m|§.`)
+
+// Profile runs the configured profiler for duration and returns the report url
+func (s *Server) Profile(ctx context.Context, duration time.Duration) (string, error) {
+	if !s.profiling.CompareAndSwap(false, true) {
+		return "", errors.New("profiler is already running")
+	}
+	defer s.profiling.Store(false)
+	if duration <= 0 {
+		duration = DEFAULT_PROFILE_DURATION
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration+2*time.Minute)
+	defer cancel()
+
+	var line string
+	var err error
+	switch s.Config().Profiling.Tool {
+	case "timings":
+		if err := s.sendInput(ctx, "timings reset"); err != nil {
+			return "", err
+		}
+		select {
+		case <-time.After(duration):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		line, err = s.Query(ctx, "timings paste", "timings.aikar.co")
+	case "", "spark":
+		line, err = s.Query(ctx, fmt.Sprintf("spark profiler start --timeout %d", int(duration.Seconds())), "spark.lucko.me")
+	default:
+		return "", fmt.Errorf("unknown profiling tool %q", s.Config().Profiling.Tool)
+	}
+	if err != nil {
+		return "", err
+	}
+	url := urlRegexp.FindString(ansiRegexp.ReplaceAllString(line, ""))
+	if url == "" {
+		return "", fmt.Errorf("no report url in %q", line)
+	}
+	return url, nil
+}
+
+func (s *Server) ProfileAndReport(ctx context.Context, duration time.Duration, reason string) {
+	infof("Profiling the server (%v)", reason)
+	url, err := s.Profile(ctx, duration)
+	if err != nil {
+		warnf("Profiling failed: %v", err)
+		return
+	}
+	s.Notify(EventProfile, s.msg(MsgProfilerReport, reason, url), "")
+}
+
+// Periodically checks the TPS and alerts when it drops below the threshold
+func (s *Server) monitorTps(ctx context.Context) {
+	interval := time.Duration(s.Config().TpsAlert.Interval)
+	if interval <= 0 {
+		interval = DEFAULT_TPS_CHECK_INTERVAL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		line, err := s.Query(checkCtx, "tps", s.Config().ServerFlavor.tpsMarker())
+		cancel()
+		if err != nil {
+			continue
+		}
+		tps, err := ParseTps(line)
+		if err != nil {
+			warnf("%v", err)
+			continue
+		}
+		if tps < s.Config().TpsAlert.Threshold {
+			s.Notify(EventTpsAlert, s.msg(MsgTpsDropped, tps, s.Config().TpsAlert.Threshold), "")
+			if s.Config().Profiling.OnTpsAlert {
+				go s.ProfileAndReport(ctx, time.Duration(s.Config().Profiling.Duration), fmt.Sprintf("TPS %.2f", tps))
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const SERVER_PROPERTIES_FILE = "server.properties"
+
+// ReadServerProperties returns the key=value pairs of server.properties, a missing file has none
+func ReadServerProperties(dir string) (map[string]string, error) {
+	props := make(map[string]string)
+	file, err := os.Open(filepath.Join(dir, SERVER_PROPERTIES_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return props, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		props[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return props, scanner.Err()
+}
+
+// SetServerProperties updates the values in place, keeping comments and the order of the other lines.
+// Returns whether anything changed.
+func SetServerProperties(dir string, values map[string]string) (bool, error) {
+	path := filepath.Join(dir, SERVER_PROPERTIES_FILE)
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		lines = nil
+	}
+	seen := make(map[string]bool)
+	changed := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, old, _ := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		seen[key] = true
+		if strings.TrimSpace(old) != value {
+			lines[i] = key + "=" + value
+			changed = true
+		}
+	}
+	var missing []string
+	for key := range values {
+		if !seen[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		lines = append(lines, key+"="+values[key])
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
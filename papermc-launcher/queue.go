@@ -0,0 +1,184 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Priority int
+
+const (
+	PriorityChat Priority = iota
+	PriorityAdmin
+	PrioritySchedule
+)
+
+const COMMAND_HISTORY_SIZE = 200
+
+// Origins of commands
+const (
+	OriginConsole  = "console"
+	OriginSchedule = "schedule"
+	OriginLauncher = "launcher"
+)
+
+// Command is either a console input or an inner command, together with where it came from
+type Command struct {
+	Input    string
+	Inner    InnerCmd
+	IsInner  bool
+	Origin   string
+	Priority Priority
+	Queued   time.Time
+	// Set when the issuer wants the output of the command back
+	Capture *Capture
+	seq     uint64
+}
+
+func (c Command) String() string {
+	if c.IsInner {
+		return c.Inner.String()
+	}
+	return c.Input
+}
+
+func ConsoleCommand(input, origin string, priority Priority) Command {
+	return Command{Input: input, Origin: origin, Priority: priority}
+}
+
+func InnerCommand(cmd InnerCmd, origin string) Command {
+	return Command{Inner: cmd, IsInner: true, Origin: origin, Priority: PrioritySchedule}
+}
+
+type commandHeap []Command
+
+func (h commandHeap) Len() int { return len(h) }
+func (h commandHeap) Less(i, j int) bool {
+	if h[i].Priority != h[j].Priority {
+		return h[i].Priority > h[j].Priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h commandHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *commandHeap) Push(x any)   { *h = append(*h, x.(Command)) }
+func (h *commandHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Single queue for commands from all sources, higher priority first, FIFO within a priority
+type CommandQueue struct {
+	mu    sync.Mutex
+	items commandHeap
+	seq   uint64
+	ready chan struct{}
+}
+
+func (q *CommandQueue) readyChan() chan struct{} {
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	return q.ready
+}
+
+func (q *CommandQueue) signal() {
+	select {
+	case q.readyChan() <- struct{}{}:
+	default:
+	}
+}
+
+func (q *CommandQueue) Push(cmd Command) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	cmd.seq = q.seq
+	cmd.Queued = time.Now()
+	heap.Push(&q.items, cmd)
+	q.signal()
+}
+
+// Ready is signalled when there are commands to pop
+func (q *CommandQueue) Ready() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.readyChan()
+}
+
+func (q *CommandQueue) Pop() (Command, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return Command{}, false
+	}
+	cmd := heap.Pop(&q.items).(Command)
+	if len(q.items) > 0 {
+		q.signal()
+	}
+	return cmd, true
+}
+
+type AuditEntry struct {
+	Time    time.Time
+	Origin  string
+	Command string
+}
+
+func (e AuditEntry) String() string {
+	return fmt.Sprintf("%v [%v] %v", e.Time.Format("Jan 02 15:04:05"), e.Origin, e.Command)
+}
+
+// The audit log is moved to <file>.1 past this size, like the launcher log
+const AUDIT_LOG_MAX_SIZE = 5 << 20
+
+// Rotated audit logs kept as <file>.1 .. <file>.N
+const AUDIT_LOG_MAX_FILES = 3
+
+// Remembers executed commands and appends them to the audit log next to the work dir
+type AuditTrail struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (a *AuditTrail) Record(workDir string, cmd Command) {
+	entry := AuditEntry{Time: time.Now(), Origin: cmd.Origin, Command: cmd.String()}
+	a.mu.Lock()
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > COMMAND_HISTORY_SIZE {
+		a.entries = a.entries[len(a.entries)-COMMAND_HISTORY_SIZE:]
+	}
+	a.mu.Unlock()
+	infof("[Audit]: %v", entry)
+	a.write(workDir, entry.String()+"\n")
+}
+
+// Appends the text to the audit log in one write, so the rotation never splits it
+func (a *AuditTrail) write(workDir, text string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := openRotatingFile(filepath.Clean(workDir)+"-audit.log", AUDIT_LOG_MAX_SIZE, AUDIT_LOG_MAX_FILES)
+	if err != nil {
+		warnf("Failed to write audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := io.WriteString(f, text); err != nil {
+		warnf("Failed to write audit log: %v", err)
+	}
+}
+
+func (a *AuditTrail) Recent(n int) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entries := a.entries
+	if n < len(entries) {
+		entries = entries[len(entries)-n:]
+	}
+	return append([]AuditEntry(nil), entries...)
+}
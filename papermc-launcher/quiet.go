@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Time of day when the launcher does not broadcast in-game messages, may cross midnight
+type QuietHours struct {
+	Start DayTime `json:"start"`
+	End   DayTime `json:"end"`
+}
+
+func (q QuietHours) Validate() error {
+	if err := q.Start.Validate(); err != nil {
+		return err
+	}
+	if err := q.End.Validate(); err != nil {
+		return err
+	}
+	if q.Start == q.End {
+		return errors.New("start and end are the same")
+	}
+	return nil
+}
+
+// Contains reports whether the time of day of t is within the quiet hours
+func (q QuietHours) Contains(t time.Time) bool {
+	day := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	start, end := q.Start.Duration(), q.End.Duration()
+	if start < end {
+		return day >= start && day < end
+	}
+	return day >= start || day < end
+}
+
+func (s *Server) quietAt(t time.Time) bool {
+	if s.Config().QuietHours == nil {
+		return false
+	}
+	loc := time.Location(s.Config().AccessSchedule.Timezone)
+	return s.Config().QuietHours.Contains(t.In(&loc))
+}
+
+// say broadcasts the text in game unless it is quiet hours
+func (s *Server) say(ctx context.Context, text string) error {
+	if s.quietAt(time.Now()) {
+		infof("Quiet hours, not broadcasting: %v", text)
+		return nil
+	}
+	return s.sendInput(ctx, "say "+text)
+}
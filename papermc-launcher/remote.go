@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// How long a console client without an Authorization header has to send its token
+const CONSOLE_AUTH_TIMEOUT = 10 * time.Second
+
+type RemoteConsoleConfig struct {
+	// Without a certificate only a loopback address is accepted, 127.0.0.1:8080 for example
+	Listen string `json:"listen"`
+	// Deprecated: single admin token, use users instead
+	Token string `json:"token,omitempty"`
+	// Serve the Go profiler under /debug/pprof/ to admins
+	Pprof bool `json:"pprof,omitempty"`
+	// Serve HTTPS with this certificate and key
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// Serve plain HTTP on a public address, behind a proxy terminating TLS for example
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+func (c *RemoteConsoleConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("cert_file and key_file have to be set together")
+	}
+	if c.CertFile == "" && !c.Insecure && !isLoopback(c.Listen) {
+		return errors.New("tokens would be sent in plain text, listen on a loopback address, set cert_file and key_file or set insecure")
+	}
+	return nil
+}
+
+// Whether the listen address only accepts local connections
+func isLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Fans out console output to the remote console clients
+type OutputBroadcaster struct {
+	mu   sync.Mutex
+	subs map[chan string]struct{}
+}
+
+func (b *OutputBroadcaster) Subscribe() chan string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[chan string]struct{})
+	}
+	ch := make(chan string, 64)
+	b.subs[ch] = struct{}{}
+	return ch
+}
+
+func (b *OutputBroadcaster) Unsubscribe(ch chan string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, ch)
+}
+
+func (b *OutputBroadcaster) Publish(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- line:
+		default:
+			// Slow client, drop the line rather than block the server output
+		}
+	}
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// The bearer token of the request. Never taken from the URL, it would end up in access logs.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+func (s *Server) handleConsole(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	user, ok := s.Config().Authenticate(token)
+	if !ok && token != "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		warnf("Remote console: upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	if !ok {
+		// Browsers can not set headers on websocket requests, they send the token as the first message
+		conn.SetReadDeadline(time.Now().Add(CONSOLE_AUTH_TIMEOUT))
+		if _, msg, err := conn.ReadMessage(); err == nil {
+			user, ok = s.Config().Authenticate(strings.TrimSpace(string(msg)))
+		}
+		if !ok {
+			closing := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized")
+			conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second))
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+	}
+	infof("Remote console: %v (%v) connected from %v", user.Name, user.Role, r.RemoteAddr)
+	defer infof("Remote console: %v disconnected", user.Name)
+
+	lines := s.output.Subscribe()
+	defer s.output.Unsubscribe(lines)
+
+	replies := make(chan string, 8)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			input := strings.TrimSpace(string(msg))
+			if input == "" {
+				continue
+			}
+			if required := RequiredRole(input); user.Role < required {
+				infof("[Remote %v]: denied %q", user.Name, input)
+				select {
+				case replies <- fmt.Sprintf("Permission denied: %q requires role %v", input, required):
+				default:
+				}
+				continue
+			}
+			infof("[Remote %v]: %v", user.Name, input)
+			s.queue.Push(ConsoleCommand(input, "remote:"+user.Name, PriorityAdmin))
+		}
+	}()
+	for {
+		select {
+		case line := <-lines:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
+				return
+			}
+		case reply := <-replies:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(reply)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// StartRemoteConsole serves the websocket console, the stats and the common routes until ctx is done
+func (s *Server) StartRemoteConsole(ctx context.Context) error {
+	cfg := s.Config().RemoteConsole
+	if cfg.Token == "" && len(s.Config().Users) == 0 {
+		return errors.New("remote console requires users or a token")
+	}
+	var tlsConfig *tls.Config
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("error loading the certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	mux := s.baseMux(cfg.Pprof)
+	mux.HandleFunc("/console", s.handleConsole)
+	mux.HandleFunc(STATS_PATH, s.authenticated(Viewer, s.serveStats))
+	if s.Config().ResourcePack != nil {
+		mux.HandleFunc(RESOURCE_PACK_PATH, s.serveResourcePack)
+		go s.watchResourcePack(ctx)
+	}
+	infof("Remote console listening on %v", listener.Addr())
+	serveHTTP(ctx, "Remote console", listener, mux)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const RESOURCE_PACK_PATH = "/resource-pack.zip"
+const RESOURCE_PACK_CHECK_INTERVAL = time.Minute
+
+// Resource pack served by the launcher's HTTP server
+type ResourcePackConfig struct {
+	File string `json:"file"`
+	// Address the players reach the launcher at, like http://example.com:8080
+	PublicURL string `json:"public_url"`
+	Required  bool   `json:"required,omitempty"`
+	Prompt    string `json:"prompt,omitempty"`
+}
+
+func (c ResourcePackConfig) Validate() error {
+	if c.File == "" || c.PublicURL == "" {
+		return errors.New("file and public_url are required")
+	}
+	return nil
+}
+
+func fileSha1(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Points server.properties at the hosted pack, returns whether anything changed
+func (c ResourcePackConfig) apply(dir string) (bool, error) {
+	sum, err := fileSha1(c.File)
+	if err != nil {
+		return false, err
+	}
+	prompt := ""
+	if c.Prompt != "" {
+		component, _ := json.Marshal(map[string]string{"text": c.Prompt})
+		prompt = string(component)
+	}
+	return SetServerProperties(dir, map[string]string{
+		// The checksum in the url makes clients drop their cached copy
+		"resource-pack":         strings.TrimSuffix(c.PublicURL, "/") + RESOURCE_PACK_PATH + "?sha1=" + sum,
+		"resource-pack-sha1":    sum,
+		"require-resource-pack": strconv.FormatBool(c.Required),
+		"resource-pack-prompt":  prompt,
+	})
+}
+
+func (s *Server) applyResourcePack() error {
+	if s.Config().ResourcePack == nil {
+		return nil
+	}
+	_, err := s.Config().ResourcePack.apply(s.Config().WorkDir)
+	return err
+}
+
+func (s *Server) serveResourcePack(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeFile(w, r, s.Config().ResourcePack.File)
+}
+
+// Updates server.properties when the pack file changes, the server reads it on the next start
+func (s *Server) watchResourcePack(ctx context.Context) {
+	var modTime time.Time
+	if stat, err := os.Stat(s.Config().ResourcePack.File); err == nil {
+		modTime = stat.ModTime()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RESOURCE_PACK_CHECK_INTERVAL):
+		}
+		stat, err := os.Stat(s.Config().ResourcePack.File)
+		if err != nil || stat.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = stat.ModTime()
+		changed, err := s.Config().ResourcePack.apply(s.Config().WorkDir)
+		if err != nil {
+			warnf("Failed to update resource pack settings: %v", err)
+		} else if changed {
+			s.reply("Resource pack changed, players get it after the next restart")
+		}
+	}
+}
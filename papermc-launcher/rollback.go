@@ -0,0 +1,178 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const USERCACHE_FILE = "usercache.json"
+
+// Suffix of the files kept when a player's data is replaced by a rollback, followed by its time
+const ROLLBACK_SUFFIX = ".before-rollback"
+
+// Per-player folders of the world, files there are named <uuid>.dat or <uuid>.json
+var playerDataDirs = []string{"playerdata", "stats", "advancements"}
+
+// Entry of the server's usercache.json
+type UserCacheEntry struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
+
+// PlayerUUID finds the uuid of a player who has been on the server
+func PlayerUUID(dir, name string) (string, error) {
+	file, err := os.Open(filepath.Join(dir, USERCACHE_FILE))
+	if err != nil {
+		return "", fmt.Errorf("error opening user cache: %w", err)
+	}
+	defer file.Close()
+	var cache []UserCacheEntry
+	if err := json.NewDecoder(file).Decode(&cache); err != nil {
+		return "", fmt.Errorf("error decoding user cache: %w", err)
+	}
+	for _, entry := range cache {
+		if strings.EqualFold(entry.Name, name) {
+			return entry.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("player %v is not in the user cache", name)
+}
+
+// Archive entry like <workdir>/world/playerdata/<uuid>.dat, returns world/playerdata/<uuid>.dat
+func playerFile(name, uuid string) (string, bool) {
+	file := path.Base(name)
+	if strings.TrimSuffix(strings.TrimSuffix(file, ".dat"), ".json") != uuid {
+		return "", false
+	}
+	kind := path.Dir(name)
+	world := path.Dir(kind)
+	for _, dir := range playerDataDirs {
+		if path.Base(kind) == dir && world != "." {
+			return path.Join(path.Base(world), dir, file), true
+		}
+	}
+	return "", false
+}
+
+// RestorePlayerData extracts the player's files from the archive into dir. Current files are kept
+// next to the restored ones as <file>.before-rollback-<time>, so earlier rollbacks are not lost.
+func RestorePlayerData(archive, dir, uuid string) ([]string, error) {
+	suffix := ROLLBACK_SUFFIX + "-" + time.Now().Format("2006-01-02_15-04-05")
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader, err := openArchive(f, archive)
+	if err != nil {
+		return nil, err
+	}
+	var restored []string
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return restored, fmt.Errorf("error reading archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		relative, ok := playerFile(header.Name, uuid)
+		if !ok {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(relative))
+		if err := restoreFile(target, suffix, reader, header.ModTime); err != nil {
+			return restored, fmt.Errorf("error restoring %v: %w", relative, err)
+		}
+		restored = append(restored, relative)
+	}
+	if len(restored) == 0 {
+		return nil, errors.New("no data for this player in the backup")
+	}
+	return restored, nil
+}
+
+func restoreFile(target, suffix string, content io.Reader, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(target); err == nil {
+		// Never replace a kept file, it may be the only copy of the data before an earlier rollback
+		if _, err := os.Lstat(target + suffix); err == nil {
+			return fmt.Errorf("%v already exists", filepath.Base(target+suffix))
+		}
+		if err := os.Rename(target, target+suffix); err != nil {
+			return err
+		}
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, modTime, modTime)
+}
+
+// Stops the server, restores one player's data from a backup and starts the server again.
+// Players on a running server get the warn_before countdown first, cancel-update stops it.
+func (s *Server) RollbackPlayer(ctx context.Context, name, backup string) error {
+	for _, player := range s.Config().Players {
+		if strings.EqualFold(player.Nickname, name) {
+			name = player.ServerName()
+		}
+	}
+	uuid, err := PlayerUUID(s.Config().WorkDir, name)
+	if err != nil {
+		return err
+	}
+	archive, err := ResolveBackup(s.Config().WorkDir, backup)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(archive); err != nil {
+		return err
+	}
+	if s.Status() == Running {
+		announce := func(left string) string { return s.msg(MsgRestartRollbackIn, left, name) }
+		s.startCountdown(ctx, announce, 0, func(runCtx context.Context) error {
+			return s.rollbackPlayer(runCtx, name, archive, uuid)
+		})
+		return nil
+	}
+	return s.rollbackPlayer(ctx, name, archive, uuid)
+}
+
+func (s *Server) rollbackPlayer(ctx context.Context, name, archive, uuid string) error {
+	if s.cmdCtx != nil {
+		s.say(s.runningCtx, s.msg(MsgRestartRollback, name))
+	}
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	restored, restoreErr := RestorePlayerData(archive, s.Config().WorkDir, uuid)
+	for _, file := range restored {
+		s.reply(fmt.Sprintf("Restored %v", file))
+	}
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+	return restoreErr
+}
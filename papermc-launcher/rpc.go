@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"papermc-launcher/launcherrpc"
+)
+
+const OriginRPC = "rpc"
+
+// Largest request the control protocol accepts
+const RPC_MAX_REQUEST = 64 << 10
+
+// Serves the launcherrpc protocol on the status socket, the socket is only reachable by the launcher's user
+func (s *Server) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON-RPC request", http.StatusMethodNotAllowed)
+		return
+	}
+	var request launcherrpc.Request
+	response := launcherrpc.Response{JSONRPC: "2.0", ID: json.RawMessage("null")}
+	if err := json.NewDecoder(io.LimitReader(r.Body, RPC_MAX_REQUEST)).Decode(&request); err != nil {
+		response.Error = &launcherrpc.Error{Code: launcherrpc.CodeParseError, Message: err.Error()}
+	} else if request.JSONRPC != "2.0" || request.Method == "" {
+		response.Error = &launcherrpc.Error{Code: launcherrpc.CodeInvalidRequest, Message: "not a JSON-RPC 2.0 request"}
+	} else {
+		if len(request.ID) > 0 {
+			response.ID = request.ID
+		}
+		var result any
+		result, response.Error = s.callRPC(r.Context(), request)
+		if response.Error == nil {
+			encoded, err := json.Marshal(result)
+			if err != nil {
+				response.Error = &launcherrpc.Error{Code: launcherrpc.CodeServerError, Message: err.Error()}
+			}
+			response.Result = encoded
+		}
+		// A notification gets no answer
+		if len(request.ID) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	if response.Error != nil {
+		response.Result = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) callRPC(ctx context.Context, request launcherrpc.Request) (any, *launcherrpc.Error) {
+	switch request.Method {
+	case launcherrpc.MethodStatus:
+		return s.StatusReport(), nil
+	case launcherrpc.MethodOpen, launcherrpc.MethodClose:
+		cmd := OpenAccess
+		if request.Method == launcherrpc.MethodClose {
+			cmd = CloseAccess
+		}
+		infof("[RPC]: %v", request.Method)
+		s.queue.Push(InnerCommand(cmd, OriginRPC))
+		return nil, nil
+	case launcherrpc.MethodCommand:
+		var params launcherrpc.CommandParams
+		if err := json.Unmarshal(request.Params, &params); err != nil || strings.TrimSpace(params.Command) == "" {
+			return nil, &launcherrpc.Error{Code: launcherrpc.CodeInvalidParams, Message: "expected {\"command\": ..., \"idle\": ...}"}
+		}
+		infof("[RPC]: %v", params.Command)
+		output, err := s.runCaptured(ctx, strings.TrimSpace(params.Command), OriginRPC, time.Duration(params.Idle))
+		if err != nil {
+			return nil, &launcherrpc.Error{Code: launcherrpc.CodeServerError, Message: err.Error()}
+		}
+		return launcherrpc.CommandResult{Output: output}, nil
+	}
+	return nil, &launcherrpc.Error{Code: launcherrpc.CodeMethodNotFound, Message: fmt.Sprintf("unknown method %q", request.Method)}
+}
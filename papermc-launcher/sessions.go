@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var joinLineRegexp = regexp.MustCompile(`^\[\d\d:\d\d:\d\d INFO\]: (\S+) joined the game$`)
+var leaveLineRegexp = regexp.MustCompile(`^\[\d\d:\d\d:\d\d INFO\]: (\S+) left the game$`)
+
+// There are 0 of a max of 20 players online:
+var listLineRegexp = regexp.MustCompile(`There are (\d+) of a max of \d+ players online`)
+
+// How long to wait for the server to answer `list`
+const LIST_TIMEOUT = 30 * time.Second
+
+// OnlineCount asks the server how many players are online.
+// Returns -1 with the error when the server does not answer.
+func (s *Server) OnlineCount(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, LIST_TIMEOUT)
+	defer cancel()
+	line, err := s.Query(ctx, "list", "of a max of")
+	if err != nil {
+		return -1, err
+	}
+	match := listLineRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return -1, fmt.Errorf("unexpected list output %q", line)
+	}
+	return strconv.Atoi(match[1])
+}
+
+// Tracks who is online and how long everyone played since the last summary
+type PlayerSessions struct {
+	mu     sync.Mutex
+	online map[string]time.Time
+	played map[string]time.Duration
+}
+
+func (p *PlayerSessions) init() {
+	if p.online == nil {
+		p.online = make(map[string]time.Time)
+		p.played = make(map[string]time.Duration)
+	}
+}
+
+func (p *PlayerSessions) Join(player string, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	p.online[player] = at
+	if _, ok := p.played[player]; !ok {
+		p.played[player] = 0
+	}
+}
+
+// Leave returns the length of the finished session
+func (p *PlayerSessions) Leave(player string, at time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	joined, ok := p.online[player]
+	if !ok {
+		return 0
+	}
+	delete(p.online, player)
+	session := at.Sub(joined)
+	p.played[player] += session
+	return session
+}
+
+// Closes all sessions, e.g. when the server stops
+func (p *PlayerSessions) LeaveAll(at time.Time) {
+	p.mu.Lock()
+	online := make([]string, 0, len(p.online))
+	for player := range p.online {
+		online = append(online, player)
+	}
+	p.mu.Unlock()
+	for _, player := range online {
+		p.Leave(player, at)
+	}
+}
+
+func (p *PlayerSessions) Online() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	players := make([]string, 0, len(p.online))
+	for player := range p.online {
+		players = append(players, player)
+	}
+	sort.Strings(players)
+	return players
+}
+
+// Summary describes the play time since the previous summary and starts a new period
+func (p *PlayerSessions) Summary(lang string, at time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	played := p.played
+	for player, joined := range p.online {
+		played[player] += at.Sub(joined)
+		p.online[player] = at
+	}
+	p.played = make(map[string]time.Duration)
+	if len(played) == 0 {
+		return Message(lang, MsgNobodyPlayed)
+	}
+	players := make([]string, 0, len(played))
+	var total time.Duration
+	for player, duration := range played {
+		players = append(players, player)
+		total += duration
+	}
+	sort.Slice(players, func(i, j int) bool { return played[players[i]] > played[players[j]] })
+	var b strings.Builder
+	b.WriteString(Message(lang, MsgPlayedTotal, len(players), total.Round(time.Minute)))
+	for _, player := range players {
+		fmt.Fprintf(&b, "\n  %v: %v", player, played[player].Round(time.Minute))
+	}
+	return b.String()
+}
+
+func (s *Server) trackSessions(line string) {
+	if match := joinLineRegexp.FindStringSubmatch(line); match != nil {
+		s.sessions.Join(match[1], time.Now())
+		s.Notify(EventPlayerJoin, s.msg(MsgPlayerJoined, match[1]), "")
+		s.tuneDistances()
+	} else if match := leaveLineRegexp.FindStringSubmatch(line); match != nil {
+		session := s.sessions.Leave(match[1], time.Now())
+		s.Notify(EventPlayerLeave, s.msg(MsgPlayerLeft, match[1], session.Round(time.Minute)), "")
+		s.closeIfEmpty()
+		s.tuneDistances()
+	}
+}
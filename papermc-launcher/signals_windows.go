@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Ctrl+C and Ctrl+Break, closing the console window is delivered as os.Interrupt too
+var shutdownSignals = []os.Signal{os.Interrupt}
+
+// FindProcess opens the process on windows and fails if it does not exist
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const DEFAULT_WARM_UP = 5 * time.Minute
+
+// Stops the java process outside the open hours to free its memory
+type SleepConfig struct {
+	// How long before the opening the server is started again
+	WarmUp Duration `json:"warm_up,omitempty"`
+}
+
+func (c SleepConfig) warmUp() time.Duration {
+	if c.WarmUp <= 0 {
+		return DEFAULT_WARM_UP
+	}
+	return time.Duration(c.WarmUp)
+}
+
+// Launcher commands that work while the server process is stopped
+var asleepCommands = []string{"wake", "cancel-update", "backup", "backups", "stats", "compat", "verify-backup", "download-backup", "reload-config", "stop", "!history", "!status", "!grep", "!tail", "!pause-schedule", "!resume-schedule"}
+
+// Whether the process should run at t: the server is open or warming up
+func (s *Server) awakeAt(t time.Time) bool {
+	if s.Config().Sleep == nil {
+		return true
+	}
+	_, open := s.Config().AccessSchedule.ClosingTime(t)
+	_, warming := s.Config().AccessSchedule.ClosingTime(t.Add(s.Config().Sleep.warmUp()))
+	return open || warming
+}
+
+// Stops the server until the next warm-up
+func (s *Server) fallAsleep() error {
+	if s.cmdCtx != nil {
+		if err := s.Stop(); err != nil {
+			return err
+		}
+	}
+	s.asleep.Store(true)
+	if next, _ := s.nextScheduled(time.Now()); next != nil {
+		infof("Server is asleep until %v", next.Format("2006-01-02 at 15:04 MST"))
+	}
+	return nil
+}
+
+func (s *Server) wakeUp(ctx context.Context) error {
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+	s.asleep.Store(false)
+	return nil
+}
+
+// Archives the work dir of the stopped server
+func (s *Server) offlineBackup(trigger string) error {
+	started := time.Now()
+	if !s.transitionFrom(Stopped, BackingUp) {
+		return fmt.Errorf("can not back up, server is %v", s.Status())
+	}
+	bakName, err := BackupFolder(s.Config().WorkDir, trigger, ColdBackup, nil)
+	s.transition(Stopped)
+	if err == nil {
+		err = VerifyAndReport(bakName)
+	}
+	s.reportBackup(trigger, started, bakName, err)
+	return err
+}
+
+// Runs the scheduled command while the process is stopped: backups are made
+// offline, the warm-up and the opening start the server.
+func (s *Server) handleAsleep(ctx context.Context, cmd InnerCmd) {
+	switch cmd {
+	case Backup, ColdBackupCmd:
+		if err := s.offlineBackup(TriggerSchedule); err != nil {
+			errorf("Backup failed: %v", err)
+		}
+	case Wake, OpenAccess:
+		infof("Waking the server up")
+		if err := s.wakeUp(ctx); err != nil {
+			errorf("Failed to start the server: %v", err)
+			return
+		}
+		if cmd == OpenAccess {
+			s.queue.Push(InnerCommand(OpenAccess, OriginSchedule))
+		}
+	case AutoUpdate:
+		if err := s.AutoUpdate(ctx); err != nil {
+			errorf("Auto-update failed: %v", err)
+		}
+	}
+}
+
+// Fires when the next scheduled command is due, or after HEALTH_CYCLE to keep the heartbeat going
+func (s *Server) sleepTimer() (<-chan time.Time, *time.Time, InnerCmd) {
+	go s.PingHealthcheck(s.Config().Healthchecks.Heartbeat, nil)
+	s.checkDiskSpace()
+	next, cmd := s.nextScheduled(time.Now())
+	wait := HEALTH_CYCLE
+	if next != nil && time.Until(*next) < wait {
+		wait = time.Until(*next)
+	}
+	return time.After(wait), next, cmd
+}
+
+func canRunAsleep(command string) bool {
+	return slices.Contains(asleepCommands, command)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A verified backup this recent makes a snapshot before a risky operation unnecessary
+const DEFAULT_SNAPSHOT_MAX_AGE = time.Hour
+
+const FORCE_FLAG = "--force"
+
+// cutForce removes --force from the command arguments
+func cutForce(arg string) (string, bool) {
+	fields := strings.Fields(arg)
+	force := slices.Contains(fields, FORCE_FLAG)
+	fields = slices.DeleteFunc(fields, func(field string) bool { return field == FORCE_FLAG })
+	return strings.Join(fields, " "), force
+}
+
+// The newest successful backup within maxAge whose archive is still on disk
+func recentBackup(workDir string, maxAge time.Duration, now time.Time) (BackupRun, bool) {
+	history, err := LoadBackupHistory(workDir)
+	if err != nil {
+		return BackupRun{}, false
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		run := history[i]
+		if now.Sub(run.Time) > maxAge {
+			break
+		}
+		if run.Error != "" || run.Archive == "" {
+			continue
+		}
+		if _, err := os.Stat(run.Archive); err == nil {
+			return run, true
+		}
+	}
+	return BackupRun{}, false
+}
+
+// ensureSnapshot makes sure the world can be brought back after the operation: a recent verified
+// backup is enough, otherwise one is taken now. Without it the operation is refused unless forced.
+func (s *Server) ensureSnapshot(operation string, force bool) error {
+	maxAge := time.Duration(s.Config().Backup.SnapshotMaxAge)
+	if maxAge <= 0 {
+		maxAge = DEFAULT_SNAPSHOT_MAX_AGE
+	}
+	if run, ok := recentBackup(s.Config().WorkDir, maxAge, time.Now()); ok {
+		s.reply(fmt.Sprintf("Backup %v from %v covers the %v", run.Archive, run.Time.Format(time.DateTime), operation))
+		return nil
+	}
+	s.reply(fmt.Sprintf("Taking a snapshot before the %v", operation))
+	var err error
+	switch {
+	case s.Status() == Running:
+		err = s.Backup(TriggerSnapshot)
+	case s.Status() == Stopped:
+		err = s.offlineBackup(TriggerSnapshot)
+	default:
+		err = fmt.Errorf("server is %v", s.Status())
+	}
+	if err == nil {
+		return nil
+	}
+	if force {
+		warnf("Proceeding with the %v without a snapshot: %v", operation, err)
+		return nil
+	}
+	return fmt.Errorf("no snapshot before the %v, add %v to proceed anyway: %w", operation, FORCE_FLAG, err)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// Creates the socket with owner-only permissions from the start, chmod after listening
+// would leave it open to other users for a moment. The umask is process-wide, files
+// created meanwhile by other goroutines only end up more restrictive.
+func listenPrivate(path string) (net.Listener, error) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
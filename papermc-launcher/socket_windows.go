@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "net"
+
+// Unix sockets on windows are guarded by the ACL of the work dir
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
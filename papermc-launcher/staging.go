@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// World of the trial start in the staging copy, removed once the start is validated
+const STAGING_LEVEL_NAME = "staging-world"
+
+// The staged server listens this far from the live ports so both can run at once
+const STAGING_PORT_OFFSET = 1000
+
+// Written into the staging copy once it started successfully
+const STAGING_READY_FILE = "staging-ready"
+
+// How long the staged server has to finish starting
+const STAGING_START_TIMEOUT = 5 * time.Minute
+
+const DEFAULT_SERVER_PORT = 25565
+
+// Files the running server keeps changing, the swap carries them over from the live directory.
+// The staged server.properties and geyser config only differ by the trial ports and world.
+var liveStateFiles = []string{
+	SERVER_PROPERTIES_FILE,
+	WHITELIST_FILE,
+	"ops.json",
+	"banned-players.json",
+	"banned-ips.json",
+	USERCACHE_FILE,
+	GEYSER_CONFIG_FILE,
+}
+
+// Directory next to the work dir where the update is prepared
+func StagingDir(workDir string) string {
+	return filepath.Clean(workDir) + "-staging"
+}
+
+// The work dir before the last swap, kept to go back by hand
+func PreviousDir(workDir string) string {
+	return filepath.Clean(workDir) + "-previous"
+}
+
+// The overworld, nether and end directories of the level
+func worldDirs(dir string) []string {
+	level := filepath.Base(LevelDir(dir))
+	return []string{level, level + "_nether", level + "_the_end"}
+}
+
+// copyTree copies dir into target, skipping the top level entries in skip. Symlinks are kept as links.
+func copyTree(dir, target string, skip map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if skip[relative] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		destination := filepath.Join(target, relative)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(destination, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, destination)
+		case d.Type().IsRegular():
+			return copyRegularFile(path, destination, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyRegularFile(source, target string, mode fs.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Ports of the live server moved by STAGING_PORT_OFFSET
+func (s *Server) stagingPorts() (int, int) {
+	port := DEFAULT_SERVER_PORT
+	if props, err := ReadServerProperties(s.Config().WorkDir); err == nil {
+		if value, err := strconv.Atoi(props["server-port"]); err == nil {
+			port = value
+		}
+	}
+	return port + STAGING_PORT_OFFSET, s.bedrockPort() + STAGING_PORT_OFFSET
+}
+
+// StageUpdate prepares the update in a copy of the work dir without the worlds and
+// checks that the updated server starts there. The live server keeps running meanwhile.
+// newVersion moves to the latest minecraft version like `update new-version`.
+func (s *Server) StageUpdate(ctx context.Context, newVersion bool) error {
+	workDir := s.Config().WorkDir
+	staging := StagingDir(workDir)
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	skip := map[string]bool{INSTANCE_LOCK_FILE: true, STATUS_SOCKET_FILE: true, "logs": true, "crash-reports": true}
+	for _, world := range worldDirs(workDir) {
+		skip[world] = true
+	}
+	s.reply(fmt.Sprintf("Copying %v to %v", workDir, staging))
+	if err := copyTree(workDir, staging, skip); err != nil {
+		return fmt.Errorf("error copying the work dir: %w", err)
+	}
+	if err := LoadPaper(staging, s.Config().ServerFlavor, s.Config().Compatibility, newVersion); err != nil {
+		return fmt.Errorf("%w: %w", ErrDownload, err)
+	}
+	if err := LoadGeyser(staging); err != nil {
+		return fmt.Errorf("%w: %w", ErrDownload, err)
+	}
+	if err := LoadBedrockPacks(staging, s.Config().BedrockPacks); err != nil {
+		return fmt.Errorf("%w: %w", ErrDownload, err)
+	}
+
+	javaPort, bedrockPort := s.stagingPorts()
+	_, err := SetServerProperties(staging, map[string]string{
+		"level-name":   STAGING_LEVEL_NAME,
+		"server-port":  strconv.Itoa(javaPort),
+		"enable-query": "false",
+		"enable-rcon":  "false",
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := ProvisionGeyserConfig(staging, GeyserConfig{Port: bedrockPort}); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.reply("Starting the staged server")
+	if err := s.validateStaging(ctx, staging); err != nil {
+		return fmt.Errorf("staged server did not start: %w", err)
+	}
+	for _, world := range worldDirs(staging) {
+		if err := os.RemoveAll(filepath.Join(staging, world)); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(staging, STAGING_READY_FILE), []byte(time.Now().Format(time.RFC3339)), 0644)
+}
+
+// Runs the server in the staging dir until it is done starting, then stops it
+func (s *Server) validateStaging(ctx context.Context, staging string) error {
+	config := *s.Config()
+	config.WorkDir = staging
+	// Only the process itself, nothing that talks to the outside
+	config.Announcements = nil
+	config.TpsAlert = nil
+	config.Healthchecks = HealthchecksConfig{}
+	config.Notifications = NotificationsConfig{}
+	trial := NewServer(&config, "")
+	trial.javaCommand = s.javaCommand
+	if err := trial.Start(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if trial.cmdCtx != nil {
+			trial.Stop()
+		}
+	}()
+	deadline := time.After(STAGING_START_TIMEOUT)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for trial.Status() != Running {
+		select {
+		case <-trial.runningCtx.Done():
+			return errors.New("the process exited")
+		case <-deadline:
+			return fmt.Errorf("not started in %v", STAGING_START_TIMEOUT)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return trial.Stop()
+}
+
+// SwapStaging makes the validated staging copy the work dir. The server has to be stopped.
+// Worlds and the files the server changed since staging move over, the old directory is kept in PreviousDir.
+func (s *Server) SwapStaging() error {
+	workDir := s.Config().WorkDir
+	staging := StagingDir(workDir)
+	if _, err := os.Stat(filepath.Join(staging, STAGING_READY_FILE)); err != nil {
+		return errors.New("no validated staged update, run stage-update first")
+	}
+	for _, name := range liveStateFiles {
+		info, err := os.Stat(filepath.Join(workDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := copyRegularFile(filepath.Join(workDir, name), filepath.Join(staging, name), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("error copying %v: %w", name, err)
+		}
+	}
+	var moved []string
+	moveBack := func() {
+		for _, name := range moved {
+			if err := os.Rename(filepath.Join(staging, name), filepath.Join(workDir, name)); err != nil {
+				errorf("Failed to move %v back: %v", name, err)
+			}
+		}
+	}
+	for _, name := range append(worldDirs(workDir), INSTANCE_LOCK_FILE, STATUS_SOCKET_FILE) {
+		err := os.Rename(filepath.Join(workDir, name), filepath.Join(staging, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			moveBack()
+			return fmt.Errorf("error moving %v: %w", name, err)
+		}
+		moved = append(moved, name)
+	}
+	previous := PreviousDir(workDir)
+	if err := os.RemoveAll(previous); err != nil {
+		moveBack()
+		return err
+	}
+	if err := os.Rename(workDir, previous); err != nil {
+		moveBack()
+		return err
+	}
+	if err := os.Rename(staging, workDir); err != nil {
+		// Put the old directory back together
+		if renameErr := os.Rename(previous, workDir); renameErr != nil {
+			return fmt.Errorf("%w, the server is left in %v: %w", err, previous, renameErr)
+		}
+		moveBack()
+		return err
+	}
+	os.Remove(filepath.Join(workDir, STAGING_READY_FILE))
+	infof("Staged update swapped in, the previous server is kept in %v", previous)
+	return nil
+}
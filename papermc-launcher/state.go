@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+type ServerState int
+
+const (
+	Stopped ServerState = iota
+	Starting
+	Running
+	Stopping
+	BackingUp
+)
+
+func (st ServerState) String() string {
+	switch st {
+	case Stopped:
+		return "stopped"
+	case Starting:
+		return "starting"
+	case Running:
+		return "running"
+	case Stopping:
+		return "stopping"
+	case BackingUp:
+		return "backup"
+	default:
+		return fmt.Sprintf("ServerState(%d)", int(st))
+	}
+}
+
+func (st ServerState) MarshalText() ([]byte, error) {
+	return []byte(st.String()), nil
+}
+
+func (st *ServerState) UnmarshalText(text []byte) error {
+	for state := Stopped; state <= BackingUp; state++ {
+		if state.String() == string(text) {
+			*st = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown server state %q", text)
+}
+
+// Allowed transitions between the states. Any state may become Stopped when the process exits.
+var stateTransitions = map[ServerState][]ServerState{
+	Stopped:   {Starting, BackingUp},
+	Starting:  {Running, Stopping},
+	Running:   {Stopping, BackingUp},
+	BackingUp: {Running, Stopping},
+	Stopping:  {},
+}
+
+func (s *Server) Status() ServerState {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.state
+}
+
+func (s *Server) transition(to ServerState) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.transitionLocked(to)
+}
+
+func (s *Server) transitionLocked(to ServerState) error {
+	if to != Stopped && !slices.Contains(stateTransitions[s.state], to) {
+		return fmt.Errorf("server is %v, can not switch to %v", s.state, to)
+	}
+	if to != s.state {
+		infof("Server state: %v -> %v", s.state, to)
+	}
+	s.state = to
+	s.stateSince = time.Now()
+	return nil
+}
+
+// Switches to the state only if the server is still in from
+func (s *Server) transitionFrom(from, to ServerState) bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.state == from && s.transitionLocked(to) == nil
+}
+
+func (s *Server) printStatus() {
+	s.stateMu.Lock()
+	state, since := s.state, s.stateSince
+	s.stateMu.Unlock()
+	status := s.msg(MsgStatus, state)
+	if !since.IsZero() {
+		status += s.msg(MsgStatusFor, time.Since(since).Round(time.Second))
+	}
+	if s.asleep.Load() {
+		status += s.msg(MsgStatusAsleep)
+	}
+	s.reply(status)
+	if until := s.schedulePausedUntil(); until != nil {
+		s.reply(s.msg(MsgStatusPaused, until.Format("15:04")))
+	}
+	if ip := s.ports.ExternalIP(); ip != "" {
+		s.reply(s.msg(MsgExternalAddress, ip))
+	}
+	if online := s.sessions.Online(); len(online) > 0 {
+		s.reply(s.msg(MsgOnline, online))
+	}
+}
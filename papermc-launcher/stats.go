@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_STATS_INTERVAL = time.Hour
+
+// The game counts time in ticks, 20 per second
+const TICK = time.Second / 20
+
+const STATS_PATH = "/stats"
+
+// Periodic export of the player statistics from world/stats
+type StatsConfig struct {
+	// Report file, CSV when it ends with .csv and JSON otherwise
+	Output   string   `json:"output"`
+	Interval Duration `json:"interval,omitempty"`
+}
+
+func (c StatsConfig) Validate() error {
+	if c.Output == "" {
+		return errors.New("output is not set")
+	}
+	return nil
+}
+
+// Highlights of one player's statistics
+type PlayerStats struct {
+	Name        string   `json:"name"`
+	UUID        string   `json:"uuid"`
+	PlayTime    Duration `json:"play_time"`
+	Deaths      int      `json:"deaths"`
+	MobKills    int      `json:"mob_kills"`
+	BlocksMined int      `json:"blocks_mined"`
+	// Block the player mined the most
+	TopBlock string `json:"top_block,omitempty"`
+}
+
+type StatsReport struct {
+	Time    time.Time     `json:"time"`
+	Players []PlayerStats `json:"players"`
+}
+
+// Layout of world/stats/<uuid>.json
+type statsFile struct {
+	Stats map[string]map[string]int `json:"stats"`
+}
+
+// ParsePlayerStats reads the statistics file of one player
+func ParsePlayerStats(path string) (PlayerStats, error) {
+	stats := PlayerStats{UUID: strings.TrimSuffix(filepath.Base(path), ".json")}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return stats, err
+	}
+	var file statsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return stats, fmt.Errorf("error decoding %v: %w", filepath.Base(path), err)
+	}
+	custom := file.Stats["minecraft:custom"]
+	ticks, ok := custom["minecraft:play_time"]
+	if !ok {
+		// Called play_one_minute before 1.17 despite counting ticks
+		ticks = custom["minecraft:play_one_minute"]
+	}
+	stats.PlayTime = Duration(time.Duration(ticks) * TICK)
+	stats.Deaths = custom["minecraft:deaths"]
+	stats.MobKills = custom["minecraft:mob_kills"]
+	top := 0
+	for block, count := range file.Stats["minecraft:mined"] {
+		stats.BlocksMined += count
+		if count > top || count == top && block < stats.TopBlock {
+			top = count
+			stats.TopBlock = block
+		}
+	}
+	stats.TopBlock = strings.TrimPrefix(stats.TopBlock, "minecraft:")
+	return stats, nil
+}
+
+// CollectStats reads the statistics of every player of the server, the most active first
+func CollectStats(dir string) (StatsReport, error) {
+	report := StatsReport{Time: time.Now()}
+	files, err := filepath.Glob(filepath.Join(LevelDir(dir), "stats", "*.json"))
+	if err != nil {
+		return report, err
+	}
+	names := make(map[string]string)
+	if content, err := os.ReadFile(filepath.Join(dir, USERCACHE_FILE)); err == nil {
+		var cache []UserCacheEntry
+		if json.Unmarshal(content, &cache) == nil {
+			for _, entry := range cache {
+				names[entry.UUID] = entry.Name
+			}
+		}
+	}
+	for _, file := range files {
+		stats, err := ParsePlayerStats(file)
+		if err != nil {
+			warnf("%v", err)
+			continue
+		}
+		stats.Name = names[stats.UUID]
+		if stats.Name == "" {
+			stats.Name = stats.UUID
+		}
+		report.Players = append(report.Players, stats)
+	}
+	sort.Slice(report.Players, func(i, j int) bool {
+		return report.Players[i].PlayTime > report.Players[j].PlayTime
+	})
+	return report, nil
+}
+
+func writeStatsCSV(path string, report StatsReport) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"name", "uuid", "play_time_minutes", "deaths", "mob_kills", "blocks_mined", "top_block"})
+	for _, p := range report.Players {
+		w.Write([]string{
+			p.Name, p.UUID, strconv.Itoa(int(time.Duration(p.PlayTime).Minutes())),
+			strconv.Itoa(p.Deaths), strconv.Itoa(p.MobKills), strconv.Itoa(p.BlocksMined), p.TopBlock,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ExportStats writes the report to the configured output
+func (c StatsConfig) Export(dir string) error {
+	report, err := CollectStats(dir)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(strings.ToLower(c.Output), ".csv") {
+		return writeStatsCSV(c.Output, report)
+	}
+	return writeJSON(c.Output, report)
+}
+
+// StartStatsExport exports the statistics every interval until ctx is done
+func (s *Server) StartStatsExport(ctx context.Context) {
+	cfg := s.Config().Stats
+	if cfg == nil {
+		return
+	}
+	interval := time.Duration(cfg.Interval)
+	if interval <= 0 {
+		interval = DEFAULT_STATS_INTERVAL
+	}
+	go func() {
+		for {
+			if err := cfg.Export(s.Config().WorkDir); err != nil {
+				warnf("Failed to export player statistics: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// Serves the current statistics as JSON to the dashboard
+func (s *Server) serveStats(w http.ResponseWriter, r *http.Request) {
+	report, err := CollectStats(s.Config().WorkDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) printStats() {
+	report, err := CollectStats(s.Config().WorkDir)
+	if err != nil {
+		s.reply(fmt.Sprintf("Error reading player statistics: %v", err))
+		return
+	}
+	if len(report.Players) == 0 {
+		s.reply("No player statistics yet")
+		return
+	}
+	for _, p := range report.Players {
+		s.reply(fmt.Sprintf("%v: played %v, %v deaths, %v mobs killed, %v blocks mined",
+			p.Name, time.Duration(p.PlayTime).Round(time.Minute), p.Deaths, p.MobKills, p.BlocksMined))
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"papermc-launcher/launcherrpc"
+)
+
+// Local socket in the work dir the running launcher answers status requests and commands on
+const STATUS_SOCKET_FILE = launcherrpc.SocketFile
+
+const STATUS_PATH = "/status"
+
+// How many upcoming scheduled events the status lists
+const STATUS_NEXT_EVENTS = 3
+
+type ScheduledEvent struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+}
+
+// Machine-readable state of the running launcher, printed by `status --json`
+type StatusReport struct {
+	State  ServerState `json:"state"`
+	Since  time.Time   `json:"since"`
+	Asleep bool        `json:"asleep,omitempty"`
+	// Scheduled actions are suspended until then
+	PausedUntil *time.Time       `json:"paused_until,omitempty"`
+	Players     []string         `json:"players"`
+	NextEvents  []ScheduledEvent `json:"next_events"`
+	Versions    VersionsInfo     `json:"versions"`
+	LastBackup  *BackupRun       `json:"last_backup,omitempty"`
+}
+
+func (r StatusReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "State: %v since %v", r.State, r.Since.Format(time.DateTime))
+	if r.Asleep {
+		b.WriteString(", asleep")
+	}
+	if r.PausedUntil != nil {
+		fmt.Fprintf(&b, "\nSCHEDULE PAUSED until %v", r.PausedUntil.Format(time.DateTime))
+	}
+	fmt.Fprintf(&b, "\nPlayers online: %v", len(r.Players))
+	if len(r.Players) > 0 {
+		fmt.Fprintf(&b, " (%v)", strings.Join(r.Players, ", "))
+	}
+	fmt.Fprintf(&b, "\nPaper: %v build %v", r.Versions.PaperVer.Version, r.Versions.PaperVer.Build)
+	for _, event := range r.NextEvents {
+		fmt.Fprintf(&b, "\nNext: %v at %v", event.Command, event.Time.Format(time.DateTime))
+	}
+	if r.LastBackup != nil {
+		fmt.Fprintf(&b, "\nLast backup: %v", r.LastBackup)
+	}
+	return b.String()
+}
+
+func (s *Server) StatusReport() StatusReport {
+	s.stateMu.Lock()
+	report := StatusReport{State: s.state, Since: s.stateSince}
+	s.stateMu.Unlock()
+	report.Asleep = s.asleep.Load()
+	report.PausedUntil = s.schedulePausedUntil()
+	report.Players = s.sessions.Online()
+	if report.Players == nil {
+		report.Players = []string{}
+	}
+	report.NextEvents = []ScheduledEvent{}
+	at := time.Now()
+	for range STATUS_NEXT_EVENTS {
+		next, command := s.nextScheduled(at)
+		if next == nil {
+			break
+		}
+		report.NextEvents = append(report.NextEvents, ScheduledEvent{Time: *next, Command: command.String()})
+		at = *next
+	}
+	if info, err := LoadVersionsInfo(s.Config().WorkDir); err == nil {
+		report.Versions = info
+	}
+	if history, err := LoadBackupHistory(s.Config().WorkDir); err == nil && len(history) > 0 {
+		report.LastBackup = &history[len(history)-1]
+	}
+	return report
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.StatusReport())
+}
+
+// StartStatusSocket serves the status and the commands on the local socket until ctx is done.
+// Only the user running the launcher can connect, so there is no authentication.
+func (s *Server) StartStatusSocket(ctx context.Context) error {
+	path := filepath.Join(s.Config().WorkDir, STATUS_SOCKET_FILE)
+	// Left by a launcher that did not exit cleanly, the instance lock guarantees it is not in use
+	os.Remove(path)
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(STATUS_PATH, s.serveStatus)
+	mux.HandleFunc(COMMAND_PATH, s.serveCommand)
+	mux.HandleFunc(launcherrpc.Path, s.serveRPC)
+	serveHTTP(ctx, "Status socket", listener, mux)
+	return nil
+}
+
+// HTTP client connected to the status socket of the launcher running in workDir
+func socketClient(workDir string) *http.Client {
+	path := filepath.Join(workDir, STATUS_SOCKET_FILE)
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+// RunStatus prints the status of the launcher running with the config
+func RunStatus(configPath string, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the status as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	response, err := socketClient(config.WorkDir).Get("http://launcher" + STATUS_PATH)
+	if err != nil {
+		return fmt.Errorf("launcher is not running in %v: %w", config.WorkDir, err)
+	}
+	defer response.Body.Close()
+	var report StatusReport
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		return fmt.Errorf("error decoding status: %w", err)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	fmt.Println(report)
+	return nil
+}
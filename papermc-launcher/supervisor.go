@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+)
+
+var ErrPanic = errors.New("panic")
+
+type shutdownHook struct {
+	name string
+	run  func() error
+}
+
+// Supervisor owns the launcher's lifetime: its context is canceled by the first shutdown
+// signal, the hooks run on the way out whether the launcher returns, fails or panics.
+// A second signal exits at once without waiting for the hooks.
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	mu     sync.Mutex
+	hooks  []shutdownHook
+	once   sync.Once
+	err    error
+}
+
+func NewSupervisor(signals ...os.Signal) *Supervisor {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s := &Supervisor{ctx: ctx, cancel: cancel}
+	if len(signals) > 0 {
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, signals...)
+		go func() {
+			sig := <-c
+			infof("Received %v, shutting down, repeat to exit immediately", sig)
+			cancel(fmt.Errorf("received %v", sig))
+			<-c
+			errorf("Exiting without waiting for the shutdown to finish")
+			os.Exit(EXIT_FAILURE)
+		}()
+	}
+	return s
+}
+
+// Canceled on a shutdown signal or when a supervised goroutine panics
+func (s *Supervisor) Context() context.Context {
+	return s.ctx
+}
+
+// OnShutdown registers a hook. Hooks run in the reverse order, like defers,
+// so whatever is set up last is torn down first.
+func (s *Supervisor) OnShutdown(name string, hook func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, shutdownHook{name: name, run: hook})
+}
+
+// Shutdown cancels the context and runs the hooks once, a failing or panicking hook does not stop the rest
+func (s *Supervisor) Shutdown() error {
+	s.once.Do(func() {
+		s.cancel(errors.New("shutting down"))
+		s.mu.Lock()
+		hooks := s.hooks
+		s.hooks = nil
+		s.mu.Unlock()
+		var errs []error
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := runHook(hooks[i]); err != nil {
+				errorf("Shutdown %v: %v", hooks[i].name, err)
+				errs = append(errs, fmt.Errorf("%v: %w", hooks[i].name, err))
+			}
+		}
+		s.err = errors.Join(errs...)
+	})
+	return s.err
+}
+
+func runHook(hook shutdownHook) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return hook.run()
+}
+
+// Run calls main and shuts down after it. The error is logged before the hooks close the log,
+// a panic is logged with its stack and returned as ErrPanic.
+func (s *Supervisor) Run(main func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			errorf("Panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		} else if err != nil {
+			errorf("%v", err)
+		}
+		if shutdownErr := s.Shutdown(); err == nil {
+			err = shutdownErr
+		}
+	}()
+	return main()
+}
+
+// Go runs f in a goroutine. If it panics the panic is logged and the launcher shuts down
+// through the context instead of crashing with the server still running.
+func (s *Supervisor) Go(name string, f func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errorf("Panic in %v: %v\n%s", name, r, debug.Stack())
+				s.cancel(fmt.Errorf("%w in %v: %v", ErrPanic, name, r))
+			}
+		}()
+		f()
+	}()
+}
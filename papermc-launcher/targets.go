@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	TargetSftp  = "sftp"
+	TargetRsync = "rsync"
+)
+
+// Off-site copy of the backups on another machine reachable over ssh
+type BackupTarget struct {
+	Name string `json:"name"`
+	// sftp or rsync (over ssh)
+	Type    string `json:"type"`
+	Host    string `json:"host"`
+	Port    int    `json:"port,omitempty"`
+	User    string `json:"user,omitempty"`
+	KeyFile string `json:"key_file,omitempty"`
+	// Remote directory for the archives
+	Path string `json:"path"`
+}
+
+func (t BackupTarget) Validate() error {
+	if t.Name == "" || t.Host == "" || t.Path == "" {
+		return errors.New("backup target needs name, host and path")
+	}
+	if t.Type != TargetSftp && t.Type != TargetRsync {
+		return fmt.Errorf("unknown backup target type %q", t.Type)
+	}
+	return nil
+}
+
+func (t BackupTarget) remote() string {
+	if t.User != "" {
+		return t.User + "@" + t.Host
+	}
+	return t.Host
+}
+
+// Non-interactive ssh options shared by ssh, sftp and rsync
+func (t BackupTarget) sshOptions(portFlag string) []string {
+	options := []string{"-o", "BatchMode=yes"}
+	if t.Port != 0 {
+		options = append(options, portFlag, strconv.Itoa(t.Port))
+	}
+	if t.KeyFile != "" {
+		options = append(options, "-i", t.KeyFile)
+	}
+	return options
+}
+
+func (t BackupTarget) run(name string, args []string, stdin string) error {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v to %v failed: %w: %s", name, t.Name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Upload copies the local files into the target directory
+func (t BackupTarget) Upload(files ...string) error {
+	if t.Type == TargetRsync {
+		ssh := strings.Join(append([]string{"ssh"}, t.sshOptions("-p")...), " ")
+		args := append([]string{"-a", "--partial", "-e", ssh}, files...)
+		return t.run("rsync", append(args, t.remote()+":"+strings.TrimSuffix(t.Path, "/")+"/"), "")
+	}
+	batch := fmt.Sprintf("-mkdir %v\n", t.Path)
+	for _, file := range files {
+		batch += fmt.Sprintf("put %q %q\n", file, path.Join(t.Path, filepath.Base(file)))
+	}
+	return t.run("sftp", append(t.sshOptions("-P"), "-b", "-", t.remote()), batch)
+}
+
+// Download fetches the named files from the target directory into dir
+func (t BackupTarget) Download(dir string, names ...string) error {
+	if t.Type == TargetRsync {
+		ssh := strings.Join(append([]string{"ssh"}, t.sshOptions("-p")...), " ")
+		args := []string{"-a", "--partial", "-e", ssh}
+		for _, name := range names {
+			args = append(args, t.remote()+":"+path.Join(t.Path, name))
+		}
+		return t.run("rsync", append(args, dir+string(os.PathSeparator)), "")
+	}
+	var batch string
+	for _, name := range names {
+		batch += fmt.Sprintf("get %q %q\n", path.Join(t.Path, name), filepath.Join(dir, name))
+	}
+	return t.run("sftp", append(t.sshOptions("-P"), "-b", "-", t.remote()), batch)
+}
+
+// Copies a finished backup with its manifest to every target
+func (s *Server) uploadBackup(archive string) {
+	files := []string{archive}
+	if _, err := os.Stat(manifestPath(archive)); err == nil {
+		files = append(files, manifestPath(archive))
+	}
+	for _, target := range s.Config().Backup.Targets {
+		infof("Uploading %v to %v", filepath.Base(archive), target.Name)
+		if err := target.Upload(files...); err != nil {
+			s.Notify(EventBackupFailed, s.msg(MsgUploadFailed), err.Error())
+			continue
+		}
+		infof("Uploaded %v to %v", filepath.Base(archive), target.Name)
+	}
+}
+
+// DownloadBackup fetches an archive and its manifest from the target next to the work dir
+func (s *Server) DownloadBackup(targetName, name string) (string, error) {
+	for _, target := range s.Config().Backup.Targets {
+		if target.Name != targetName {
+			continue
+		}
+		dir := filepath.Dir(s.Config().WorkDir)
+		if err := target.Download(dir, name); err != nil {
+			return "", err
+		}
+		archive := filepath.Join(dir, name)
+		// Older backups may have no manifest
+		target.Download(dir, filepath.Base(manifestPath(archive)))
+		return archive, nil
+	}
+	return "", fmt.Errorf("no backup target %q", targetName)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const TELEGRAM_API_URL_TEMPLATE = "https://api.telegram.org/bot%v/%v"
+
+type TelegramConfig struct {
+	Token  string `json:"token"`
+	ChatID int64  `json:"chat_id"`
+}
+
+type telegramResponse struct {
+	Ok          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+type TelegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From struct {
+			ID        int64  `json:"id"`
+			FirstName string `json:"first_name"`
+			Username  string `json:"username"`
+			IsBot     bool   `json:"is_bot"`
+		} `json:"from"`
+	} `json:"message"`
+}
+
+type TelegramClient struct {
+	Config TelegramConfig
+	client http.Client
+}
+
+func (t *TelegramClient) call(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(TELEGRAM_API_URL_TEMPLATE, url.PathEscape(t.Config.Token), method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var parsed telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return err
+	}
+	if !parsed.Ok {
+		return fmt.Errorf("telegram %v failed: %v", method, parsed.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(parsed.Result, result)
+	}
+	return nil
+}
+
+func (t *TelegramClient) Send(text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	return t.call(ctx, "sendMessage", map[string]any{"chat_id": t.Config.ChatID, "text": text}, nil)
+}
+
+// Poll long-polls updates and calls handle for every text message in the configured chat
+func (t *TelegramClient) Poll(ctx context.Context, handle func(author ChatAuthor, text string)) {
+	var offset int64
+	for ctx.Err() == nil {
+		var updates []TelegramUpdate
+		err := t.call(ctx, "getUpdates", map[string]any{"offset": offset, "timeout": 30, "allowed_updates": []string{"message"}}, &updates)
+		if err != nil {
+			if ctx.Err() == nil {
+				warnf("Telegram polling failed: %v", err)
+				select {
+				case <-time.After(10 * time.Second):
+				case <-ctx.Done():
+				}
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			msg := update.Message
+			if msg == nil || msg.Text == "" || msg.From.IsBot || msg.Chat.ID != t.Config.ChatID {
+				continue
+			}
+			author := ChatAuthor{Name: msg.From.FirstName, ID: strconv.FormatInt(msg.From.ID, 10)}
+			if author.Name == "" {
+				author.Name = msg.From.Username
+			}
+			handle(author, msg.Text)
+		}
+	}
+}
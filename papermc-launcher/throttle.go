@@ -0,0 +1,86 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Keeps a hot backup from starving the running server of disk and CPU. The reads are limited
+// in the launcher itself: cgroup io.max would throttle the whole launcher, not the backup.
+type BackupThrottle struct {
+	// Read the world at most this fast, unlimited when zero
+	ReadMBps float64 `json:"read_mbps,omitempty"`
+	// IO priority of the archiving thread on linux: idle or best-effort
+	IOClass string `json:"io_class,omitempty"`
+	// gzip level from 1, fastest, to 9, smallest. 1 when unset, hot backups trade size for less CPU
+	CompressionLevel *int `json:"compression_level,omitempty"`
+}
+
+func (t *BackupThrottle) Validate() error {
+	if t.ReadMBps < 0 {
+		return fmt.Errorf("read_mbps should not be negative")
+	}
+	switch t.IOClass {
+	case "", "idle", "best-effort":
+	default:
+		return fmt.Errorf("invalid io_class %q, expected idle or best-effort", t.IOClass)
+	}
+	if t.CompressionLevel != nil && (*t.CompressionLevel < gzip.BestSpeed || *t.CompressionLevel > gzip.BestCompression) {
+		return fmt.Errorf("compression_level should be in [1, 9]")
+	}
+	return nil
+}
+
+// gzip level of the archive, the default one without a throttle
+func (t *BackupThrottle) compressionLevel() int {
+	switch {
+	case t == nil:
+		return gzip.DefaultCompression
+	case t.CompressionLevel == nil:
+		return gzip.BestSpeed
+	}
+	return *t.CompressionLevel
+}
+
+// Sleeps whenever the reads get ahead of the rate, shared by all files of an archive
+type rateLimiter struct {
+	bytesPerSecond float64
+	started        time.Time
+	read           int64
+}
+
+func newRateLimiter(mbps float64) *rateLimiter {
+	if mbps <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSecond: mbps * (1 << 20), started: time.Now()}
+}
+
+func (l *rateLimiter) wait(n int) {
+	l.read += int64(n)
+	due := time.Duration(float64(l.read) / l.bytesPerSecond * float64(time.Second))
+	if ahead := due - time.Since(l.started); ahead > 0 {
+		time.Sleep(ahead)
+	}
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.limiter.wait(n)
+	return n, err
+}
+
+// Wraps r to read at the limiter's rate, r as is without a limiter
+func throttled(r io.Reader, limiter *rateLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return throttledReader{r: r, limiter: limiter}
+}
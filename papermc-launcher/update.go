@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How long to wait for players to leave once the update countdown is over
+const DEFAULT_UPDATE_WAIT = 5 * time.Minute
+
+// Formats a countdown for players: 5m, 1h30m, 30s
+func countdownString(d time.Duration) string {
+	text := d.Round(time.Second).String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// Announces the restart using today's warn_before offsets and waits until the last one passes
+func (s *Server) updateCountdown(ctx context.Context, announce func(left string) string) error {
+	warnings := s.Config().WarnBefore
+	if interval, ok := s.Config().AccessSchedule.Interval(time.Now()); ok {
+		warnings = interval.Warnings(warnings)
+	}
+	offsets := make([]time.Duration, 0, len(warnings))
+	for _, offset := range warnings {
+		offsets = append(offsets, time.Duration(offset))
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	if len(offsets) == 0 {
+		return nil
+	}
+	stopAt := time.Now().Add(offsets[0])
+	for _, offset := range offsets {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(stopAt.Add(-offset))):
+		}
+		s.say(ctx, announce(countdownString(offset)))
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(stopAt)):
+	}
+	return nil
+}
+
+// Waits until nobody is online, gives up after the timeout
+func (s *Server) waitForEmpty(ctx context.Context, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for len(s.sessions.Online()) > 0 && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+type UpdateOptions struct {
+	// Skip the countdown
+	Now bool
+	// Swap in the update prepared by stage-update instead of downloading
+	Staged bool
+	// Update even if the backup before it fails
+	Force bool
+	// Move to the latest minecraft version, not just the latest build of the installed one
+	NewVersion bool
+}
+
+// An update or a rollback waiting for its countdown, there is at most one
+type pendingCountdown struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Runs in the command loop once the countdown is over
+	run func(runCtx context.Context) error
+}
+
+// startCountdown announces the restart and waits for the players to leave, at most wait, in the
+// background so the command loop keeps going. UpdateDue is queued to run it once it is over.
+func (s *Server) startCountdown(ctx context.Context, announce func(left string) string, wait time.Duration, run func(runCtx context.Context) error) {
+	if s.countdown != nil {
+		s.reply("A restart countdown is already running, cancel-update stops it")
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.countdown = &pendingCountdown{ctx: ctx, cancel: cancel, run: run}
+	s.reply("Restart countdown started, cancel-update stops it")
+	go func() {
+		if err := s.updateCountdown(ctx, announce); err != nil {
+			return
+		}
+		if wait > 0 && len(s.sessions.Online()) > 0 {
+			s.say(ctx, s.msg(MsgRestartUpdateNow))
+			s.waitForEmpty(ctx, wait)
+		}
+		if ctx.Err() == nil {
+			s.queue.Push(InnerCommand(UpdateDue, OriginLauncher))
+		}
+	}()
+}
+
+// CancelCountdown stops the update countdown, reports whether one was running
+func (s *Server) CancelCountdown() bool {
+	if s.countdown == nil {
+		return false
+	}
+	s.countdown.cancel()
+	s.countdown = nil
+	return true
+}
+
+// Runs the update whose countdown is over, unless it was cancelled in the meantime.
+// The server started by the update lives in ctx, not in the countdown's context.
+func (s *Server) finishCountdown(ctx context.Context) error {
+	countdown := s.countdown
+	if countdown == nil || countdown.ctx.Err() != nil {
+		return nil
+	}
+	s.countdown = nil
+	countdown.cancel()
+	return countdown.run(ctx)
+}
+
+func (s *Server) updateAnnouncement(left string) string {
+	return s.msg(MsgRestartUpdateIn, left)
+}
+
+// How long the update waits for the players to leave after the countdown
+func (s *Server) updateWait() time.Duration {
+	if s.Config().UpdateWait == 0 {
+		return DEFAULT_UPDATE_WAIT
+	}
+	return time.Duration(s.Config().UpdateWait)
+}
+
+// Update warns the players, stops the server and backs it up. Then it either downloads the
+// new paper and geyser builds in place or swaps in the copy prepared by StageUpdate, and
+// starts the server again. Unless now is set the running server gets a countdown first,
+// the update itself happens once it is over.
+func (s *Server) Update(ctx context.Context, options UpdateOptions) error {
+	if !options.Now && s.Status() == Running {
+		options.Now = true
+		s.startCountdown(ctx, s.updateAnnouncement, s.updateWait(), func(runCtx context.Context) error {
+			return s.Update(runCtx, options)
+		})
+		return nil
+	}
+	staged := options.Staged
+	if staged && s.staging.Load() {
+		return errors.New("the update is still being staged")
+	}
+	if s.cmdCtx != nil {
+		if err := s.Stop(); err != nil {
+			return err
+		}
+	}
+	started := time.Now()
+	if !s.transitionFrom(Stopped, BackingUp) {
+		return fmt.Errorf("can not back up, server is %v", s.Status())
+	}
+	bakName, err := BackupFolder(s.Config().WorkDir, TriggerUpdate, ColdBackup, nil)
+	if err == nil {
+		err = VerifyAndReport(bakName)
+	}
+	s.transition(Stopped)
+	s.reportBackup(TriggerUpdate, started, bakName, err)
+	if err != nil && options.Force {
+		warnf("Updating without a backup: %v", err)
+	} else if err != nil {
+		// Do not update without a good backup, bring the old version back
+		if startErr := s.Start(ctx); startErr != nil {
+			return startErr
+		}
+		return fmt.Errorf("update cancelled, backup failed, add %v to update anyway: %w", FORCE_FLAG, err)
+	}
+	if staged {
+		if err := s.SwapStaging(); err != nil {
+			errorf("Failed to swap in the staged update: %v", err)
+		}
+	} else {
+		if err := LoadPaper(s.Config().WorkDir, s.Config().ServerFlavor, s.Config().Compatibility, options.NewVersion); err != nil {
+			errorf("Failed to download paper: %v", err)
+		}
+		if err := LoadGeyser(s.Config().WorkDir); err != nil {
+			errorf("Failed to download geyser: %v", err)
+		}
+	}
+	if err := LoadDatapacks(s.Config().WorkDir, s.Config().Datapacks); err != nil {
+		errorf("Failed to download datapacks: %v", err)
+	}
+	if err := LoadBedrockPacks(s.Config().WorkDir, s.Config().BedrockPacks); err != nil {
+		errorf("Failed to download bedrock packs: %v", err)
+	}
+	return s.Start(ctx)
+}
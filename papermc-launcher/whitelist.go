@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const DEFAULT_WHITELIST_RETRIES = 3
+
+// How long to wait for the server to answer `whitelist list`
+const WHITELIST_QUERY_TIMEOUT = 30 * time.Second
+
+type WhitelistConfig struct {
+	// Send the whitelist commands without checking the result
+	SkipVerify bool `json:"skip_verify,omitempty"`
+	// How many times missing changes are resent before alerting
+	Retries int `json:"retries,omitempty"`
+}
+
+// There are 2 whitelisted player(s): Steve, .Alex
+// There are no whitelisted players
+var whitelistLineRegexp = regexp.MustCompile(`There are (?:no|\d+) whitelisted player(?:s|\(s\))(?:: (.*))?$`)
+
+func ParseWhitelistLine(line string) ([]string, bool) {
+	match := whitelistLineRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+	var players []string
+	for _, name := range strings.Split(match[1], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			players = append(players, name)
+		}
+	}
+	return players, true
+}
+
+// WhitelistCommand adds the player to or removes from the whitelist, bedrock players go through floodgate
+func WhitelistCommand(player Player, add bool) string {
+	action := "remove"
+	if add {
+		action = "add"
+	}
+	if player.Type == Bedrock {
+		return fmt.Sprintf("fwhitelist %v %v", action, player.Nickname)
+	}
+	return fmt.Sprintf("whitelist %v %v", action, player.Nickname)
+}
+
+// Players whose whitelist state differs from the wanted one
+func whitelistMismatches(players []Player, listed []string, add bool) []Player {
+	present := make(map[string]bool)
+	for _, name := range listed {
+		present[strings.ToLower(name)] = true
+	}
+	var mismatched []Player
+	for _, player := range players {
+		if present[strings.ToLower(player.ServerName())] != add {
+			mismatched = append(mismatched, player)
+		}
+	}
+	return mismatched
+}
+
+func (s *Server) listWhitelist(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, WHITELIST_QUERY_TIMEOUT)
+	defer cancel()
+	line, err := s.Query(ctx, "whitelist list", "whitelisted player")
+	if err != nil {
+		return nil, err
+	}
+	players, ok := ParseWhitelistLine(line)
+	if !ok {
+		return nil, fmt.Errorf("unexpected whitelist output %q", line)
+	}
+	return players, nil
+}
+
+// SetWhitelisted adds or removes the players and checks with `whitelist list`
+// that the server applied it, resending the commands for the players it did not.
+func (s *Server) SetWhitelisted(ctx context.Context, players []Player, add bool) error {
+	pending := players
+	retries := s.Config().Whitelist.Retries
+	if retries <= 0 {
+		retries = DEFAULT_WHITELIST_RETRIES
+	}
+	for attempt := 0; ; attempt++ {
+		commands := make([]string, len(pending))
+		for i, player := range pending {
+			commands[i] = WhitelistCommand(player, add)
+		}
+		if err := s.SendBatch(ctx, commands); err != nil {
+			return err
+		}
+		if s.Config().Whitelist.SkipVerify {
+			return nil
+		}
+		listed, err := s.listWhitelist(ctx)
+		if err != nil {
+			return fmt.Errorf("error verifying whitelist: %w", err)
+		}
+		pending = whitelistMismatches(players, listed, add)
+		if len(pending) == 0 {
+			return nil
+		}
+		if attempt >= retries {
+			break
+		}
+		warnf("Whitelist change did not apply for %v players, retrying", len(pending))
+	}
+	names := make([]string, len(pending))
+	for i, player := range pending {
+		names[i] = player.ServerName()
+	}
+	err := fmt.Errorf("whitelist is wrong for %v", strings.Join(names, ", "))
+	s.Notify(EventWhitelistMismatch, s.msg(MsgWhitelistMismatch), err.Error())
+	return err
+}
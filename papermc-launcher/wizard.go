@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+type prompter struct {
+	reader *bufio.Reader
+}
+
+func (p *prompter) Ask(question, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Printf("%v [%v]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%v: ", question)
+	}
+	answer, _ := p.reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultValue
+	}
+	return answer
+}
+
+func (p *prompter) Confirm(question string) bool {
+	answer := strings.ToLower(p.Ask(question+" [y/N]", ""))
+	return answer == "y" || answer == "yes"
+}
+
+func parseInterval(value string) (TimeInterval, error) {
+	var interval TimeInterval
+	start, end, found := strings.Cut(value, "-")
+	if !found {
+		return interval, fmt.Errorf("interval should be in HH:MM-HH:MM format")
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(start), "%02d:%02d", &interval.Start.hours, &interval.Start.minutes); err != nil {
+		return interval, err
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(end), "%02d:%02d", &interval.End.hours, &interval.End.minutes); err != nil {
+		return interval, err
+	}
+	return interval, interval.Validate()
+}
+
+func AcceptEula(dir string) error {
+	content := fmt.Sprintf("# Accepted via papermc-launcher --init on %v\neula=true\n", time.Now().Format(time.RFC1123))
+	return os.WriteFile(filepath.Join(dir, "eula.txt"), []byte(content), 0644)
+}
+
+// RunInitWizard interactively creates a config, prepares the work dir and writes the config to filename.
+func RunInitWizard(filename string) error {
+	p := prompter{reader: bufio.NewReader(os.Stdin)}
+	if _, err := os.Stat(filename); err == nil {
+		if !p.Confirm(fmt.Sprintf("Config %v already exists. Overwrite?", filename)) {
+			return errors.New("aborted")
+		}
+	}
+
+	config := Config{
+		WarnBefore: []Duration{Duration(10 * time.Minute), Duration(5 * time.Minute), Duration(time.Minute)},
+		AccessSchedule: Schedule{
+			DaysSchedule: make(map[Weekday]TimeInterval),
+		},
+	}
+	config.WorkDir = p.Ask("Server work dir", "server")
+	config.Memory = p.Ask("Memory for the server (java -Xmx)", "4G")
+	for {
+		tz := p.Ask("Timezone", "Local")
+		loc, err := time.LoadLocation(tz)
+		if err == nil {
+			config.AccessSchedule.Timezone = Location(*loc)
+			break
+		}
+		fmt.Printf("Invalid timezone: %v\n", err)
+	}
+
+	fmt.Println("Enter open hours for each day as HH:MM-HH:MM, leave empty to keep the server closed that day.")
+	for _, day := range weekdays {
+		for {
+			value := p.Ask(day.String(), "")
+			if value == "" {
+				break
+			}
+			interval, err := parseInterval(value)
+			if err == nil {
+				config.AccessSchedule.DaysSchedule[Weekday(day)] = interval
+				break
+			}
+			fmt.Printf("Invalid interval: %v\n", err)
+		}
+	}
+
+	fmt.Println("Enter players, leave nickname empty to finish.")
+	for {
+		nickname := p.Ask("Nickname", "")
+		if nickname == "" {
+			break
+		}
+		player := Player{Nickname: nickname, Type: Java}
+		if strings.ToLower(p.Ask("Type (java/bedrock)", "java")) == "bedrock" {
+			player.Type = Bedrock
+		}
+		player.Op = p.Confirm("Make operator?")
+		config.Players = append(config.Players, player)
+	}
+
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	// The config keeps the path relative to itself
+	workDir := resolvePath(filepath.Dir(filename), config.WorkDir)
+	JarCacheDir = DefaultJarCacheDir()
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return err
+	}
+	fmt.Println("Minecraft EULA: https://aka.ms/MinecraftEULA")
+	if !p.Confirm("Do you accept the Minecraft EULA?") {
+		return errors.New("EULA has to be accepted to run the server")
+	}
+	if err := AcceptEula(workDir); err != nil {
+		return fmt.Errorf("error writing eula: %w", err)
+	}
+	if err := LoadPaper(workDir, FlavorPaper, nil, false); err != nil {
+		return err
+	}
+	if err := LoadGeyser(workDir); err != nil {
+		warnf("Failed to download geyser: %v", err)
+	}
+
+	if err := writeConfigFile(filename, config); err != nil {
+		return err
+	}
+	infof("Config written to %v", filename)
+	return nil
+}